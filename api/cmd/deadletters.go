@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	deadletter "govision/api/internal/modules/deadletter"
+	postgresConn "govision/api/services/postgres"
+
+	"gorm.io/gorm"
+)
+
+const commandUsage = `usage: api <command> [arguments]
+
+commands:
+  dead-letters  inspect, replay and purge dead-lettered jobs
+  users         grant and revoke admin rights
+
+Run "api <command>" for the subcommands of a command.
+`
+
+const deadLettersUsage = `usage: api dead-letters <command> [flags] [job_id...]
+
+commands:
+  list     list dead-lettered jobs
+  inspect  show the payload and history of one job
+  replay   send jobs back to the queue
+  purge    delete dead letters
+
+Run "api dead-letters <command> -h" for the flags of a command.
+`
+
+// runCommand runs the command line given in args instead of the server and
+// returns the exit status.
+func runCommand(args []string) int {
+	var run func(db *gorm.DB, args []string) error
+	var usage string
+	switch args[0] {
+	case "dead-letters":
+		run, usage = runDeadLetters, deadLettersUsage
+	case "users":
+		run, usage = runUsers, usersUsage
+	default:
+		fmt.Fprint(os.Stderr, commandUsage)
+		return 2
+	}
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		fmt.Fprintln(os.Stderr, "DATABASE_URL not found.")
+		return 1
+	}
+	db, err := postgresConn.NewConnection(databaseURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to PostgreSQL: %v\n", err)
+		return 1
+	}
+
+	err = run(db, args[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// errUsage is returned by commands called with an unknown subcommand.
+var errUsage = errors.New("usage")
+
+func runDeadLetters(db *gorm.DB, args []string) error {
+	service := deadletter.NewHandler(db).GetService()
+
+	switch args[0] {
+	case "list":
+		return listDeadLetters(service, args[1:])
+	case "inspect":
+		return inspectDeadLetter(service, args[1:])
+	case "replay":
+		return replayDeadLetters(service, args[1:])
+	case "purge":
+		return purgeDeadLetters(service, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+func listDeadLetters(service *deadletter.Service, args []string) error {
+	flags, filter := filterFlags("list")
+	asJSON := flags.Bool("json", false, "print JSON instead of a table")
+	if err := parseFilterFlags(flags, filter, args); err != nil {
+		return err
+	}
+
+	letters, err := service.List(*filter)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(letters)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB ID\tREASON\tMODEL\tATTEMPTS\tREPLAYS\tLAST FAILED\tREPLAYED\tERROR")
+	for _, letter := range letters {
+		replayed := "-"
+		if letter.ReplayedAt != nil {
+			replayed = letter.ReplayedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			letter.JobID, letter.Reason, letter.ModelName, letter.Attempts, letter.ReplayCount,
+			letter.LastFailedAt.Format(time.RFC3339), replayed, truncate(letter.Error, 80))
+	}
+	return w.Flush()
+}
+
+func inspectDeadLetter(service *deadletter.Service, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: api dead-letters inspect <job_id>")
+	}
+
+	letter, err := service.Get(args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(letter)
+}
+
+func replayDeadLetters(service *deadletter.Service, args []string) error {
+	flags, filter := filterFlags("replay")
+	if err := parseFilterFlags(flags, filter, args); err != nil {
+		return err
+	}
+
+	result, err := service.Replay(*filter, cliActor())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Replayed %d job(s)\n", result.Replayed)
+	for _, jobID := range result.JobIDs {
+		fmt.Println(jobID)
+	}
+	return nil
+}
+
+func purgeDeadLetters(service *deadletter.Service, args []string) error {
+	flags, filter := filterFlags("purge")
+	if err := parseFilterFlags(flags, filter, args); err != nil {
+		return err
+	}
+
+	result, err := service.Purge(*filter, cliActor())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d dead letter(s)\n", result.Purged)
+	for _, jobID := range result.JobIDs {
+		fmt.Println(jobID)
+	}
+	return nil
+}
+
+// filterFlags declares the flags selecting dead letters. Job IDs are given
+// as arguments after the flags.
+func filterFlags(command string) (*flag.FlagSet, *deadletter.Filter) {
+	filter := &deadletter.Filter{}
+	flags := flag.NewFlagSet("dead-letters "+command, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: api dead-letters %s [flags] [job_id...]\n", command)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&filter.Reason, "reason", "", "only entries that failed for this reason")
+	flags.StringVar(&filter.Model, "model", "", "only entries of this model")
+	flags.StringVar(&filter.State, "state", "", `"failed" or "replayed"`)
+	flags.Func("before", "only entries that last failed before this RFC 3339 time", func(raw string) error {
+		before, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return err
+		}
+		filter.Before = &before
+		return nil
+	})
+	flags.IntVar(&filter.Limit, "limit", 0, "maximum number of entries")
+	if command != "list" {
+		flags.BoolVar(&filter.All, "all", false, "select every entry when no other filter is given")
+	}
+	return flags, filter
+}
+
+func parseFilterFlags(flags *flag.FlagSet, filter *deadletter.Filter, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	filter.JobIDs = flags.Args()
+	return nil
+}
+
+// cliActor identifies the operator in the job event history.
+func cliActor() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "unknown"
+	}
+	return "cli:" + user
+}
+
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
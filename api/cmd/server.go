@@ -1,35 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 
 	middlewares "govision/api/internal/middlewares"
 	routes "govision/api/internal/routes"
 	rabbitmqConn "govision/api/services/rabbitmq"
 
 	auth "govision/api/internal/modules/auth"
+	deadletter "govision/api/internal/modules/deadletter"
 	file "govision/api/internal/modules/file"
 	job "govision/api/internal/modules/job"
+	model "govision/api/internal/modules/model"
+	worker "govision/api/internal/modules/worker"
+	"govision/api/services/outbox"
 	postgresConn "govision/api/services/postgres"
+	"govision/api/services/spool"
+	"govision/pkg/queue"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds | log.Lshortfile)
 	_ = godotenv.Load()
 
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	port := os.Getenv("API_PORT")
 	if port == "" {
 		panic("API_PORT not found.")
 	}
 
-	publisher := rabbitmqConn.PublisherFactory()
-
 	databaseURL := os.Getenv("DATABASE_URL")
 	if databaseURL == "" {
 		panic("DATABASE_URL not found.")
@@ -49,13 +65,47 @@ func main() {
 		log.Fatalf("[ERROR] - Failed to run migrations: %v", err)
 	}
 
+	queueConfig := queue.ConfigFromEnv()
+	if err := queueConfig.Validate(); err != nil {
+		log.Fatalf("[ERROR] - Invalid job queue configuration: %v", err)
+	}
+	publisher := newPublisher(db, queueConfig)
+
+	var uploadSpool *spool.Spool
+	if spoolConfig := spool.ConfigFromEnv(); spoolConfig.Dir != "" {
+		uploadSpool, err = spool.New(spoolConfig)
+		if err != nil {
+			log.Fatalf("[ERROR] - Failed to open upload spool: %v", err)
+		}
+	}
+
 	e := echo.New()
 	e = middlewares.ApplySecurityMiddlewares(e)
 
-	fileHandler := file.NewHandler(publisher)
+	fileHandler := file.NewHandler(db, uploadSpool, file.ConfigFromEnv())
 	jobHandler := job.NewHandler(db)
 	authHandler := auth.NewHandler(db, jwtSecret)
-	routes.InitRoutes(e, fileHandler, jobHandler, authHandler)
+	modelHandler := model.NewHandler(db)
+	deadLetterHandler := deadletter.NewHandler(db)
+	workerHandler := worker.NewHandler(db)
+	routes.InitRoutes(e, fileHandler, jobHandler, authHandler, modelHandler, deadLetterHandler, workerHandler)
+
+	// Background loops stop only after the HTTP server has drained, so
+	// uploads finishing during shutdown are still spooled and relayed.
+	background, stopBackground := context.WithCancel(context.Background())
+	var backgroundWG sync.WaitGroup
+	backgroundWG.Add(2)
+	go func() {
+		defer backgroundWG.Done()
+		fileHandler.GetService().RunSpoolRetrier(background)
+	}()
+	outboxConfig := outbox.ConfigFromEnv()
+	log.Printf("[OUTBOX] - Publishing job messages as envelope version %d", outboxConfig.MessageVersion)
+	go func() {
+		defer backgroundWG.Done()
+		outbox.NewRelay(db, publisher, outboxConfig).Run(background)
+	}()
+
 	srv := &http.Server{
 		Addr:         ":" + port,
 		Handler:      e,
@@ -64,8 +114,76 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Println("Server Listening on port: port")
-	if err := srv.ListenAndServe(); err != nil {
-		log.Fatalln("error starting server: ", err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server Listening on port: %s", port)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalln("error starting server: ", err)
+		}
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let active requests, uploads
+	// included, finish before the connections they use are closed.
+	timeout := shutdownTimeout()
+	log.Printf("[SHUTDOWN] - Draining active requests (up to %s)", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[SHUTDOWN] - Requests still active after %s: %v", timeout, err)
+		srv.Close()
+	}
+
+	stopBackground()
+	backgroundWG.Wait()
+
+	if err := publisher.Close(); err != nil {
+		log.Printf("[SHUTDOWN] - Failed to close job queue: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("[SHUTDOWN] - Failed to close database: %v", err)
+		}
+	}
+	log.Println("[SHUTDOWN] - Shutdown complete")
+}
+
+// newPublisher returns the publisher of the job queue backend selected by
+// cfg.
+func newPublisher(db *gorm.DB, cfg queue.Config) queue.Publisher {
+	log.Printf("[INIT] - Job queue backend: %s (queue %q)", cfg.Backend, cfg.Queue)
+
+	switch cfg.Backend {
+	case queue.BackendPostgres:
+		return queue.NewPostgres(db, cfg)
+	case queue.BackendMemory:
+		log.Println("[WARNING] - The memory job queue is not shared with workers, jobs will not be processed")
+		return queue.NewMemory()
+	default:
+		return rabbitmqConn.PublisherFactory(cfg.Queue)
+	}
+}
+
+// shutdownTimeout reads API_SHUTDOWN_TIMEOUT, the time active requests get
+// to finish once the server is stopping.
+func shutdownTimeout() time.Duration {
+	raw := os.Getenv("API_SHUTDOWN_TIMEOUT")
+	if raw == "" {
+		return defaultShutdownTimeout
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		log.Printf("[WARNING] - Invalid API_SHUTDOWN_TIMEOUT %q, using %s", raw, defaultShutdownTimeout)
+		return defaultShutdownTimeout
 	}
+	return value
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	auth "govision/api/internal/modules/auth"
+
+	"gorm.io/gorm"
+)
+
+const usersUsage = `usage: api users <command> [user]
+
+commands:
+  grant-admin <user>   give a user access to the /v1/admin routes
+  revoke-admin <user>  take that access away
+  admins               list the users with admin rights
+
+A user is given by ID or by exact email address.
+`
+
+func runUsers(db *gorm.DB, args []string) error {
+	service := auth.NewService(auth.NewAuthRepository(db), "")
+
+	switch {
+	case args[0] == "admins" && len(args) == 1:
+		return listAdmins(service)
+	case (args[0] == "grant-admin" || args[0] == "revoke-admin") && len(args) == 2:
+		user, err := service.SetAdmin(args[1], args[0] == "grant-admin")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (%s): admin=%t\n", user.Email, user.ID, user.IsAdmin)
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func listAdmins(service *auth.Service) error {
+	users, err := service.ListAdmins()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tCREATED")
+	for _, user := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", user.ID, user.Email, user.CreatedAt.Format("2006-01-02"))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+
+	"govision/api/internal/modules/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminOnly restricts a route to users whose is_admin flag is set. It must
+// run after JWTAuth, which stores the caller's user ID in the context. The
+// flag is read from the database on every request, so revoking it takes
+// effect immediately; the email claim of the token is never trusted.
+func AdminOnly(authService *auth.Service) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, _ := c.Get("user_id").(string)
+			admin, err := authService.IsAdmin(userID)
+			if err != nil {
+				log.Printf("[ERROR] - Failed to check admin rights: %v", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"message": "Error checking permissions",
+				})
+			}
+			if !admin {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"message": "Admin access required",
+				})
+			}
+			return next(c)
+		}
+	}
+}
@@ -14,6 +14,8 @@ type AuthRepository interface {
 	FindRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
 	RevokeRefreshToken(tokenID uuid.UUID) error
 	RevokeAllUserTokens(userID uuid.UUID) error
+	SetAdmin(id uuid.UUID, admin bool) error
+	ListAdmins() ([]User, error)
 }
 
 type postgresAuthRepository struct {
@@ -71,3 +73,15 @@ func (r *postgresAuthRepository) RevokeAllUserTokens(userID uuid.UUID) error {
 		Where("user_id = ? AND revoked = false", userID).
 		Update("revoked", true).Error
 }
+
+func (r *postgresAuthRepository) SetAdmin(id uuid.UUID, admin bool) error {
+	return r.db.Model(&User{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"is_admin": admin, "updated_at": gorm.Expr("NOW()")}).Error
+}
+
+func (r *postgresAuthRepository) ListAdmins() ([]User, error) {
+	var users []User
+	err := r.db.Where("is_admin").Order("email").Find(&users).Error
+	return users, err
+}
@@ -167,6 +167,55 @@ func (s *Service) ValidateAccessToken(tokenString string) (*JWTClaims, error) {
 	return claims, nil
 }
 
+// IsAdmin reports whether the user with the given ID holds admin rights.
+// Unknown users are not admins.
+func (s *Service) IsAdmin(userID string) (bool, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return false, nil
+	}
+
+	user, err := s.repo.FindUserByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find user: %w", err)
+	}
+	return user.IsAdmin, nil
+}
+
+// SetAdmin grants or revokes the admin rights of the user identified by
+// ref, a user ID or an exact email address. It is meant for operators: the
+// API never grants admin rights on its own.
+func (s *Service) SetAdmin(ref string, admin bool) (*User, error) {
+	var user *User
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = s.repo.FindUserByID(id)
+	} else {
+		user, err = s.repo.FindUserByEmail(ref)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("user %q not found", ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if err := s.repo.SetAdmin(user.ID, admin); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	user.IsAdmin = admin
+	log.Printf("[AUTH] - Admin rights of %s set to %t", user.Email, admin)
+	return user, nil
+}
+
+// ListAdmins returns the users holding admin rights.
+func (s *Service) ListAdmins() ([]User, error) {
+	return s.repo.ListAdmins()
+}
+
 func (s *Service) generateAccessToken(user *User) (string, error) {
 	now := time.Now()
 	claims := JWTClaims{
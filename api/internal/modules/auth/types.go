@@ -12,6 +12,7 @@ type User struct {
 	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	Email        string    `gorm:"column:email;type:varchar(255);uniqueIndex;not null" json:"email"`
 	PasswordHash string    `gorm:"column:password_hash;type:varchar(255);not null" json:"-"`
+	IsAdmin      bool      `gorm:"column:is_admin;not null;default:false" json:"is_admin"`
 	CreatedAt    time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
 	UpdatedAt    time.Time `gorm:"column:updated_at;not null;default:now()" json:"updated_at"`
 }
@@ -0,0 +1,180 @@
+package deadletter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"govision/api/internal/modules/job"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Handler exposes the admin endpoints of dead-lettered jobs.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new dead-letter handler with its dependencies.
+func NewHandler(db *gorm.DB) *Handler {
+	jobs := job.NewService(job.NewJobRepository(db))
+	return &Handler{service: NewService(NewDeadLetterRepository(db), jobs)}
+}
+
+// ListDeadLetters handles GET /admin/dead-letters.
+func (h *Handler) ListDeadLetters(c echo.Context) error {
+	log.Println("[STARTING] - calling route /admin/dead-letters...")
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+
+	letters, err := h.service.List(filter)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, letters)
+}
+
+// GetDeadLetter handles GET /admin/dead-letters/:job_id.
+func (h *Handler) GetDeadLetter(c echo.Context) error {
+	log.Println("[STARTING] - calling route /admin/dead-letters/:job_id...")
+
+	letter, err := h.service.Get(strings.TrimSpace(c.Param("job_id")))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, letter)
+}
+
+// ReplayDeadLetter handles POST /admin/dead-letters/:job_id/replay.
+func (h *Handler) ReplayDeadLetter(c echo.Context) error {
+	log.Println("[STARTING] - calling route POST /admin/dead-letters/:job_id/replay...")
+
+	result, err := h.service.ReplayJob(strings.TrimSpace(c.Param("job_id")), actor(c))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusAccepted, result)
+}
+
+// ReplayDeadLetters handles POST /admin/dead-letters/replay, replaying the
+// entries selected by the query parameters.
+func (h *Handler) ReplayDeadLetters(c echo.Context) error {
+	log.Println("[STARTING] - calling route POST /admin/dead-letters/replay...")
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+
+	result, err := h.service.Replay(filter, actor(c))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusAccepted, result)
+}
+
+// PurgeDeadLetter handles DELETE /admin/dead-letters/:job_id.
+func (h *Handler) PurgeDeadLetter(c echo.Context) error {
+	log.Println("[STARTING] - calling route DELETE /admin/dead-letters/:job_id...")
+
+	result, err := h.service.PurgeJob(strings.TrimSpace(c.Param("job_id")), actor(c))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// PurgeDeadLetters handles DELETE /admin/dead-letters, deleting the entries
+// selected by the query parameters.
+func (h *Handler) PurgeDeadLetters(c echo.Context) error {
+	log.Println("[STARTING] - calling route DELETE /admin/dead-letters...")
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+
+	result, err := h.service.Purge(filter, actor(c))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetService exposes the service to the command line.
+func (h *Handler) GetService() *Service {
+	return h.service
+}
+
+func (h *Handler) errorResponse(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	message := "Error processing dead-letter request"
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, ErrAlreadyReplayed):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, ErrNoFilter), errors.Is(err, ErrInvalidFilter):
+		status, message = http.StatusBadRequest, err.Error()
+	default:
+		log.Printf("[ERROR] - %v", err)
+	}
+
+	return c.JSON(status, map[string]string{
+		"message": message,
+	})
+}
+
+// parseFilter reads the job_id (comma-separated), reason, model, before
+// (RFC 3339), state, all and limit query parameters.
+func parseFilter(c echo.Context) (Filter, error) {
+	filter := Filter{
+		Reason: strings.TrimSpace(c.QueryParam("reason")),
+		Model:  strings.TrimSpace(c.QueryParam("model")),
+		State:  strings.TrimSpace(c.QueryParam("state")),
+	}
+
+	for _, jobID := range strings.Split(c.QueryParam("job_id"), ",") {
+		if jobID = strings.TrimSpace(jobID); jobID != "" {
+			filter.JobIDs = append(filter.JobIDs, jobID)
+		}
+	}
+
+	if raw := c.QueryParam("before"); raw != "" {
+		before, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("%w: before must be an RFC 3339 timestamp", ErrInvalidFilter)
+		}
+		filter.Before = &before
+	}
+	if raw := c.QueryParam("all"); raw != "" {
+		all, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, fmt.Errorf("%w: all must be a boolean", ErrInvalidFilter)
+		}
+		filter.All = all
+	}
+	if raw := c.QueryParam("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return filter, fmt.Errorf("%w: limit must be a positive integer", ErrInvalidFilter)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// actor identifies the administrator in the job event history.
+func actor(c echo.Context) string {
+	email, _ := c.Get("email").(string)
+	return email
+}
@@ -0,0 +1,169 @@
+package deadletter
+
+import (
+	"fmt"
+
+	"govision/api/internal/modules/job"
+	"govision/pkg/outbox"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeadLetterRepository defines the contract for dead-letter persistence.
+type DeadLetterRepository interface {
+	List(filter Filter) ([]DeadLetter, error)
+	FindByJobID(jobID string) (*DeadLetter, error)
+	// Replay queues the messages of the matching entries again through the
+	// outbox and returns their job IDs.
+	Replay(filter Filter, actor string) ([]string, error)
+	// Purge deletes the matching entries and returns their job IDs.
+	Purge(filter Filter, actor string) ([]string, error)
+}
+
+type postgresDeadLetterRepository struct {
+	db *gorm.DB
+}
+
+// NewDeadLetterRepository creates a new PostgreSQL-backed dead-letter
+// repository.
+func NewDeadLetterRepository(db *gorm.DB) DeadLetterRepository {
+	return &postgresDeadLetterRepository{db: db}
+}
+
+func (r *postgresDeadLetterRepository) List(filter Filter) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	query := applyFilter(r.db, filter).Order("last_failed_at DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&letters).Error; err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+func (r *postgresDeadLetterRepository) FindByJobID(jobID string) (*DeadLetter, error) {
+	var letter DeadLetter
+	if err := r.db.Where("job_id = ?", jobID).First(&letter).Error; err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// Replay locks the matching entries and, in the same transaction, records
+// an outbox event per message, marks the entries replayed, puts their jobs
+// back in the queued state and appends a replayed event to their history.
+// The relay publishes the messages once the transaction commits.
+func (r *postgresDeadLetterRepository) Replay(filter Filter, actor string) ([]string, error) {
+	var jobIDs []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		letters, err := lock(tx, filter)
+		if err != nil {
+			return err
+		}
+
+		for _, letter := range letters {
+			replay := letter.ReplayCount + 1
+			dedupeKey := fmt.Sprintf("replay:%s:%d", letter.JobID, replay)
+			payload := outbox.ReplayPayload{JobID: letter.JobID, Body: []byte(letter.Payload)}
+			if err := outbox.Enqueue(tx, outbox.EventJobReplayed, dedupeKey, payload); err != nil {
+				return err
+			}
+
+			if err := tx.Model(&DeadLetter{}).Where("id = ?", letter.ID).Updates(map[string]any{
+				"replay_count": replay,
+				"replayed_at":  gorm.Expr("now()"),
+			}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Exec(`UPDATE jobs SET status = 'queued' WHERE job_id = ?`, letter.JobID).Error; err != nil {
+				return err
+			}
+
+			if err := job.RecordEvent(tx, letter.JobID, job.EventReplayed, actor, map[string]any{
+				"reason": letter.Reason,
+				"replay": replay,
+			}); err != nil {
+				return err
+			}
+			jobIDs = append(jobIDs, letter.JobID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobIDs, nil
+}
+
+// Purge deletes the matching entries and appends a purged event to the
+// history of their jobs, which keep their failed status.
+func (r *postgresDeadLetterRepository) Purge(filter Filter, actor string) ([]string, error) {
+	var jobIDs []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		letters, err := lock(tx, filter)
+		if err != nil {
+			return err
+		}
+
+		for _, letter := range letters {
+			if err := tx.Where("id = ?", letter.ID).Delete(&DeadLetter{}).Error; err != nil {
+				return err
+			}
+
+			if err := job.RecordEvent(tx, letter.JobID, job.EventPurged, actor, map[string]any{
+				"reason":   letter.Reason,
+				"attempts": letter.Attempts,
+			}); err != nil {
+				return err
+			}
+			jobIDs = append(jobIDs, letter.JobID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobIDs, nil
+}
+
+// lock selects the matching entries for update, so a concurrent replay or
+// purge of the same entries waits for this one.
+func lock(tx *gorm.DB, filter Filter) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	query := applyFilter(tx, filter).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Order("last_failed_at")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&letters).Error; err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+func applyFilter(db *gorm.DB, filter Filter) *gorm.DB {
+	query := db.Model(&DeadLetter{})
+	if len(filter.JobIDs) > 0 {
+		query = query.Where("job_id IN ?", filter.JobIDs)
+	}
+	if filter.Reason != "" {
+		query = query.Where("reason = ?", filter.Reason)
+	}
+	if filter.Model != "" {
+		query = query.Where("model_name = ?", filter.Model)
+	}
+	if filter.Before != nil {
+		query = query.Where("last_failed_at < ?", *filter.Before)
+	}
+	switch filter.State {
+	case StateFailed:
+		query = query.Where("replayed_at IS NULL")
+	case StateReplayed:
+		query = query.Where("replayed_at IS NOT NULL")
+	}
+	return query
+}
@@ -0,0 +1,186 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"govision/api/internal/modules/job"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotFound        = errors.New("dead letter not found")
+	ErrAlreadyReplayed = errors.New("dead letter already replayed")
+	ErrNoFilter        = errors.New("a filter or all=true is required")
+	ErrInvalidFilter   = errors.New("invalid filter")
+)
+
+// Service handles the inspection, replay and purge of dead letters.
+type Service struct {
+	repo DeadLetterRepository
+	jobs *job.Service
+}
+
+// NewService creates a new dead-letter service. jobs provides the event
+// history shown with each dead letter.
+func NewService(repo DeadLetterRepository, jobs *job.Service) *Service {
+	return &Service{repo: repo, jobs: jobs}
+}
+
+// List returns the matching dead letters, most recent failures first.
+func (s *Service) List(filter Filter) ([]DeadLetterResponse, error) {
+	if err := validateFilter(&filter); err != nil {
+		return nil, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultListLimit
+	}
+
+	letters, err := s.repo.List(filter)
+	if err != nil {
+		return nil, fmt.Errorf("error listing dead letters: %w", err)
+	}
+
+	response := make([]DeadLetterResponse, len(letters))
+	for i := range letters {
+		response[i] = toResponse(&letters[i])
+	}
+	return response, nil
+}
+
+// Get returns a dead letter with its payload and the history of its job.
+func (s *Service) Get(jobID string) (*DeadLetterDetail, error) {
+	letter, err := s.find(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.jobs.GetJobEvents(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterDetail{
+		DeadLetterResponse: toResponse(letter),
+		Payload:            payloadJSON(letter.Payload),
+		Events:             events,
+	}, nil
+}
+
+// Replay sends the matching messages back to the job queue. Unless the
+// filter selects a state, only entries not replayed since they last failed
+// are replayed, so repeating a replay does not queue a job twice.
+func (s *Service) Replay(filter Filter, actor string) (*ReplayResponse, error) {
+	if err := validateFilter(&filter); err != nil {
+		return nil, err
+	}
+	if filter.empty() && !filter.All {
+		return nil, ErrNoFilter
+	}
+	if filter.State == "" {
+		filter.State = StateFailed
+	}
+
+	jobIDs, err := s.repo.Replay(filter, actor)
+	if err != nil {
+		return nil, fmt.Errorf("error replaying dead letters: %w", err)
+	}
+
+	log.Printf("[SUCCESS] - %d dead letter(s) replayed by %s", len(jobIDs), actor)
+	return &ReplayResponse{Replayed: len(jobIDs), JobIDs: nonNil(jobIDs)}, nil
+}
+
+// ReplayJob sends the message of one job back to the job queue.
+func (s *Service) ReplayJob(jobID, actor string) (*ReplayResponse, error) {
+	letter, err := s.find(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if letter.ReplayedAt != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyReplayed, jobID)
+	}
+	return s.Replay(Filter{JobIDs: []string{jobID}}, actor)
+}
+
+// Purge deletes the matching dead letters. Their jobs stay failed.
+func (s *Service) Purge(filter Filter, actor string) (*PurgeResponse, error) {
+	if err := validateFilter(&filter); err != nil {
+		return nil, err
+	}
+	if filter.empty() && !filter.All {
+		return nil, ErrNoFilter
+	}
+
+	jobIDs, err := s.repo.Purge(filter, actor)
+	if err != nil {
+		return nil, fmt.Errorf("error purging dead letters: %w", err)
+	}
+
+	log.Printf("[SUCCESS] - %d dead letter(s) purged by %s", len(jobIDs), actor)
+	return &PurgeResponse{Purged: len(jobIDs), JobIDs: nonNil(jobIDs)}, nil
+}
+
+// PurgeJob deletes the dead letter of one job.
+func (s *Service) PurgeJob(jobID, actor string) (*PurgeResponse, error) {
+	if _, err := s.find(jobID); err != nil {
+		return nil, err
+	}
+	return s.Purge(Filter{JobIDs: []string{jobID}}, actor)
+}
+
+func (s *Service) find(jobID string) (*DeadLetter, error) {
+	letter, err := s.repo.FindByJobID(jobID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, jobID)
+		}
+		return nil, fmt.Errorf("error querying dead letter: %w", err)
+	}
+	return letter, nil
+}
+
+func validateFilter(filter *Filter) error {
+	switch filter.State {
+	case "", StateFailed, StateReplayed:
+	default:
+		return fmt.Errorf("%w: state must be %q or %q", ErrInvalidFilter, StateFailed, StateReplayed)
+	}
+	if filter.Limit < 0 || filter.Limit > maxListLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFilter, maxListLimit)
+	}
+	return nil
+}
+
+// payloadJSON returns the payload as is when it is valid JSON, else as a
+// JSON string.
+func payloadJSON(payload string) json.RawMessage {
+	if json.Valid([]byte(payload)) {
+		return json.RawMessage(payload)
+	}
+	encoded, _ := json.Marshal(payload)
+	return encoded
+}
+
+func nonNil(jobIDs []string) []string {
+	if jobIDs == nil {
+		return []string{}
+	}
+	return jobIDs
+}
+
+func toResponse(letter *DeadLetter) DeadLetterResponse {
+	return DeadLetterResponse{
+		JobID:         letter.JobID,
+		Reason:        letter.Reason,
+		Error:         letter.Error,
+		ModelName:     letter.ModelName,
+		Attempts:      letter.Attempts,
+		ReplayCount:   letter.ReplayCount,
+		FirstFailedAt: letter.FirstFailedAt,
+		LastFailedAt:  letter.LastFailedAt,
+		ReplayedAt:    letter.ReplayedAt,
+	}
+}
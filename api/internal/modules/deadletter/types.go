@@ -0,0 +1,99 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"time"
+
+	"govision/api/internal/modules/job"
+
+	"github.com/google/uuid"
+)
+
+// Dead-letter states a filter can select.
+const (
+	// StateFailed selects entries not replayed since they last failed.
+	StateFailed = "failed"
+	// StateReplayed selects entries sent back to the queue.
+	StateReplayed = "replayed"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// DeadLetter represents the dead_letters table, written by the worker when
+// it gives up on a message. Attempts counts how often the job failed and
+// ReplayCount how often it was sent back to the queue.
+type DeadLetter struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	JobID         string     `gorm:"column:job_id;type:varchar(255);uniqueIndex;not null"`
+	Reason        string     `gorm:"column:reason;type:varchar(50);not null"`
+	Error         string     `gorm:"column:error;type:text;not null;default:''"`
+	Payload       string     `gorm:"column:payload;type:text;not null"`
+	ModelName     string     `gorm:"column:model_name;type:varchar(100);not null;default:''"`
+	Attempts      int        `gorm:"column:attempts;not null;default:1"`
+	ReplayCount   int        `gorm:"column:replay_count;not null;default:0"`
+	FirstFailedAt time.Time  `gorm:"column:first_failed_at;not null;default:now()"`
+	LastFailedAt  time.Time  `gorm:"column:last_failed_at;not null;default:now()"`
+	ReplayedAt    *time.Time `gorm:"column:replayed_at"`
+}
+
+func (DeadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// Filter selects dead letters. Empty fields match everything; replays and
+// purges need at least one field set, or All.
+type Filter struct {
+	JobIDs []string
+	Reason string
+	Model  string
+	// Before matches entries that last failed before it.
+	Before *time.Time
+	// State is StateFailed, StateReplayed or empty for both.
+	State string
+	// All confirms a replay or purge of every entry.
+	All bool
+	// Limit bounds the number of entries listed.
+	Limit int
+}
+
+// empty reports whether the filter selects every entry.
+func (f Filter) empty() bool {
+	return len(f.JobIDs) == 0 && f.Reason == "" && f.Model == "" && f.Before == nil && f.State == ""
+}
+
+// DeadLetterResponse is the DTO of a dead letter in listings.
+type DeadLetterResponse struct {
+	JobID         string     `json:"job_id"`
+	Reason        string     `json:"reason"`
+	Error         string     `json:"error"`
+	ModelName     string     `json:"model_name,omitempty"`
+	Attempts      int        `json:"attempts"`
+	ReplayCount   int        `json:"replay_count"`
+	FirstFailedAt time.Time  `json:"first_failed_at"`
+	LastFailedAt  time.Time  `json:"last_failed_at"`
+	ReplayedAt    *time.Time `json:"replayed_at,omitempty"`
+}
+
+// DeadLetterDetail is the DTO of GET /admin/dead-letters/:job_id. Payload
+// is the message as received by the worker, as a JSON string when it was
+// not valid JSON.
+type DeadLetterDetail struct {
+	DeadLetterResponse
+	Payload json.RawMessage     `json:"payload"`
+	Events  []job.EventResponse `json:"events"`
+}
+
+// ReplayResponse is the DTO returned by the replay endpoints.
+type ReplayResponse struct {
+	Replayed int      `json:"replayed"`
+	JobIDs   []string `json:"job_ids"`
+}
+
+// PurgeResponse is the DTO returned by the purge endpoints.
+type PurgeResponse struct {
+	Purged int      `json:"purged"`
+	JobIDs []string `json:"job_ids"`
+}
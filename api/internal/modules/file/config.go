@@ -0,0 +1,52 @@
+package file
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// Config groups the settings of the upload pipeline.
+type Config struct {
+	Normalize NormalizeOptions
+	Limits    ImageLimits
+}
+
+// ConfigFromEnv builds the upload configuration from the environment,
+// falling back to defaults on missing or invalid values:
+//
+//	IMAGE_MAX_DIMENSION  longest side after normalization, 0 disables downsizing
+//	IMAGE_JPEG_QUALITY   quality used when re-encoding JPEG (1-100)
+//	IMAGE_MAX_WIDTH      maximum accepted upload width in pixels
+//	IMAGE_MAX_HEIGHT     maximum accepted upload height in pixels
+//	IMAGE_MAX_PIXELS     maximum accepted width*height
+func ConfigFromEnv() Config {
+	limits := defaultImageLimits()
+	return Config{
+		Normalize: NormalizeOptions{
+			MaxDimension: envInt("IMAGE_MAX_DIMENSION", 0, 0, 0),
+			JPEGQuality:  envInt("IMAGE_JPEG_QUALITY", defaultJPEGQuality, 1, 100),
+		},
+		Limits: ImageLimits{
+			MaxWidth:  envInt("IMAGE_MAX_WIDTH", limits.MaxWidth, 1, 0),
+			MaxHeight: envInt("IMAGE_MAX_HEIGHT", limits.MaxHeight, 1, 0),
+			MaxPixels: envInt("IMAGE_MAX_PIXELS", limits.MaxPixels, 1, 0),
+		},
+	}
+}
+
+// envInt reads an integer environment variable within [minValue, maxValue]
+// (maxValue 0 means unbounded) and returns fallback when it is unset or invalid.
+func envInt(name string, fallback, minValue, maxValue int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < minValue || (maxValue > 0 && value > maxValue) {
+		log.Printf("[WARNING] - Invalid %s %q, using %d", name, raw, fallback)
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,268 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"slices"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+// decoders maps every accepted upload format to its full image decoder.
+var decoders = map[string]func(io.Reader) (image.Image, error){
+	"jpeg": jpeg.Decode,
+	"png":  png.Decode,
+	"gif":  gif.Decode,
+	"webp": webp.Decode,
+	"bmp":  bmp.Decode,
+	"tiff": tiff.Decode,
+}
+
+// configDecoders read only the header of each format to obtain its
+// dimensions without allocating the pixel buffer.
+var configDecoders = map[string]func(io.Reader) (image.Config, error){
+	"jpeg": jpeg.DecodeConfig,
+	"png":  png.DecodeConfig,
+	"gif":  gif.DecodeConfig,
+	"webp": webp.DecodeConfig,
+	"bmp":  bmp.DecodeConfig,
+	"tiff": tiff.DecodeConfig,
+}
+
+// formatExtensions lists the file extensions accepted for each format.
+var formatExtensions = map[string][]string{
+	"jpeg": {".jpg", ".jpeg", ".jpe", ".jfif"},
+	"png":  {".png"},
+	"gif":  {".gif"},
+	"webp": {".webp"},
+	"bmp":  {".bmp", ".dib"},
+	"tiff": {".tif", ".tiff"},
+}
+
+// detectImageFormat identifies the image format from its magic bytes.
+// It returns an empty string when the header matches no accepted format.
+func detectImageFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return "gif"
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return "webp"
+	case bytes.HasPrefix(header, []byte("BM")) && len(header) >= 26:
+		return "bmp"
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return "tiff"
+	}
+	return ""
+}
+
+// outputFormat returns the format a decoded image is stored in. JPEG and PNG
+// are kept as they are; everything else is transcoded to a format Roboflow
+// accepts: JPEG for opaque images and PNG when transparency must be kept.
+func outputFormat(inputFormat string, img image.Image) string {
+	switch inputFormat {
+	case "jpeg", "png":
+		return inputFormat
+	}
+
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return "jpeg"
+	}
+	return "png"
+}
+
+// hasValidTrailer reports whether the stream ends exactly where the format
+// says it should. header holds the leading bytes of the file, tail its last
+// bytes and size its total length. TIFF has no fixed terminator: its end
+// depends on where its IFDs point, so decodeImage, which holds the whole
+// file, checks it against tiffEnd instead.
+func hasValidTrailer(format string, header, tail []byte, size int64) bool {
+	switch format {
+	case "jpeg":
+		return bytes.HasSuffix(tail, []byte{0xFF, 0xD9})
+	case "png":
+		return bytes.HasSuffix(tail, []byte("IEND\xaeB`\x82"))
+	case "gif":
+		return bytes.HasSuffix(tail, []byte{0x3B})
+	case "webp":
+		riffSize := int64(binary.LittleEndian.Uint32(header[4:8]))
+		return riffSize+8 == size
+	case "bmp":
+		fileSize := int64(binary.LittleEndian.Uint32(header[2:6]))
+		return fileSize == 0 || fileSize == size
+	}
+	return true
+}
+
+// TIFF tags whose values locate data outside the IFD: offset tags paired with
+// the tag holding the byte count of each block, and pointers to further IFDs.
+var (
+	tiffBlockTags = map[uint16]uint16{
+		273: 279, // StripOffsets, StripByteCounts
+		324: 325, // TileOffsets, TileByteCounts
+		288: 289, // FreeOffsets, FreeByteCounts
+		513: 514, // JPEGInterchangeFormat, JPEGInterchangeFormatLength
+	}
+	tiffIFDTags = []uint16{
+		330,   // SubIFDs
+		34665, // Exif IFD
+		34853, // GPS IFD
+		40965, // Interoperability IFD
+	}
+)
+
+// tiffTypeSizes maps TIFF field types to the size of one value in bytes.
+var tiffTypeSizes = map[uint16]int64{
+	1: 1, 2: 1, 6: 1, 7: 1, // BYTE, ASCII, SBYTE, UNDEFINED
+	3: 2, 8: 2, // SHORT, SSHORT
+	4: 4, 9: 4, 11: 4, 13: 4, // LONG, SLONG, FLOAT, IFD
+	5: 8, 10: 8, 12: 8, // RATIONAL, SRATIONAL, DOUBLE
+}
+
+// maxTIFFIFDs bounds the IFDs tiffEnd visits, so a crafted chain cannot make
+// it loop for long.
+const maxTIFFIFDs = 64
+
+// tiffEnd returns the offset just past the last byte a TIFF file references:
+// its IFDs, the values stored outside them and the strip, tile or JPEG data,
+// following the IFD chain and the sub-IFD, Exif, GPS and interoperability
+// pointers. Values start on word boundaries, so a single padding byte after
+// an odd end is allowed for. References past the end of data are left to the
+// decoder, which reports the file as truncated; a malformed header yields
+// len(data), as the decoder rejects it anyway.
+func tiffEnd(data []byte) int64 {
+	size := int64(len(data))
+	if size < 8 {
+		return size
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return size
+	}
+
+	end := int64(8)
+	pending := []int64{int64(order.Uint32(data[4:8]))}
+	visited := make(map[int64]bool)
+	for len(pending) > 0 && len(visited) < maxTIFFIFDs {
+		ifd := pending[0]
+		pending = pending[1:]
+		if ifd == 0 || visited[ifd] {
+			continue
+		}
+		if ifd+2 > size {
+			return size
+		}
+		visited[ifd] = true
+
+		entries := int64(order.Uint16(data[ifd : ifd+2]))
+		ifdEnd := ifd + 2 + entries*12 + 4
+		if ifdEnd > size {
+			return size
+		}
+		end = max(end, ifdEnd)
+		pending = append(pending, int64(order.Uint32(data[ifdEnd-4:ifdEnd])))
+
+		values := make(map[uint16][]int64)
+		for i := int64(0); i < entries; i++ {
+			entry := data[ifd+2+i*12 : ifd+2+(i+1)*12]
+			tag, length, offset, ok := tiffField(entry, order)
+			if !ok {
+				continue
+			}
+			if length > 4 {
+				end = max(end, offset+length)
+			}
+			if isTIFFReference(tag) {
+				values[tag] = tiffValues(data, entry, order)
+			}
+		}
+
+		for offsetTag, countTag := range tiffBlockTags {
+			offsets, counts := values[offsetTag], values[countTag]
+			for i := range min(len(offsets), len(counts)) {
+				end = max(end, offsets[i]+counts[i])
+			}
+		}
+		for _, tag := range tiffIFDTags {
+			pending = append(pending, values[tag]...)
+		}
+	}
+
+	if end%2 == 1 {
+		end++
+	}
+	return end
+}
+
+// isTIFFReference reports whether the values of tag locate data outside its
+// IFD: block offsets and counts, and IFD pointers.
+func isTIFFReference(tag uint16) bool {
+	for offsetTag, countTag := range tiffBlockTags {
+		if tag == offsetTag || tag == countTag {
+			return true
+		}
+	}
+	return slices.Contains(tiffIFDTags, tag)
+}
+
+// tiffField decodes an IFD entry: its tag, the length of its values in bytes
+// and, when they do not fit in the entry, their offset. ok is false for
+// unknown field types.
+func tiffField(entry []byte, order binary.ByteOrder) (tag uint16, length, offset int64, ok bool) {
+	tag = order.Uint16(entry[0:2])
+	typeSize, ok := tiffTypeSizes[order.Uint16(entry[2:4])]
+	if !ok {
+		return 0, 0, 0, false
+	}
+	length = typeSize * int64(order.Uint32(entry[4:8]))
+	return tag, length, int64(order.Uint32(entry[8:12])), true
+}
+
+// tiffValues reads the SHORT, LONG or IFD values of an IFD entry. It returns
+// nil for other types and for values outside data.
+func tiffValues(data, entry []byte, order binary.ByteOrder) []int64 {
+	var typeSize int64
+	switch order.Uint16(entry[2:4]) {
+	case 3: // SHORT
+		typeSize = 2
+	case 4, 13: // LONG, IFD
+		typeSize = 4
+	default:
+		return nil
+	}
+
+	length := typeSize * int64(order.Uint32(entry[4:8]))
+	raw := entry[8:12]
+	if length > 4 {
+		offset := int64(order.Uint32(entry[8:12]))
+		if offset+length > int64(len(data)) {
+			return nil
+		}
+		raw = data[offset : offset+length]
+	}
+
+	values := make([]int64, 0, length/typeSize)
+	for i := int64(0); i < length; i += typeSize {
+		if typeSize == 2 {
+			values = append(values, int64(order.Uint16(raw[i:])))
+		} else {
+			values = append(values, int64(order.Uint32(raw[i:])))
+		}
+	}
+	return values
+}
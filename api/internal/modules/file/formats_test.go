@@ -0,0 +1,290 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+func TestDetectImageFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0}, "jpeg"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), "png"},
+		{"gif87a", []byte("GIF87a"), "gif"},
+		{"gif89a", []byte("GIF89a"), "gif"},
+		{"webp", []byte("RIFF\x20\x00\x00\x00WEBPVP8L"), "webp"},
+		{"riff that is not webp", []byte("RIFF\x20\x00\x00\x00WAVEfmt "), ""},
+		{"short riff", []byte("RIFF\x20\x00\x00\x00WEB"), ""},
+		{"bmp", append([]byte("BM"), make([]byte, 24)...), "bmp"},
+		{"bmp shorter than its header", []byte("BM\x00\x00"), ""},
+		{"little-endian tiff", []byte("II*\x00\x08\x00\x00\x00"), "tiff"},
+		{"big-endian tiff", []byte("MM\x00*\x00\x00\x00\x08"), "tiff"},
+		{"tiff magic of the wrong byte order", []byte("II\x00*"), ""},
+		{"text", []byte("hello"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectImageFormat(tt.header); got != tt.want {
+				t.Errorf("detectImageFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadImage(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		filename string // upload name, defaults to the fixture name
+		format   string
+		width    int
+		height   int
+	}{
+		{fixture: "gradient.jpg", format: "jpeg", width: 8, height: 6},
+		{fixture: "gradient.png", format: "png", width: 8, height: 6},
+		{fixture: "gradient.gif", format: "gif", width: 8, height: 6},
+		{fixture: "gradient.bmp", format: "bmp", width: 8, height: 6},
+		{fixture: "gradient.bmp", filename: "gradient.dib", format: "bmp", width: 8, height: 6},
+		{fixture: "gradient.tiff", format: "tiff", width: 8, height: 6},
+		{fixture: "gradient.tiff", filename: "GRADIENT.TIF", format: "tiff", width: 8, height: 6},
+		{fixture: "solid.webp", format: "webp", width: 8, height: 6},
+		{fixture: "solid.webp", filename: "blob", format: "webp", width: 8, height: 6},
+	}
+	for _, tt := range tests {
+		filename := tt.filename
+		if filename == "" {
+			filename = tt.fixture
+		}
+		t.Run(filename, func(t *testing.T) {
+			img, format, _, err := readImage(filename, openFixture(t, tt.fixture), defaultImageLimits())
+			if err != nil {
+				t.Fatalf("readImage() error = %v", err)
+			}
+			if format != tt.format {
+				t.Errorf("format = %q, want %q", format, tt.format)
+			}
+			if b := img.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestReadImageWebPPixels(t *testing.T) {
+	img, _, _, err := readImage("solid.webp", openFixture(t, "solid.webp"), defaultImageLimits())
+	if err != nil {
+		t.Fatalf("readImage() error = %v", err)
+	}
+	want := color.NRGBA{R: 200, G: 100, B: 50, A: 255}
+	if got := color.NRGBAModel.Convert(img.At(3, 3)); got != want {
+		t.Errorf("pixel = %v, want %v", got, want)
+	}
+}
+
+// The trailer of BMP and WebP is checked against the file size in their
+// header, which must survive decoders reading past the peeked bytes.
+func TestReadImageLargerThanHeaderPeek(t *testing.T) {
+	var buf bytes.Buffer
+	if err := bmp.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 300))); err != nil {
+		t.Fatalf("encoding bmp: %v", err)
+	}
+	if buf.Len() <= headerPeekSize {
+		t.Fatalf("bmp is %d bytes, want more than %d", buf.Len(), headerPeekSize)
+	}
+
+	if _, _, _, err := readImage("large.bmp", bytes.NewReader(buf.Bytes()), defaultImageLimits()); err != nil {
+		t.Errorf("readImage() error = %v", err)
+	}
+
+	buf.WriteString("PK\x03\x04")
+	_, _, _, err := readImage("large.bmp", bytes.NewReader(buf.Bytes()), defaultImageLimits())
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Code != CodeTrailingData {
+		t.Errorf("readImage() with appended data error = %v, want %s", err, CodeTrailingData)
+	}
+}
+
+func TestReadImageRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		filename string // upload name, defaults to the fixture name
+		limits   *ImageLimits
+		code     string
+	}{
+		{name: "text file", fixture: "not-an-image.txt", code: CodeUnsupportedFormat},
+		{name: "riff audio", fixture: "wave.wav", code: CodeUnsupportedFormat},
+		{name: "bmp named png", fixture: "gradient.bmp", filename: "photo.png", code: CodeExtensionMismatch},
+		{name: "webp named jpg", fixture: "solid.webp", filename: "photo.jpg", code: CodeExtensionMismatch},
+		{name: "truncated bmp", fixture: "truncated.bmp", code: CodeTruncatedImage},
+		{name: "truncated tiff", fixture: "truncated.tiff", code: CodeTruncatedImage},
+		{name: "truncated webp", fixture: "truncated.webp", code: CodeTruncatedImage},
+		{name: "bmp with appended data", fixture: "trailing-data.bmp", code: CodeTrailingData},
+		{name: "webp with appended data", fixture: "trailing-data.webp", code: CodeTrailingData},
+		{name: "tiff with appended data", fixture: "trailing-data.tiff", code: CodeTrailingData},
+		{name: "bmp claiming 20000x20000", fixture: "bomb.bmp", code: CodeDimensionsTooBig},
+		{name: "webp claiming 16384x16384", fixture: "bomb.webp", code: CodeDimensionsTooBig},
+		{
+			name:    "tiff over a lowered pixel cap",
+			fixture: "gradient.tiff",
+			limits:  &ImageLimits{MaxWidth: 100, MaxHeight: 100, MaxPixels: 47},
+			code:    CodeDimensionsTooBig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := tt.filename
+			if filename == "" {
+				filename = tt.fixture
+			}
+			limits := defaultImageLimits()
+			if tt.limits != nil {
+				limits = *tt.limits
+			}
+
+			_, _, _, err := readImage(filename, openFixture(t, tt.fixture), limits)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("readImage() error = %v, want a validation error", err)
+			}
+			if validationErr.Code != tt.code {
+				t.Errorf("code = %q (%s), want %q", validationErr.Code, validationErr.Message, tt.code)
+			}
+		})
+	}
+}
+
+// tiffIFD encodes a little-endian IFD of SHORT or LONG entries, given as
+// tag, type, count and value, followed by the offset of the next IFD.
+func tiffIFD(next uint32, entries ...[4]uint32) []byte {
+	ifd := binary.LittleEndian.AppendUint16(nil, uint16(len(entries)))
+	for _, e := range entries {
+		ifd = binary.LittleEndian.AppendUint16(ifd, uint16(e[0]))
+		ifd = binary.LittleEndian.AppendUint16(ifd, uint16(e[1]))
+		ifd = binary.LittleEndian.AppendUint32(ifd, e[2])
+		ifd = binary.LittleEndian.AppendUint32(ifd, e[3])
+	}
+	return binary.LittleEndian.AppendUint32(ifd, next)
+}
+
+// tiffAt lays out a little-endian TIFF whose first IFD is at offset 8, with
+// blocks written at the given offsets and zeros in between.
+func tiffAt(blocks map[int][]byte) []byte {
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	for offset, block := range blocks {
+		if end := offset + len(block); end > len(data) {
+			data = append(data, make([]byte, end-len(data))...)
+		}
+		copy(data[offset:], block)
+	}
+	return data
+}
+
+func TestTIFFEnd(t *testing.T) {
+	const short, long, ascii = 3, 4, 2
+	// One strip of 5 bytes at 38, just past the 30-byte IFD.
+	strip := tiffIFD(0, [4]uint32{273, long, 1, 38}, [4]uint32{279, long, 1, 5})
+	stripFile := tiffAt(map[int][]byte{8: strip, 38: []byte("pixel")})
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "gradient.tiff"))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	var deflated bytes.Buffer
+	if err := tiff.Encode(&deflated, image.NewGray(image.Rect(0, 0, 64, 48)), &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		t.Fatalf("encoding tiff: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		// The fixture is 399 bytes; a padding byte would be accepted.
+		{name: "go encoder, uncompressed", data: fixture, want: len(fixture) + 1},
+		{name: "go encoder, deflate", data: deflated.Bytes(), want: deflated.Len()},
+		{name: "appended data", data: append(slices.Clone(fixture), "PK\x03\x04"...), want: len(fixture) + 1},
+		// The strip ends at 43; values start on word boundaries.
+		{name: "odd end", data: stripFile, want: 44},
+		{name: "padding byte", data: append(slices.Clone(stripFile), 0), want: 44},
+		{name: "data after the padding", data: append(slices.Clone(stripFile), 0, 0), want: 44},
+		{
+			name: "strips as SHORT arrays",
+			data: tiffAt(map[int][]byte{
+				8:  tiffIFD(0, [4]uint32{273, short, 2, 40<<16 | 38}, [4]uint32{279, short, 2, 4<<16 | 2}),
+				38: []byte("ab"),
+				40: []byte("cdef"),
+			}),
+			want: 44,
+		},
+		{
+			name: "strip offsets stored outside the IFD",
+			data: tiffAt(map[int][]byte{
+				8:  tiffIFD(0, [4]uint32{273, long, 2, 38}, [4]uint32{279, long, 2, 46}),
+				38: binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, 54), 60),
+				46: binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, 6), 4),
+				54: []byte("strip1"),
+				60: []byte("two!"),
+			}),
+			want: 64,
+		},
+		{
+			name: "second page",
+			data: tiffAt(map[int][]byte{
+				8:  tiffIFD(38, [4]uint32{273, long, 1, 68}, [4]uint32{279, long, 1, 2}),
+				38: tiffIFD(0, [4]uint32{273, long, 1, 70}, [4]uint32{279, long, 1, 6}),
+				68: []byte("p1"),
+				70: []byte("page 2"),
+			}),
+			want: 76,
+		},
+		{
+			name: "exif ifd",
+			data: tiffAt(map[int][]byte{
+				8:  tiffIFD(0, [4]uint32{34665, long, 1, 26}),
+				26: tiffIFD(0, [4]uint32{0x9003, ascii, 20, 44}),
+				44: []byte("2026:10:18 12:00:00\x00"),
+			}),
+			want: 64,
+		},
+		{
+			name: "ifd chain looping on itself",
+			data: tiffAt(map[int][]byte{8: tiffIFD(8, [4]uint32{274, short, 1, 1})}),
+			want: 26,
+		},
+		// Truncation is reported by the decoder.
+		{name: "strip past the end", data: stripFile[:40], want: 44},
+		{name: "ifd past the end", data: tiffAt(map[int][]byte{8: strip})[:20], want: 20},
+		{name: "first ifd past the end", data: []byte("II*\x00\x00\x01\x00\x00"), want: 8},
+		{name: "not a tiff", data: []byte("GIF89a trailing"), want: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tiffEnd(tt.data); got != int64(tt.want) {
+				t.Errorf("tiffEnd() = %d, want %d (file is %d bytes)", got, tt.want, len(tt.data))
+			}
+		})
+	}
+}
+
+func openFixture(t testing.TB, name string) *bytes.Reader {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	return bytes.NewReader(data)
+}
@@ -1,53 +1,189 @@
 package file
 
 import (
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
-	"govision/api/services/rabbitmq"
+	"govision/api/internal/modules/model"
+	"govision/api/services/spool"
+	"govision/pkg/endpoint"
+	"govision/pkg/envelope"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
 	service *Service
 }
 
-func NewHandler(p rabbitmq.JobPublisher) *Handler {
-	return &Handler{service: NewService(p)}
+// NewHandler creates a new upload handler with its dependencies.
+// uploadSpool may be nil to disable store-and-forward.
+func NewHandler(db *gorm.DB, uploadSpool *spool.Spool, cfg Config) *Handler {
+	models := model.NewService(model.NewModelRepository(db), endpoint.AllowlistFromEnv())
+	return &Handler{service: NewService(NewJobRepository(db), models, uploadSpool, cfg)}
 }
 
+// maxFieldSize bounds the text form fields read ahead of the file part.
+const maxFieldSize = 16 << 10
+
+// uploadOptionFields are the option names accepted as query parameters or
+// as text fields before the file part.
+var uploadOptionFields = []string{"model", "tile_size", "tile_overlap", "postprocess"}
+
+// setUploadOption parses one upload option into opts. Range checks are left
+// to ValidateUploadOptions.
+func setUploadOption(opts *UploadOptions, name, value string) *ValidationError {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	switch name {
+	case "model":
+		opts.Model = value
+	case "tile_size":
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return newValidationError(http.StatusUnprocessableEntity, CodeInvalidOption,
+				"tile_size must be an integer")
+		}
+		opts.TileSize = size
+	case "tile_overlap":
+		overlap, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return newValidationError(http.StatusUnprocessableEntity, CodeInvalidOption,
+				"tile_overlap must be a number")
+		}
+		opts.TileOverlap = &overlap
+	case "postprocess":
+		opts.Postprocess = value
+	}
+	return nil
+}
+
+// UploadFileImage handles POST /image/upload. The multipart body is read as a
+// stream, so the "file" part goes to the service without being parsed into
+// memory or a temporary file first. Options are taken from the query string
+// and from text fields sent before the file part.
 func (h *Handler) UploadFileImage(c echo.Context) error {
 	log.Println("[STARTING] - calling route /image/upload...")
 
-	var request UploadRequest
-	if err := c.Bind(&request); err != nil {
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
 		log.Printf("[ERROR] - Invalid payload: %v", err)
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"message": "Invalid payload",
 		})
 	}
 
+	opts := UploadOptions{
+		Trace: envelope.TraceFromHeaders(c.Request().Header.Get("traceparent"), c.Request().Header.Get("tracestate")),
+	}
+	if userID, _ := c.Get("user_id").(string); userID != "" {
+		opts.User = &envelope.User{ID: userID}
+	}
+	for _, name := range uploadOptionFields {
+		if value := c.QueryParam(name); value != "" {
+			if err := setUploadOption(&opts, name, value); err != nil {
+				return c.JSON(err.Status, map[string]string{
+					"code":    err.Code,
+					"message": err.Message,
+				})
+			}
+		}
+	}
+
 	log.Println("[RUNNING] - Getting file.")
-	file, err := c.FormFile("file")
-	if err != nil {
-		log.Printf("[ERROR] - error getting file data: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "Error getting file data",
-		})
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"code":    CodeFileRequired,
+				"message": "File is required",
+			})
+		}
+		if err != nil {
+			log.Printf("[ERROR] - error getting file data: %v", err)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Error getting file data",
+			})
+		}
+
+		if name := part.FormName(); slices.Contains(uploadOptionFields, name) {
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize))
+			part.Close()
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"message": "Error getting form data",
+				})
+			}
+			if err := setUploadOption(&opts, name, string(value)); err != nil {
+				return c.JSON(err.Status, map[string]string{
+					"code":    err.Code,
+					"message": err.Message,
+				})
+			}
+			continue
+		}
+
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		ctx := c.Request().Context()
+		result, err := h.service.ProcessUpload(ctx, part.FileName(), opts, part)
+		part.Close()
+		if err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				log.Printf("[ERROR] - Upload rejected: %v", validationErr)
+				return c.JSON(validationErr.Status, map[string]string{
+					"code":    validationErr.Code,
+					"message": validationErr.Message,
+				})
+			}
+
+			if errors.Is(err, ErrStorageUnavailable) {
+				log.Printf("[ERROR] - %v", err)
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": err.Error(),
+				})
+			}
+
+			log.Printf("[ERROR] - %v", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"message": err.Error(),
+			})
+		}
+
+		return c.JSON(http.StatusAccepted, result)
 	}
+}
 
-	ctx := c.Request().Context()
-	jobID, err := h.service.ProcessUpload(ctx, file)
+// GetSpoolStatus handles GET /admin/spool and lists the jobs waiting for
+// the storage backend.
+func (h *Handler) GetSpoolStatus(c echo.Context) error {
+	log.Println("[STARTING] - calling route /admin/spool...")
+
+	status, err := h.service.SpoolStatus()
 	if err != nil {
 		log.Printf("[ERROR] - %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": err.Error(),
+			"message": "Error reading spool",
 		})
 	}
 
-	return c.JSON(http.StatusAccepted, map[string]string{
-		"job_id": jobID,
-		"status": "queued",
-	})
+	return c.JSON(http.StatusOK, status)
+}
+
+// GetService exposes the service for background tasks.
+func (h *Handler) GetService() *Service {
+	return h.service
 }
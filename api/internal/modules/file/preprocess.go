@@ -0,0 +1,199 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+)
+
+const defaultJPEGQuality = 90
+
+// NormalizeOptions controls how uploaded images are prepared before they are
+// stored and sent for inference.
+type NormalizeOptions struct {
+	// MaxDimension caps the longest side of the image in pixels.
+	// Zero disables downsizing.
+	MaxDimension int
+	// JPEGQuality is the quality used when re-encoding JPEG images (1-100).
+	JPEGQuality int
+}
+
+// ImageMetadata records how a normalized image relates to the uploaded one.
+// Original dimensions are measured after EXIF orientation is applied, so
+// dividing normalized coordinates by ScaleFactor yields original coordinates.
+type ImageMetadata struct {
+	Format         string
+	Orientation    int
+	OriginalWidth  int
+	OriginalHeight int
+	Width          int
+	Height         int
+	ScaleFactor    float64
+	SHA256         string
+}
+
+// decodeImage validates and fully decodes an image of the given format from
+// r, returning it with its EXIF orientation. The dimensions are read and
+// checked against limits before any pixel data is allocated. header holds
+// the leading bytes already peeked from r, which is where JPEG keeps its EXIF
+// block. TIFF stores its IFD at an arbitrary offset and its decoder needs
+// random access, so TIFF input is read into memory (bounded by MAX_FILE_SIZE)
+// before decoding.
+func decodeImage(r io.Reader, format string, header []byte, limits ImageLimits) (image.Image, int, error) {
+	decode, ok := decoders[format]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported image format %q", format)
+	}
+
+	orientation := defaultOrientation
+	switch format {
+	case "jpeg":
+		orientation = exifOrientation(header)
+	case "tiff":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, 0, decodeError(format, err)
+		}
+		if tiffEnd(data) < int64(len(data)) {
+			return nil, 0, errTrailingData(format)
+		}
+		orientation = parseTIFFOrientation(data)
+		r = bytes.NewReader(data)
+	}
+
+	// Keep what the config decoder consumes so the full decode can replay it.
+	var consumed bytes.Buffer
+	cfg, err := configDecoders[format](io.TeeReader(r, &consumed))
+	if err != nil {
+		return nil, 0, decodeError(format, err)
+	}
+	if err := limits.Check(cfg); err != nil {
+		return nil, 0, err
+	}
+
+	img, err := decode(io.MultiReader(&consumed, r))
+	if err != nil {
+		return nil, 0, decodeError(format, err)
+	}
+
+	return img, orientation, nil
+}
+
+// decodeError maps decoder failures to validation errors.
+func decodeError(format string, err error) error {
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return validationErr
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return newValidationError(http.StatusUnprocessableEntity, CodeTruncatedImage,
+			"%s image is truncated", format)
+	default:
+		return newValidationError(http.StatusUnprocessableEntity, CodeCorruptImage,
+			"%s image could not be decoded: %v", format, err)
+	}
+}
+
+// NormalizeImage applies the EXIF orientation to a decoded image, downsizes
+// it so its longest side fits opts.MaxDimension and picks the format it will
+// be stored in. The returned image is ready to be passed to encodeImage.
+func NormalizeImage(img image.Image, format string, orientation int, opts NormalizeOptions) (image.Image, *ImageMetadata) {
+	oriented := applyOrientation(img, orientation)
+	bounds := oriented.Bounds()
+
+	meta := &ImageMetadata{
+		Format:         outputFormat(format, img),
+		Orientation:    orientation,
+		OriginalWidth:  bounds.Dx(),
+		OriginalHeight: bounds.Dy(),
+		Width:          bounds.Dx(),
+		Height:         bounds.Dy(),
+		ScaleFactor:    1,
+	}
+
+	if longest := max(bounds.Dx(), bounds.Dy()); opts.MaxDimension > 0 && longest > opts.MaxDimension {
+		meta.ScaleFactor = float64(opts.MaxDimension) / float64(longest)
+		meta.Width = max(1, int(float64(bounds.Dx())*meta.ScaleFactor+0.5))
+		meta.Height = max(1, int(float64(bounds.Dy())*meta.ScaleFactor+0.5))
+
+		resized := image.NewRGBA(image.Rect(0, 0, meta.Width, meta.Height))
+		draw.BiLinear.Scale(resized, resized.Bounds(), oriented, bounds, draw.Src, nil)
+		oriented = resized
+	}
+
+	return oriented, meta
+}
+
+// encodeImage writes img to w in the given output format. Re-encoding also
+// strips any metadata embedded in the uploaded file.
+func encodeImage(w io.Writer, img image.Image, format string, opts NormalizeOptions) error {
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: opts.JPEGQuality})
+	} else {
+		err = png.Encode(w, img)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode %s image: %w", format, err)
+	}
+	return nil
+}
+
+// applyOrientation returns img transformed so that it is displayed upright
+// according to the given EXIF orientation value.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	// 8-bit RGB TIFFs already decode to RGBA; only convert the others, so
+	// orienting costs one copy of the image rather than two.
+	b := img.Bounds()
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(b)
+		draw.Draw(src, b, img, b.Min, draw.Src)
+	}
+
+	w, h := b.Dx(), b.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			si := src.PixOffset(b.Min.X+x, b.Min.Y+y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,70 @@
+package file
+
+import (
+	"fmt"
+
+	"govision/api/internal/modules/job"
+	"govision/api/services/rabbitmq"
+	"govision/pkg/outbox"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobRepository records uploaded jobs and the status of jobs whose upload
+// does not complete synchronously, such as images waiting in the spool.
+type JobRepository interface {
+	SaveJobStatus(jobID, imageURL, status string) error
+	EnqueueJob(msg rabbitmq.JobMessage) error
+}
+
+type postgresJobRepository struct {
+	db *gorm.DB
+}
+
+// NewJobRepository creates a new PostgreSQL-backed job repository.
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &postgresJobRepository{db: db}
+}
+
+// SaveJobStatus inserts the job or updates its status and image URL.
+func (r *postgresJobRepository) SaveJobStatus(jobID, imageURL, status string) error {
+	record := job.Job{
+		JobID:    jobID,
+		ImageURL: imageURL,
+		Status:   status,
+	}
+
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "image_url"}),
+	}).Create(&record).Error
+}
+
+// EnqueueJob records the job as queued together with the outbox event that
+// publishes msg, in one transaction: either both exist or neither does.
+// The event's dedupe key is the job ID, so enqueueing a job twice publishes
+// it once. msg is validated first, so the outbox never holds a message the
+// relay cannot encode.
+func (r *postgresJobRepository) EnqueueJob(msg rabbitmq.JobMessage) error {
+	msg.DedupeKey = msg.JobID
+	if _, err := msg.Encode(); err != nil {
+		return fmt.Errorf("invalid job message: %w", err)
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		record := job.Job{
+			JobID:    msg.JobID,
+			ImageURL: msg.ImageURL,
+			Status:   StatusQueued,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "job_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"status", "image_url"}),
+		}).Create(&record).Error; err != nil {
+			return err
+		}
+
+		return outbox.Enqueue(tx, outbox.EventJobCreated, msg.JobID, msg)
+	})
+}
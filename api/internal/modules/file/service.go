@@ -1,17 +1,25 @@
 package file
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
 	"io"
 	"log"
 	"math/rand"
-	"mime/multipart"
+	"net/http"
 	"os"
 	"time"
 
+	"govision/api/internal/modules/model"
 	"govision/api/services/rabbitmq"
+	"govision/api/services/spool"
 	storage "govision/api/services/storage"
 
 	"github.com/oklog/ulid/v2"
@@ -19,65 +27,370 @@ import (
 
 const HOST_IMAGE_URL = "https://api.imgbb.com/1/upload"
 
+// headerPeekSize is how much of the upload is buffered up front for format
+// detection and EXIF parsing. JPEG APP1 segments are capped at 64KB.
+const headerPeekSize = 128 * 1024
+
+// Upload job statuses reported to clients.
+const (
+	StatusQueued          = "queued"
+	StatusAwaitingStorage = "awaiting_storage"
+)
+
+var (
+	errStorageNotConfigured = errors.New("storage API key not configured")
+
+	// ErrStorageUnavailable is returned when the storage backend failed and
+	// the upload could not be spooled for a later retry.
+	ErrStorageUnavailable = errors.New("storage service unavailable, try again later")
+)
+
+// ModelResolver looks up the registered model an upload asks for.
+type ModelResolver interface {
+	Resolve(name string) (*model.Model, error)
+}
+
 type Service struct {
-	publisher rabbitmq.JobPublisher
+	jobs       JobRepository
+	models     ModelResolver
+	spool      *spool.Spool
+	config     Config
+	storageURL string
 }
 
-func NewService(p rabbitmq.JobPublisher) *Service {
-	return &Service{publisher: p}
+// NewService creates the upload service. Jobs are handed to the outbox and
+// published by its relay. uploadSpool may be nil, in which case storage
+// failures are returned to the client instead of spooled.
+func NewService(jobs JobRepository, models ModelResolver, uploadSpool *spool.Spool, cfg Config) *Service {
+	return &Service{jobs: jobs, models: models, spool: uploadSpool, config: cfg, storageURL: HOST_IMAGE_URL}
 }
 
-func (s *Service) ProcessUpload(ctx context.Context, fileHeader *multipart.FileHeader) (string, error) {
-	log.Println("[RUNNING] - Validating file size.")
-	if err := ValidateFileSize(fileHeader); err != nil {
-		return "", fmt.Errorf("invalid file size: %w", err)
+// ProcessUpload streams an uploaded image through validation, normalization
+// and hashing straight into the storage backend, then records the job and
+// its outbox event in one transaction.
+// The encoded bytes are never held in memory as a whole, but the pixels are,
+// and the only bound on them is the IMAGE_MAX_PIXELS check made on the header
+// before decoding. Peak heap per pixel, as measured by
+// BenchmarkProcessUpload: about 1.5 bytes for a JPEG (decoded as YCbCr), 4
+// for PNG and BMP, 9.5 for a JPEG with an EXIF orientation (converted to
+// RGBA, then rotated into a second RGBA image) and 16 for TIFF, which also
+// keeps its file in memory. Downsizing adds 4 bytes per output pixel. At the
+// default limit of 50M pixels a worst-case upload peaks around 450 MiB; BMP
+// and TIFF uploads stop well below it, as MAX_FILE_SIZE rejects them above
+// about 5M and 4M pixels. Lower IMAGE_MAX_PIXELS to lower the bound.
+// When the storage backend fails and a spool is configured, the encoded image
+// is kept on disk and the job is accepted as awaiting_storage.
+// Rejected uploads return a *ValidationError.
+func (s *Service) ProcessUpload(ctx context.Context, filename string, opts UploadOptions, src io.Reader) (*UploadResult, error) {
+	modelRef, err := s.resolveModel(opts.Model)
+	if err != nil {
+		return nil, err
+	}
+	jobOptions, err := ValidateUploadOptions(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	fileObject, err := fileHeader.Open()
+	img, format, orientation, err := readImage(filename, src, s.config.Limits)
 	if err != nil {
-		return "", fmt.Errorf("error reading file: %w", err)
+		return nil, err
+	}
+
+	normalized, meta := NormalizeImage(img, format, orientation, s.config.Normalize)
+	log.Printf("[RUNNING] - Image normalized: %s %dx%d -> %s %dx%d (orientation %d, scale %.4f)",
+		format, meta.OriginalWidth, meta.OriginalHeight, meta.Format, meta.Width, meta.Height, meta.Orientation, meta.ScaleFactor)
+
+	jobID := s.generateJobID()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(encodeImage(pw, normalized, meta.Format, s.config.Normalize))
+	}()
+
+	hasher := sha256.New()
+	storedName := jobID + "." + meta.Format
+
+	log.Println("[RUNNING] - Streaming image to storage service")
+	imageURL, err := s.uploadToStorage(ctx, storedName, io.TeeReader(pr, hasher))
+	if err != nil {
+		pr.CloseWithError(err)
+		if s.spool == nil || errors.Is(err, errStorageNotConfigured) || ctx.Err() != nil {
+			return nil, err
+		}
+		return s.spoolUpload(jobID, storedName, normalized, meta, modelRef, jobOptions, opts, err)
+	}
+	meta.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+
+	log.Println("[RUNNING] - Enqueueing job...")
+	msg := newJobMessage(jobID, imageURL, meta, modelRef, jobOptions, opts)
+	if err := s.jobs.EnqueueJob(msg); err != nil {
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
 	}
-	defer fileObject.Close()
+
+	log.Printf("[SUCCESS] - File image processed successfully!")
+	return &UploadResult{JobID: jobID, Status: StatusQueued, Model: opts.Model}, nil
+}
+
+// readImage validates and decodes an upload: the format is detected from the
+// leading bytes and must match the file extension, the dimensions are checked
+// against limits before decoding, and the rest of the upload is drained so
+// the trailer and size limit can be checked. It returns the decoded image,
+// its format and its EXIF orientation.
+func readImage(filename string, src io.Reader, limits ImageLimits) (image.Image, string, int, error) {
+	upload := newUploadReader(src, MAX_FILE_SIZE)
+	reader := bufio.NewReaderSize(upload, headerPeekSize)
 
 	log.Println("[RUNNING] - Validating file content...")
-	if err := ValidateFileContent(fileObject); err != nil {
-		return "", fmt.Errorf("invalid file content: %w", err)
+	header, err := reader.Peek(headerPeekSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", 0, decodeError("upload", err)
 	}
+	// Peek returns the reader's buffer, which is overwritten once decoding
+	// reads past it; the trailer check needs the original leading bytes.
+	header = bytes.Clone(header)
 
-	log.Println("[RUNNING] - Processing file data...")
-	buf := &bytes.Buffer{}
-	if _, err = io.Copy(buf, fileObject); err != nil {
-		return "", fmt.Errorf("error processing file image: %w", err)
+	format, err := ValidateFileContent(header)
+	if err != nil {
+		return nil, "", 0, err
 	}
 
-	log.Println("[RUNNING] - Sending image to storage service")
-	imageURL, err := s.uploadToStorage(buf)
+	if err := ValidateFileExtension(filename, format); err != nil {
+		return nil, "", 0, err
+	}
+
+	log.Println("[RUNNING] - Decoding image...")
+	img, orientation, err := decodeImage(reader, format, header, limits)
 	if err != nil {
-		return "", err
+		return nil, "", 0, err
 	}
 
-	jobID := s.generateJobID()
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, "", 0, decodeError(format, err)
+	}
+	if err := ValidateTrailer(format, header, upload); err != nil {
+		return nil, "", 0, err
+	}
+	return img, format, orientation, nil
+}
 
-	log.Println("[RUNNING] - Publishing job to queue...")
-	if err := s.publisher.Publish(ctx, jobID, imageURL); err != nil {
-		return "", fmt.Errorf("failed to enqueue job: %w", err)
+// resolveModel turns the requested model name into the reference carried by
+// the job message. An empty name leaves the choice to the worker.
+func (s *Service) resolveModel(name string) (*rabbitmq.ModelRef, error) {
+	if name == "" {
+		return nil, nil
 	}
 
-	log.Printf("[SUCCESS] - File image processed successfully!")
-	return jobID, nil
+	m, err := s.models.Resolve(name)
+	switch {
+	case errors.Is(err, model.ErrModelNotFound):
+		return nil, newValidationError(http.StatusUnprocessableEntity, CodeUnknownModel,
+			"model %q is not registered", name)
+	case errors.Is(err, model.ErrModelInactive):
+		return nil, newValidationError(http.StatusUnprocessableEntity, CodeModelInactive,
+			"model %q is not active", name)
+	case err != nil:
+		return nil, err
+	}
+
+	return &rabbitmq.ModelRef{
+		ID:       m.ID.String(),
+		Name:     m.Name,
+		Provider: m.Provider,
+		ModelID:  m.ModelID,
+		Endpoint: m.Endpoint,
+		Version:  m.Version,
+		TaskType: m.TaskType,
+		Options:  json.RawMessage(m.DefaultOptions),
+	}, nil
+}
+
+// spoolUpload writes the image to the spool after the storage backend
+// failed, and records the job as awaiting_storage. The image is encoded again
+// from memory rather than salvaged from the failed upload, so nothing is
+// written to disk for uploads that succeed.
+func (s *Service) spoolUpload(
+	jobID string,
+	storedName string,
+	img image.Image,
+	meta *ImageMetadata,
+	modelRef *rabbitmq.ModelRef,
+	options *rabbitmq.JobOptions,
+	opts UploadOptions,
+	storageErr error,
+) (*UploadResult, error) {
+	log.Printf("[WARNING] - Storage failed for job %s, spooling image: %v", jobID, storageErr)
+
+	spooled, err := s.spool.Begin(jobID, storedName)
+	if err != nil {
+		log.Printf("[ERROR] - Job %s could not be spooled: %v", jobID, err)
+		return nil, ErrStorageUnavailable
+	}
+
+	hasher := sha256.New()
+	if err := encodeImage(io.MultiWriter(hasher, spooled), img, meta.Format, s.config.Normalize); err != nil {
+		spooled.Discard()
+		log.Printf("[ERROR] - Job %s could not be spooled: %v", jobID, err)
+		return nil, ErrStorageUnavailable
+	}
+	meta.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+
+	if err := spooled.Commit(newJobMessage(jobID, "", meta, modelRef, options, opts)); err != nil {
+		log.Printf("[ERROR] - Job %s could not be spooled: %v", jobID, err)
+		return nil, ErrStorageUnavailable
+	}
+
+	if err := s.jobs.SaveJobStatus(jobID, "", StatusAwaitingStorage); err != nil {
+		// The spool entry is durable; the retrier records the job once stored.
+		log.Printf("[WARNING] - Job %s spooled but its status could not be saved: %v", jobID, err)
+	}
+
+	result := &UploadResult{JobID: jobID, Status: StatusAwaitingStorage}
+	if modelRef != nil {
+		result.Model = modelRef.Name
+	}
+	return result, nil
+}
+
+// RunSpoolRetrier periodically forwards spooled images to the storage backend
+// and enqueues their jobs until ctx is cancelled. It returns immediately when
+// no spool is configured.
+func (s *Service) RunSpoolRetrier(ctx context.Context) {
+	if s.spool == nil {
+		return
+	}
+
+	ticker := time.NewTicker(s.spool.RetryInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retrySpooled(ctx)
+		}
+	}
+}
+
+func (s *Service) retrySpooled(ctx context.Context) {
+	entries, err := s.spool.List()
+	if err != nil {
+		log.Printf("[SPOOL] - %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := s.forwardSpooled(ctx, &entry); err != nil {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			if updateErr := s.spool.Update(entry); updateErr != nil {
+				log.Printf("[SPOOL] - Job %s: failed to record retry: %v", entry.JobID, updateErr)
+			}
+			log.Printf("[SPOOL] - Job %s: retry %d failed: %v", entry.JobID, entry.Attempts, err)
+			continue
+		}
+
+		log.Printf("[SPOOL] - Job %s forwarded after %d retr(ies)", entry.JobID, entry.Attempts)
+	}
+}
+
+// forwardSpooled uploads a spooled image, queues its job and removes the
+// entry. The stored URL is recorded on the entry as soon as the upload
+// succeeds so a later failure to enqueue does not upload the image twice.
+func (s *Service) forwardSpooled(ctx context.Context, entry *spool.Entry) error {
+	var msg rabbitmq.JobMessage
+	if err := json.Unmarshal(entry.Payload, &msg); err != nil {
+		return fmt.Errorf("invalid spool payload: %w", err)
+	}
+
+	if entry.ImageURL == "" {
+		image, err := s.spool.Open(*entry)
+		if err != nil {
+			return fmt.Errorf("failed to open spooled image: %w", err)
+		}
+		imageURL, err := s.uploadToStorage(ctx, entry.Filename, image)
+		image.Close()
+		if err != nil {
+			return err
+		}
+
+		entry.ImageURL = imageURL
+		if err := s.spool.Update(*entry); err != nil {
+			log.Printf("[SPOOL] - Job %s: failed to record image URL: %v", entry.JobID, err)
+		}
+	}
+	msg.ImageURL = entry.ImageURL
+
+	if err := s.jobs.EnqueueJob(msg); err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	return s.spool.Remove(*entry)
+}
+
+// SpoolStatus reports the spool usage and the jobs waiting in it.
+func (s *Service) SpoolStatus() (*SpoolStatusResponse, error) {
+	if s.spool == nil {
+		return &SpoolStatusResponse{Enabled: false, Entries: []SpooledJob{}}, nil
+	}
+
+	entries, err := s.spool.List()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SpoolStatusResponse{
+		Enabled: true,
+		Stats:   s.spool.Stats(),
+		Entries: make([]SpooledJob, len(entries)),
+	}
+	for i, e := range entries {
+		response.Entries[i] = SpooledJob{
+			JobID:     e.JobID,
+			Size:      e.Size,
+			SpooledAt: e.SpooledAt,
+			Attempts:  e.Attempts,
+			LastError: e.LastError,
+			Stored:    e.ImageURL != "",
+		}
+	}
+	return response, nil
+}
+
+func newJobMessage(jobID, imageURL string, meta *ImageMetadata, modelRef *rabbitmq.ModelRef, options *rabbitmq.JobOptions, opts UploadOptions) rabbitmq.JobMessage {
+	return rabbitmq.JobMessage{
+		JobID:          jobID,
+		ImageURL:       imageURL,
+		ImageSHA256:    meta.SHA256,
+		OriginalWidth:  meta.OriginalWidth,
+		OriginalHeight: meta.OriginalHeight,
+		Width:          meta.Width,
+		Height:         meta.Height,
+		ScaleFactor:    meta.ScaleFactor,
+		Model:          modelRef,
+		Options:        options,
+		User:           opts.User,
+		Trace:          opts.Trace,
+		CreatedAt:      time.Now(),
+	}
 }
 
-func (s *Service) uploadToStorage(buf *bytes.Buffer) (string, error) {
+func (s *Service) uploadToStorage(ctx context.Context, filename string, body io.Reader) (string, error) {
 	storageService := storage.StorageService[ImgBBResponse]{
-		URL: HOST_IMAGE_URL,
+		URL: s.storageURL,
 	}
 
 	apiKey := os.Getenv("STORAGE_API_KEY")
 	if apiKey == "" {
-		return "", fmt.Errorf("storage API key not configured")
+		return "", errStorageNotConfigured
 	}
 
-	responseObj, err := storageService.GetImageUrl(buf, apiKey)
+	responseObj, err := storageService.GetImageUrl(ctx, filename, body, apiKey)
 	if err != nil {
 		return "", fmt.Errorf("storage service error: %w", err)
 	}
@@ -0,0 +1,381 @@
+package file
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"govision/api/services/rabbitmq"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+type discardJobRepository struct{}
+
+func (discardJobRepository) SaveJobStatus(jobID, imageURL, status string) error { return nil }
+func (discardJobRepository) EnqueueJob(msg rabbitmq.JobMessage) error           { return nil }
+
+// recordingJobRepository keeps the last job message enqueued.
+type recordingJobRepository struct {
+	discardJobRepository
+	msg *rabbitmq.JobMessage
+}
+
+func (r *recordingJobRepository) EnqueueJob(msg rabbitmq.JobMessage) error {
+	r.msg = &msg
+	return nil
+}
+
+// storedImage is an upload as the storage server received it.
+type storedImage struct {
+	filename string
+	data     []byte
+}
+
+// newStorageServer starts a storage server that keeps the uploaded images.
+func newStorageServer(t *testing.T) (*httptest.Server, *[]storedImage) {
+	t.Helper()
+	var (
+		mu     sync.Mutex
+		images []storedImage
+	)
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		images = append(images, storedImage{filename: header.Filename, data: data})
+		mu.Unlock()
+		w.Write([]byte(`{"data":{"url":"https://i.ibb.co/test/` + header.Filename + `"}}`))
+	}))
+	t.Cleanup(storage.Close)
+	t.Setenv("STORAGE_API_KEY", "test")
+	return storage, &images
+}
+
+func TestProcessUpload(t *testing.T) {
+	fixture := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("reading fixture: %v", err)
+		}
+		return data
+	}
+	translucent := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+	for i := range translucent.Pix {
+		translucent.Pix[i] = 128
+	}
+	var translucentTIFF bytes.Buffer
+	if err := tiff.Encode(&translucentTIFF, translucent, nil); err != nil {
+		t.Fatalf("encoding tiff: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		filename      string
+		data          []byte
+		maxDimension  int
+		format        string // stored format
+		width, height int    // stored dimensions
+		scale         float64
+	}{
+		{name: "jpeg kept", filename: "photo.jpg", data: fixture("gradient.jpg"), format: "jpeg", width: 8, height: 6},
+		{name: "png kept", filename: "photo.png", data: fixture("gradient.png"), format: "png", width: 8, height: 6},
+		{name: "webp to jpeg", filename: "photo.webp", data: fixture("solid.webp"), format: "jpeg", width: 8, height: 6},
+		{name: "bmp to jpeg", filename: "photo.bmp", data: fixture("gradient.bmp"), format: "jpeg", width: 8, height: 6},
+		{name: "tiff to jpeg", filename: "photo.tiff", data: fixture("gradient.tiff"), format: "jpeg", width: 8, height: 6},
+		{name: "translucent tiff to png", filename: "photo.tiff", data: translucentTIFF.Bytes(), format: "png", width: 8, height: 6},
+		{
+			name: "jpeg rotated by exif", filename: "photo.jpg", data: withOrientation(fixture("gradient.jpg"), 6),
+			format: "jpeg", width: 6, height: 8,
+		},
+		{
+			name: "tiff mirrored by its orientation tag", filename: "photo.tiff", data: tiffWithOrientation(t, fixture("gradient.tiff"), 2),
+			format: "jpeg", width: 8, height: 6,
+		},
+		{
+			name: "tiff rotated by its orientation tag", filename: "photo.tiff", data: tiffWithOrientation(t, fixture("gradient.tiff"), 8),
+			format: "jpeg", width: 6, height: 8,
+		},
+		{
+			name: "webp downsized", filename: "photo.webp", data: fixture("solid.webp"), maxDimension: 4,
+			format: "jpeg", width: 4, height: 3, scale: 0.5,
+		},
+		{
+			name: "jpeg rotated then downsized", filename: "photo.jpg", data: withOrientation(fixture("gradient.jpg"), 6), maxDimension: 4,
+			format: "jpeg", width: 3, height: 4, scale: 0.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, stored := newStorageServer(t)
+			jobs := &recordingJobRepository{}
+			service := NewService(jobs, nil, nil, Config{
+				Normalize: NormalizeOptions{MaxDimension: tt.maxDimension, JPEGQuality: defaultJPEGQuality},
+				Limits:    defaultImageLimits(),
+			})
+			service.storageURL = storage.URL
+
+			result, err := service.ProcessUpload(context.Background(), tt.filename, UploadOptions{}, bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("ProcessUpload() error = %v", err)
+			}
+			if len(*stored) != 1 {
+				t.Fatalf("%d image(s) stored, want 1", len(*stored))
+			}
+			upload := (*stored)[0]
+
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(upload.data))
+			if err != nil {
+				t.Fatalf("decoding the stored image: %v", err)
+			}
+			if format != tt.format || cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("stored %s %dx%d, want %s %dx%d", format, cfg.Width, cfg.Height, tt.format, tt.width, tt.height)
+			}
+			if want := result.JobID + "." + tt.format; upload.filename != want {
+				t.Errorf("stored as %q, want %q", upload.filename, want)
+			}
+
+			msg := jobs.msg
+			if msg == nil {
+				t.Fatal("no job enqueued")
+			}
+			scale := tt.scale
+			if scale == 0 {
+				scale = 1
+			}
+			if msg.Width != tt.width || msg.Height != tt.height || msg.ScaleFactor != scale {
+				t.Errorf("job image = %dx%d scaled by %g, want %dx%d scaled by %g",
+					msg.Width, msg.Height, msg.ScaleFactor, tt.width, tt.height, scale)
+			}
+			// Original dimensions are those of the upright upload.
+			wantWidth, wantHeight := int(float64(tt.width)/scale), int(float64(tt.height)/scale)
+			if msg.OriginalWidth != wantWidth || msg.OriginalHeight != wantHeight {
+				t.Errorf("job original size = %dx%d, want %dx%d", msg.OriginalWidth, msg.OriginalHeight, wantWidth, wantHeight)
+			}
+			if sum := sha256.Sum256(upload.data); msg.ImageSHA256 != hex.EncodeToString(sum[:]) {
+				t.Error("job image hash does not match the stored image")
+			}
+		})
+	}
+}
+
+// tiffWithOrientation returns a little-endian TIFF with an orientation tag
+// added: its first IFD is copied to the end of the file with the tag, and the
+// header pointed at the copy. Values outside the IFD keep their offsets.
+func tiffWithOrientation(t *testing.T, data []byte, orientation uint16) []byte {
+	t.Helper()
+	if string(data[:4]) != "II*\x00" {
+		t.Fatal("not a little-endian tiff")
+	}
+	order := binary.LittleEndian
+	ifd := order.Uint32(data[4:8])
+	count := int(order.Uint16(data[ifd:]))
+
+	tag := make([]byte, 12)
+	order.PutUint16(tag[0:], exifOrientationTag)
+	order.PutUint16(tag[2:], 3) // SHORT
+	order.PutUint32(tag[4:], 1)
+	order.PutUint16(tag[8:], orientation)
+
+	var entries [][]byte
+	for i := range count {
+		entries = append(entries, data[int(ifd)+2+i*12:int(ifd)+2+(i+1)*12])
+	}
+	at, _ := slices.BinarySearchFunc(entries, uint16(exifOrientationTag), func(e []byte, tag uint16) int {
+		return cmp.Compare(order.Uint16(e), tag)
+	})
+	entries = slices.Insert(entries, at, tag)
+
+	out := slices.Clone(data)
+	if len(out)%2 == 1 {
+		out = append(out, 0)
+	}
+	order.PutUint32(out[4:8], uint32(len(out)))
+	out = order.AppendUint16(out, uint16(len(entries)))
+	for _, e := range entries {
+		out = append(out, e...)
+	}
+	return order.AppendUint32(out, 0)
+}
+
+// BenchmarkProcessUpload runs full uploads against a storage server that
+// discards the body, so the allocations reported are those of validation,
+// decoding, normalization and encoding. Images go up to the default
+// IMAGE_MAX_PIXELS, the largest that passes the DecodeConfig check; inputs
+// whose encoding exceeds MAX_FILE_SIZE are rejected before decoding and
+// skipped. Besides time and allocations, it reports the peak live heap of an
+// upload, in total and per pixel:
+//
+//	go test -run '^$' -bench ProcessUpload ./api/internal/modules/file
+func BenchmarkProcessUpload(b *testing.B) {
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"data":{"url":"https://i.ibb.co/bench/image.jpg"}}`))
+	}))
+	defer storage.Close()
+	b.Setenv("STORAGE_API_KEY", "bench")
+
+	logOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(logOutput)
+
+	sizes := []struct {
+		name          string
+		width, height int
+	}{
+		{"2MP", 1920, 1080},
+		{"12MP", 4000, 3000},
+		{"limit", 10000, defaultMaxImagePixels / 10000},
+	}
+	for _, size := range sizes {
+		img := benchImage(size.width, size.height)
+		jpg := encodeBench(b, func(w io.Writer) error { return jpeg.Encode(w, img, nil) })
+		inputs := []struct {
+			filename string
+			data     []byte
+		}{
+			{"photo.jpg", jpg},
+			{"rotated.jpg", withOrientation(jpg, 6)},
+			{"photo.png", encodeBench(b, func(w io.Writer) error { return png.Encode(w, img) })},
+			{"photo.bmp", encodeBench(b, func(w io.Writer) error { return bmp.Encode(w, img) })},
+			{"photo.tiff", encodeBench(b, func(w io.Writer) error { return tiff.Encode(w, img, nil) })},
+		}
+		pixels := float64(size.width * size.height)
+
+		for _, input := range inputs {
+			b.Run(size.name+"/"+input.filename, func(b *testing.B) {
+				if len(input.data) > MAX_FILE_SIZE {
+					b.Skipf("%d bytes exceed MAX_FILE_SIZE", len(input.data))
+				}
+				service := NewService(discardJobRepository{}, nil, nil, Config{
+					Normalize: NormalizeOptions{JPEGQuality: defaultJPEGQuality},
+					Limits:    defaultImageLimits(),
+				})
+				service.storageURL = storage.URL
+
+				b.ReportAllocs()
+				b.SetBytes(int64(len(input.data)))
+				var peak uint64
+				for b.Loop() {
+					b.StopTimer()
+					runtime.GC()
+					sampler := startHeapSampler()
+					b.StartTimer()
+
+					_, err := service.ProcessUpload(context.Background(), input.filename, UploadOptions{}, bytes.NewReader(input.data))
+					peak = max(peak, sampler.stop())
+					if err != nil {
+						b.Fatalf("ProcessUpload() error = %v", err)
+					}
+				}
+				b.ReportMetric(float64(peak)/(1<<20), "peak-MiB")
+				b.ReportMetric(float64(peak)/pixels, "peak-B/px")
+			})
+		}
+	}
+}
+
+// heapSampler polls the live heap while an upload runs and records how far
+// it grew above the heap at its start.
+type heapSampler struct {
+	done chan struct{}
+	peak chan uint64
+}
+
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+func startHeapSampler() *heapSampler {
+	s := &heapSampler{done: make(chan struct{}), peak: make(chan uint64)}
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	base := sample[0].Value.Uint64()
+
+	go func() {
+		var peak uint64
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			metrics.Read(sample)
+			if heap := sample[0].Value.Uint64(); heap > base {
+				peak = max(peak, heap-base)
+			}
+			select {
+			case <-s.done:
+				s.peak <- peak
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// stop ends the sampling and returns the peak growth of the heap.
+func (s *heapSampler) stop() uint64 {
+	close(s.done)
+	return <-s.peak
+}
+
+func benchImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+func encodeBench(b *testing.B, encode func(io.Writer) error) []byte {
+	b.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		b.Fatalf("encoding input: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF APP1 segment carrying the given orientation
+// right after the SOI marker of a JPEG.
+func withOrientation(jpg []byte, orientation byte) []byte {
+	exif := []byte("Exif\x00\x00" +
+		"II*\x00\x08\x00\x00\x00" + // TIFF header, IFD0 at offset 8
+		"\x01\x00" + // one entry
+		"\x12\x01\x03\x00\x01\x00\x00\x00") // orientation, SHORT, count 1
+	exif = append(exif, orientation, 0, 0, 0)
+	exif = append(exif, 0, 0, 0, 0) // no next IFD
+
+	segment := []byte{0xFF, 0xE1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	out = append(out, exif...)
+	return append(out, jpg[2:]...)
+}
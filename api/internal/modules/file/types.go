@@ -1,15 +1,57 @@
 package file
 
 import (
-	"mime/multipart"
-)
+	"time"
 
-type UploadRequest struct {
-	File multipart.File
-}
+	"govision/api/services/spool"
+	"govision/pkg/envelope"
+)
 
 type ImgBBResponse struct {
 	Data struct {
 		URL string `json:"url"`
 	}
 }
+
+// UploadOptions are the form fields that may accompany an uploaded image.
+type UploadOptions struct {
+	// Model is the name of a registered model. Empty uses the worker default.
+	Model string
+	// TileSize enables tiled inference with tiles of this many pixels.
+	// Zero leaves the choice to the model's default options.
+	TileSize int
+	// TileOverlap is the fraction of a tile shared with its neighbours.
+	// Nil uses DefaultTileOverlap.
+	TileOverlap *float64
+	// Postprocess is a JSON list of post-processing steps replacing the
+	// model's default chain.
+	Postprocess string
+	// User is the authenticated uploader and Trace the trace context of the
+	// request. Both travel with the job message.
+	User  *envelope.User
+	Trace *envelope.Trace
+}
+
+// UploadResult is returned to the client once an upload is accepted.
+type UploadResult struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+	Model  string `json:"model,omitempty"`
+}
+
+// SpoolStatusResponse is the DTO returned by the GET /admin/spool endpoint.
+type SpoolStatusResponse struct {
+	Enabled bool         `json:"enabled"`
+	Stats   spool.Stats  `json:"stats"`
+	Entries []SpooledJob `json:"entries"`
+}
+
+// SpooledJob describes a job whose image is waiting in the spool.
+type SpooledJob struct {
+	JobID     string    `json:"job_id"`
+	Size      int64     `json:"size"`
+	SpooledAt time.Time `json:"spooled_at"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	Stored    bool      `json:"stored"`
+}
@@ -1,41 +1,226 @@
 package file
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
-	"mime/multipart"
+	"image"
+	"io"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"govision/api/services/rabbitmq"
+
+	"govision/pkg/postprocess"
 )
 
 const MAX_FILE_SIZE = 15 * 1024 * 1024
 
-func ValidateFileContent(src multipart.File) error {
-	buffer := make([]byte, 512)
-	if _, err := src.Read(buffer); err != nil {
-		return err
+// Bounds of the tiled inference options of an upload.
+const (
+	MinTileSize        = 128
+	MaxTileSize        = 4096
+	MaxTileOverlap     = 0.9
+	DefaultTileOverlap = 0.2
+)
+
+const (
+	defaultMaxImageWidth  = 16384
+	defaultMaxImageHeight = 16384
+	defaultMaxImagePixels = 50_000_000
+
+	// trailerSize is how many trailing bytes of an upload are kept to check
+	// that the file ends with its format's terminator.
+	trailerSize = 16
+)
+
+// Validation error codes returned to clients in the "code" field.
+const (
+	CodeFileRequired      = "file_required"
+	CodeFileTooLarge      = "file_too_large"
+	CodeUnsupportedFormat = "unsupported_format"
+	CodeExtensionMismatch = "extension_mismatch"
+	CodeCorruptImage      = "corrupt_image"
+	CodeTruncatedImage    = "truncated_image"
+	CodeTrailingData      = "trailing_data"
+	CodeUnknownModel      = "unknown_model"
+	CodeModelInactive     = "model_inactive"
+	CodeInvalidOption     = "invalid_option"
+	CodeDimensionsTooBig  = "dimensions_exceeded"
+)
+
+// ValidationError describes why an upload was rejected. Code is a stable
+// identifier for clients and Status the HTTP status the handler responds with.
+type ValidationError struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func newValidationError(status int, code, format string, args ...any) *ValidationError {
+	return &ValidationError{Code: code, Message: fmt.Sprintf(format, args...), Status: status}
+}
+
+var ErrFileTooLarge = newValidationError(http.StatusRequestEntityTooLarge, CodeFileTooLarge,
+	"The file is too big. Limit is %v", MAX_FILE_SIZE)
+
+// ImageLimits bounds the dimensions of an image before its pixels are
+// decoded, protecting the API from decompression bombs.
+type ImageLimits struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int
+}
+
+func defaultImageLimits() ImageLimits {
+	return ImageLimits{
+		MaxWidth:  defaultMaxImageWidth,
+		MaxHeight: defaultMaxImageHeight,
+		MaxPixels: defaultMaxImagePixels,
 	}
+}
 
-	contentType := http.DetectContentType(buffer)
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/png":  true,
-		"image/gif":  true,
+// Check rejects image configs that exceed any of the limits.
+func (l ImageLimits) Check(cfg image.Config) error {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return newValidationError(http.StatusUnprocessableEntity, CodeCorruptImage,
+			"image reports invalid dimensions %dx%d", cfg.Width, cfg.Height)
+	}
+	if cfg.Width > l.MaxWidth || cfg.Height > l.MaxHeight {
+		return newValidationError(http.StatusUnprocessableEntity, CodeDimensionsTooBig,
+			"image is %dx%d, limit is %dx%d", cfg.Width, cfg.Height, l.MaxWidth, l.MaxHeight)
 	}
+	if pixels := cfg.Width * cfg.Height; pixels > l.MaxPixels {
+		return newValidationError(http.StatusUnprocessableEntity, CodeDimensionsTooBig,
+			"image has %d pixels, limit is %d", pixels, l.MaxPixels)
+	}
+	return nil
+}
 
-	if !allowedTypes[contentType] {
-		return errors.New("Invalid file image.")
+// ValidateFileContent sniffs the magic bytes at the start of the upload and
+// returns the detected image format.
+func ValidateFileContent(header []byte) (string, error) {
+	format := detectImageFormat(header)
+	if format == "" {
+		return "", newValidationError(http.StatusUnsupportedMediaType, CodeUnsupportedFormat,
+			"file is not a JPEG, PNG, GIF, WebP, BMP or TIFF image")
 	}
+	return format, nil
+}
 
-	if _, err := src.Seek(0, 0); err != nil {
-		return err
+// ValidateFileExtension checks that the uploaded file name agrees with the
+// detected format. Names without an extension are accepted since browsers
+// send blobs and pasted images without one.
+func ValidateFileExtension(filename, format string) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" || slices.Contains(formatExtensions[format], ext) {
+		return nil
 	}
+	return newValidationError(http.StatusBadRequest, CodeExtensionMismatch,
+		"file extension %q does not match its %s content", ext, format)
+}
 
+// ValidateTrailer rejects files that carry data past the end of the image,
+// such as polyglots with an archive or script appended.
+func ValidateTrailer(format string, header []byte, upload *uploadReader) error {
+	if !hasValidTrailer(format, header, upload.tail, upload.read) {
+		return errTrailingData(format)
+	}
 	return nil
 }
 
-func ValidateFileSize(file *multipart.FileHeader) error {
-	if file.Size > MAX_FILE_SIZE {
-		return fmt.Errorf("The file is too big. Limit is %v", MAX_FILE_SIZE)
+func errTrailingData(format string) error {
+	return newValidationError(http.StatusUnprocessableEntity, CodeTrailingData,
+		"%s image has unexpected data after its end marker", format)
+}
+
+// ValidateUploadOptions checks the processing options of an upload and
+// returns the options to send with the job, or nil when none were given.
+func ValidateUploadOptions(opts UploadOptions) (*rabbitmq.JobOptions, error) {
+	tiling, err := validateTiling(opts)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	var chain json.RawMessage
+	if opts.Postprocess != "" {
+		steps, err := postprocess.Parse(json.RawMessage(opts.Postprocess))
+		if err != nil {
+			return nil, newValidationError(http.StatusUnprocessableEntity, CodeInvalidOption, "%v", err)
+		}
+		if len(steps) > 0 {
+			if chain, err = json.Marshal(steps); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if tiling == nil && chain == nil {
+		return nil, nil
+	}
+	return &rabbitmq.JobOptions{Tiling: tiling, Postprocess: chain}, nil
+}
+
+func validateTiling(opts UploadOptions) (*rabbitmq.TilingOptions, error) {
+	if opts.TileSize == 0 {
+		if opts.TileOverlap != nil {
+			return nil, newValidationError(http.StatusUnprocessableEntity, CodeInvalidOption,
+				"tile_overlap requires tile_size")
+		}
+		return nil, nil
+	}
+
+	if opts.TileSize < MinTileSize || opts.TileSize > MaxTileSize {
+		return nil, newValidationError(http.StatusUnprocessableEntity, CodeInvalidOption,
+			"tile_size must be between %d and %d", MinTileSize, MaxTileSize)
+	}
+
+	overlap := DefaultTileOverlap
+	if opts.TileOverlap != nil {
+		overlap = *opts.TileOverlap
+	}
+	if overlap < 0 || overlap > MaxTileOverlap {
+		return nil, newValidationError(http.StatusUnprocessableEntity, CodeInvalidOption,
+			"tile_overlap must be between 0 and %g", MaxTileOverlap)
+	}
+
+	return &rabbitmq.TilingOptions{TileSize: opts.TileSize, Overlap: overlap}, nil
+}
+
+// uploadReader wraps the raw upload stream. It fails with ErrFileTooLarge once
+// more than limit bytes have been read, so oversized uploads are rejected
+// while streaming instead of after being buffered, and it remembers the last
+// bytes of the stream for trailer validation.
+type uploadReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+	tail  []byte
+}
+
+func newUploadReader(r io.Reader, limit int64) *uploadReader {
+	return &uploadReader{r: r, limit: limit, tail: make([]byte, 0, trailerSize)}
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.read += int64(n)
+	if u.read > u.limit {
+		return n, ErrFileTooLarge
+	}
+
+	if n >= trailerSize {
+		u.tail = append(u.tail[:0], p[n-trailerSize:n]...)
+	} else if n > 0 {
+		u.tail = append(u.tail, p[:n]...)
+		if len(u.tail) > trailerSize {
+			u.tail = append(u.tail[:0], u.tail[len(u.tail)-trailerSize:]...)
+		}
+	}
+	return n, err
 }
@@ -0,0 +1,48 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job event types recorded in a job's history.
+const (
+	EventDeadLettered = "dead_lettered"
+	EventRequeued     = "requeued"
+	EventReplayed     = "replayed"
+	EventPurged       = "purged"
+)
+
+// Event represents the job_events table: one entry of a job's history.
+// Actor is who caused it, "worker" or the email of an administrator.
+type Event struct {
+	ID        int64     `gorm:"column:id;primaryKey" json:"id"`
+	JobID     string    `gorm:"column:job_id;type:varchar(255);not null" json:"job_id"`
+	EventType string    `gorm:"column:event_type;type:varchar(50);not null" json:"event_type"`
+	Actor     string    `gorm:"column:actor;type:varchar(255);not null;default:''" json:"actor"`
+	Detail    string    `gorm:"column:detail;type:jsonb;not null;default:'{}'" json:"-"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (Event) TableName() string {
+	return "job_events"
+}
+
+// RecordEvent appends an event to the history of jobID within tx.
+func RecordEvent(tx *gorm.DB, jobID, eventType, actor string, detail any) error {
+	encoded, err := json.Marshal(detail)
+	if err != nil {
+		return fmt.Errorf("failed to encode event detail: %w", err)
+	}
+
+	return tx.Create(&Event{
+		JobID:     jobID,
+		EventType: eventType,
+		Actor:     actor,
+		Detail:    string(encoded),
+		CreatedAt: time.Now(),
+	}).Error
+}
@@ -47,3 +47,25 @@ func (h *Handler) GetJobStatus(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, result)
 }
+
+// GetJobEvents handles GET /admin/jobs/:id/events and returns the history of
+// a job.
+func (h *Handler) GetJobEvents(c echo.Context) error {
+	log.Println("[STARTING] - calling route /admin/jobs/:id/events...")
+
+	jobID := strings.TrimSpace(c.Param("id"))
+	if jobID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Job ID is required",
+		})
+	}
+
+	events, err := h.service.GetJobEvents(jobID)
+	if err != nil {
+		log.Printf("[ERROR] - %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"message": "Error retrieving job events",
+		})
+	}
+	return c.JSON(http.StatusOK, events)
+}
@@ -5,6 +5,8 @@ import "gorm.io/gorm"
 // JobRepository defines the contract for querying job data.
 type JobRepository interface {
 	FindByJobID(jobID string) (*Job, error)
+	// Events returns the history of a job, oldest first.
+	Events(jobID string) ([]Event, error)
 }
 
 // postgresJobRepository implements JobRepository
@@ -23,6 +25,9 @@ func (r *postgresJobRepository) FindByJobID(jobID string) (*Job, error) {
 	var job Job
 	err := r.db.
 		Preload("Predictions").
+		Preload("Classifications", func(db *gorm.DB) *gorm.DB {
+			return db.Order("confidence DESC")
+		}).
 		Where("job_id = ?", jobID).
 		First(&job).Error
 
@@ -32,3 +37,11 @@ func (r *postgresJobRepository) FindByJobID(jobID string) (*Job, error) {
 
 	return &job, nil
 }
+
+func (r *postgresJobRepository) Events(jobID string) ([]Event, error) {
+	var events []Event
+	if err := r.db.Where("job_id = ?", jobID).Order("created_at, id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
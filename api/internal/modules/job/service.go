@@ -1,6 +1,7 @@
 package job
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 
@@ -38,6 +39,90 @@ func (s *Service) GetJobStatus(jobID string) (*JobStatusResponse, error) {
 		Predictions: job.Predictions,
 	}
 
+	if job.ImageWidth > 0 && job.ImageHeight > 0 {
+		response.Image = &ImageInfo{
+			Width:          job.ImageWidth,
+			Height:         job.ImageHeight,
+			OriginalWidth:  job.OriginalWidth,
+			OriginalHeight: job.OriginalHeight,
+			ScaleFactor:    job.ScaleFactor,
+		}
+	}
+
+	if job.ModelName != "" {
+		response.Model = &ModelInfo{Name: job.ModelName, Version: job.ModelVersion}
+	}
+
+	if job.TaskType != "" && job.TaskType != "object_detection" {
+		response.TaskType = job.TaskType
+	}
+
+	if len(job.Classifications) > 0 {
+		response.Classification = newClassificationResult(job)
+	}
+
+	if job.Outputs != "" && job.Outputs != "{}" {
+		response.Outputs = json.RawMessage(job.Outputs)
+	}
+
+	if job.CachedFrom != nil {
+		response.CachedFrom = *job.CachedFrom
+	}
+
+	if job.WorkerID != nil {
+		response.WorkerID = *job.WorkerID
+	}
+
+	if job.Postprocess != "" && job.Postprocess != "[]" {
+		response.Postprocess = json.RawMessage(job.Postprocess)
+	}
+
 	log.Printf("[SUCCESS] - Job %s found with status: %s", jobID, job.Status)
 	return response, nil
 }
+
+// newClassificationResult builds the classification DTO from the stored
+// class scores, which the repository returns highest confidence first.
+func newClassificationResult(job *Job) *ClassificationResult {
+	top := job.Classifications[0]
+	result := &ClassificationResult{
+		MultiLabel: job.TaskType == "multi_label_classification",
+		Top:        top.Class,
+		Confidence: top.Confidence,
+		Predicted:  []string{},
+		Classes:    make([]ClassScore, len(job.Classifications)),
+	}
+
+	for i, c := range job.Classifications {
+		result.Classes[i] = ClassScore{Class: c.Class, ClassID: c.ClassID, Confidence: c.Confidence}
+		if c.Predicted {
+			result.Predicted = append(result.Predicted, c.Class)
+		}
+	}
+	return result
+}
+
+// GetJobEvents returns the history of a job: dead-lettering, replays and
+// purges, oldest first.
+func (s *Service) GetJobEvents(jobID string) ([]EventResponse, error) {
+	events, err := s.repo.Events(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying job events: %w", err)
+	}
+
+	response := make([]EventResponse, len(events))
+	for i, e := range events {
+		response[i] = ToEventResponse(e)
+	}
+	return response, nil
+}
+
+// ToEventResponse converts an event to its DTO.
+func ToEventResponse(e Event) EventResponse {
+	return EventResponse{
+		EventType: e.EventType,
+		Actor:     e.Actor,
+		Detail:    json.RawMessage(e.Detail),
+		CreatedAt: e.CreatedAt,
+	}
+}
@@ -1,6 +1,9 @@
 package job
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,13 +12,27 @@ import (
 
 // Job represents the jobs table in the database.
 type Job struct {
-	ID          uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	JobID       string       `gorm:"column:job_id;type:varchar(255);uniqueIndex;not null" json:"job_id"`
-	ImageURL    string       `gorm:"column:image_url;type:text;not null" json:"image_url"`
-	Status      string       `gorm:"column:status;type:varchar(50);not null;default:'completed'" json:"status"`
-	ProcessedAt time.Time    `gorm:"column:processed_at;not null;default:now()" json:"processed_at"`
-	CreatedAt   time.Time    `gorm:"column:created_at;not null;default:now()" json:"created_at"`
-	Predictions []Prediction `gorm:"foreignKey:JobID;references:JobID" json:"predictions,omitempty"`
+	ID             uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	JobID          string       `gorm:"column:job_id;type:varchar(255);uniqueIndex;not null" json:"job_id"`
+	ImageURL       string       `gorm:"column:image_url;type:text;not null" json:"image_url"`
+	Status         string       `gorm:"column:status;type:varchar(50);not null;default:'completed'" json:"status"`
+	ImageWidth     int          `gorm:"column:image_width;type:integer;not null;default:0" json:"image_width"`
+	ImageHeight    int          `gorm:"column:image_height;type:integer;not null;default:0" json:"image_height"`
+	OriginalWidth  int          `gorm:"column:original_width;type:integer;not null;default:0" json:"original_width"`
+	OriginalHeight int          `gorm:"column:original_height;type:integer;not null;default:0" json:"original_height"`
+	ScaleFactor    float64      `gorm:"column:scale_factor;type:double precision;not null;default:1" json:"scale_factor"`
+	Outputs        string       `gorm:"column:outputs;type:jsonb;not null;default:'{}'" json:"outputs"`
+	ModelName      string       `gorm:"column:model_name;type:varchar(100);not null;default:''" json:"model_name"`
+	ModelVersion   string       `gorm:"column:model_version;type:varchar(100);not null;default:''" json:"model_version"`
+	TaskType       string       `gorm:"column:task_type;type:varchar(50);not null;default:'object_detection'" json:"task_type"`
+	Postprocess    string       `gorm:"column:postprocess;type:jsonb;not null;default:'[]'" json:"postprocess"`
+	CachedFrom     *string      `gorm:"column:cached_from;type:varchar(255)" json:"cached_from,omitempty"`
+	WorkerID       *string      `gorm:"column:worker_id;type:varchar(255)" json:"worker_id,omitempty"`
+	ProcessedAt    time.Time    `gorm:"column:processed_at;not null;default:now()" json:"processed_at"`
+	CreatedAt      time.Time    `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+	Predictions    []Prediction `gorm:"foreignKey:JobID;references:JobID" json:"predictions,omitempty"`
+
+	Classifications []Classification `gorm:"foreignKey:JobID;references:JobID" json:"classifications,omitempty"`
 }
 
 func (Job) TableName() string {
@@ -30,22 +47,45 @@ func (j *Job) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// Prediction represents the predictions table in the database.
+// Prediction represents the predictions table in the database. Points holds
+// the polygon of segmentation models and Keypoints the landmarks of pose
+// models, both as JSON arrays in image pixels; they are omitted for plain
+// boxes.
 type Prediction struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	JobID       string    `gorm:"column:job_id;type:varchar(255);not null;index:idx_predictions_job_id" json:"job_id"`
+	X           float64   `gorm:"column:x;type:double precision;not null" json:"x"`
+	Y           float64   `gorm:"column:y;type:double precision;not null" json:"y"`
+	Width       float64   `gorm:"column:width;type:double precision;not null" json:"width"`
+	Height      float64   `gorm:"column:height;type:double precision;not null" json:"height"`
+	Confidence  float64   `gorm:"column:confidence;type:double precision;not null" json:"confidence"`
+	Class       string    `gorm:"column:class;type:varchar(255);not null" json:"class"`
+	ClassID     int       `gorm:"column:class_id;type:integer;not null" json:"class_id"`
+	DetectionID string    `gorm:"column:detection_id;type:varchar(255);not null;default:''" json:"detection_id,omitempty"`
+	ParentID    string    `gorm:"column:parent_id;type:varchar(255);not null;default:''" json:"parent_id,omitempty"`
+	Points      JSON      `gorm:"column:points;type:jsonb" json:"points,omitempty"`
+	Keypoints   JSON      `gorm:"column:keypoints;type:jsonb" json:"keypoints,omitempty"`
+	CreatedAt   time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (Prediction) TableName() string {
+	return "predictions"
+}
+
+// Classification represents the classifications table in the database: the
+// score of one class for a classification job.
+type Classification struct {
 	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	JobID      string    `gorm:"column:job_id;type:varchar(255);not null;index:idx_predictions_job_id" json:"job_id"`
-	X          float64   `gorm:"column:x;type:double precision;not null" json:"x"`
-	Y          float64   `gorm:"column:y;type:double precision;not null" json:"y"`
-	Width      float64   `gorm:"column:width;type:double precision;not null" json:"width"`
-	Height     float64   `gorm:"column:height;type:double precision;not null" json:"height"`
-	Confidence float64   `gorm:"column:confidence;type:double precision;not null" json:"confidence"`
+	JobID      string    `gorm:"column:job_id;type:varchar(255);not null;index:idx_classifications_job_id" json:"job_id"`
 	Class      string    `gorm:"column:class;type:varchar(255);not null" json:"class"`
 	ClassID    int       `gorm:"column:class_id;type:integer;not null" json:"class_id"`
+	Confidence float64   `gorm:"column:confidence;type:double precision;not null" json:"confidence"`
+	Predicted  bool      `gorm:"column:predicted;not null;default:false" json:"predicted"`
 	CreatedAt  time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
 }
 
-func (Prediction) TableName() string {
-	return "predictions"
+func (Classification) TableName() string {
+	return "classifications"
 }
 
 // JobStatusResponse is the DTO returned by the GET /jobs/:id endpoint.
@@ -55,5 +95,99 @@ type JobStatusResponse struct {
 	Status      string       `json:"status"`
 	ProcessedAt time.Time    `json:"processed_at"`
 	CreatedAt   time.Time    `json:"created_at"`
+	Image       *ImageInfo   `json:"image,omitempty"`
+	Model       *ModelInfo   `json:"model,omitempty"`
+	TaskType    string       `json:"task_type,omitempty"`
 	Predictions []Prediction `json:"predictions,omitempty"`
+
+	Classification *ClassificationResult `json:"classification,omitempty"`
+	Outputs        json.RawMessage       `json:"outputs,omitempty"`
+	// Postprocess lists the post-processing steps the worker applied, with
+	// the number of predictions before and after each.
+	Postprocess json.RawMessage `json:"postprocess,omitempty"`
+	// CachedFrom is the job whose inference result was reused when the
+	// worker served this job from its result cache.
+	CachedFrom string `json:"cached_from,omitempty"`
+	// WorkerID is the worker process that started or completed the job.
+	WorkerID string `json:"worker_id,omitempty"`
+}
+
+// ImageInfo describes the stored image the predictions refer to and the
+// upright original it was derived from. Dividing prediction coordinates by
+// ScaleFactor maps them onto the original image.
+type ImageInfo struct {
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	OriginalWidth  int     `json:"original_width"`
+	OriginalHeight int     `json:"original_height"`
+	ScaleFactor    float64 `json:"scale_factor"`
+}
+
+// ClassificationResult is the whole-image result of a classification job.
+// Top is the highest scoring class. Predicted lists the classes the model
+// assigned: exactly Top for single-label models, any number of classes
+// (possibly none) for multi-label models. Classes holds every class score,
+// highest confidence first.
+type ClassificationResult struct {
+	MultiLabel bool         `json:"multi_label"`
+	Top        string       `json:"top"`
+	Confidence float64      `json:"confidence"`
+	Predicted  []string     `json:"predicted_classes"`
+	Classes    []ClassScore `json:"classes"`
+}
+
+// ClassScore is the confidence of one class.
+type ClassScore struct {
+	Class      string  `json:"class"`
+	ClassID    int     `json:"class_id"`
+	Confidence float64 `json:"confidence"`
+}
+
+// ModelInfo identifies the model and version that produced the predictions.
+type ModelInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// JSON holds a raw JSON document stored in a nullable JSONB column. It is
+// written to API responses as is, and omitted when NULL.
+type JSON string
+
+// Value implements driver.Valuer.
+func (j JSON) Value() (driver.Value, error) {
+	if j == "" {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan implements sql.Scanner.
+func (j *JSON) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*j = ""
+	case string:
+		*j = JSON(v)
+	case []byte:
+		*j = JSON(v)
+	default:
+		return errors.New("unsupported JSON column type")
+	}
+	return nil
+}
+
+// MarshalJSON writes the stored document as is.
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// EventResponse is the DTO of an entry of a job's history.
+type EventResponse struct {
+	EventType string          `json:"event_type"`
+	Actor     string          `json:"actor"`
+	Detail    json.RawMessage `json:"detail"`
+	CreatedAt time.Time       `json:"created_at"`
 }
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"govision/pkg/endpoint"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Handler exposes the admin endpoints of the model registry.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new model handler with its dependencies.
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{service: NewService(NewModelRepository(db), endpoint.AllowlistFromEnv())}
+}
+
+// ListModels handles GET /admin/models.
+func (h *Handler) ListModels(c echo.Context) error {
+	log.Println("[STARTING] - calling route /admin/models...")
+
+	models, err := h.service.List()
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models)
+}
+
+// GetModel handles GET /admin/models/:name.
+func (h *Handler) GetModel(c echo.Context) error {
+	log.Println("[STARTING] - calling route /admin/models/:name...")
+
+	m, err := h.service.Get(strings.TrimSpace(c.Param("name")))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, m)
+}
+
+// CreateModel handles POST /admin/models.
+func (h *Handler) CreateModel(c echo.Context) error {
+	log.Println("[STARTING] - calling route POST /admin/models...")
+
+	var req CreateModelRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Invalid payload",
+		})
+	}
+
+	m, err := h.service.Create(req)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, m)
+}
+
+// UpdateModel handles PATCH /admin/models/:name.
+func (h *Handler) UpdateModel(c echo.Context) error {
+	log.Println("[STARTING] - calling route PATCH /admin/models/:name...")
+
+	var req UpdateModelRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Invalid payload",
+		})
+	}
+
+	m, err := h.service.Update(strings.TrimSpace(c.Param("name")), req)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, m)
+}
+
+// DeleteModel handles DELETE /admin/models/:name.
+func (h *Handler) DeleteModel(c echo.Context) error {
+	log.Println("[STARTING] - calling route DELETE /admin/models/:name...")
+
+	if err := h.service.Delete(strings.TrimSpace(c.Param("name"))); err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// InvalidateCache handles DELETE /admin/cache. The optional "model" query
+// parameter restricts the invalidation to one model.
+func (h *Handler) InvalidateCache(c echo.Context) error {
+	log.Println("[STARTING] - calling route DELETE /admin/cache...")
+
+	result, err := h.service.InvalidateCache(strings.TrimSpace(c.QueryParam("model")))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetService exposes the service to other modules, such as uploads
+// resolving the model they should use.
+func (h *Handler) GetService() *Service {
+	return h.service
+}
+
+func (h *Handler) errorResponse(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	message := "Error processing model request"
+
+	switch {
+	case errors.Is(err, ErrModelNotFound):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, ErrModelExists):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, ErrInvalidModel):
+		status, message = http.StatusBadRequest, err.Error()
+	default:
+		log.Printf("[ERROR] - %v", err)
+	}
+
+	return c.JSON(status, map[string]string{
+		"message": message,
+	})
+}
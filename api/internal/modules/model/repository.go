@@ -0,0 +1,64 @@
+package model
+
+import "gorm.io/gorm"
+
+// ModelRepository defines the contract for model registry persistence.
+type ModelRepository interface {
+	List() ([]Model, error)
+	FindByName(name string) (*Model, error)
+	Create(m *Model) error
+	Save(m *Model) error
+	Delete(name string) error
+	// DeleteCachedResults removes the worker's cached inference results of
+	// a model, or of every model when modelName is empty.
+	DeleteCachedResults(modelName string) (int64, error)
+}
+
+type postgresModelRepository struct {
+	db *gorm.DB
+}
+
+// NewModelRepository creates a new PostgreSQL-backed model repository.
+func NewModelRepository(db *gorm.DB) ModelRepository {
+	return &postgresModelRepository{db: db}
+}
+
+func (r *postgresModelRepository) List() ([]Model, error) {
+	var models []Model
+	if err := r.db.Order("name").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+func (r *postgresModelRepository) FindByName(name string) (*Model, error) {
+	var m Model
+	if err := r.db.Where("name = ?", name).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *postgresModelRepository) Create(m *Model) error {
+	return r.db.Create(m).Error
+}
+
+func (r *postgresModelRepository) Save(m *Model) error {
+	return r.db.Save(m).Error
+}
+
+func (r *postgresModelRepository) Delete(name string) error {
+	result := r.db.Where("name = ?", name).Delete(&Model{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *postgresModelRepository) DeleteCachedResults(modelName string) (int64, error) {
+	result := r.db.Exec(`DELETE FROM inference_cache WHERE ? = '' OR model_name = ?`, modelName, modelName)
+	return result.RowsAffected, result.Error
+}
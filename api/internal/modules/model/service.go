@@ -0,0 +1,277 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"govision/pkg/endpoint"
+	"govision/pkg/postprocess"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrModelNotFound = errors.New("model not found")
+	ErrModelExists   = errors.New("model already exists")
+	ErrModelInactive = errors.New("model is not active")
+	ErrInvalidModel  = errors.New("invalid model")
+)
+
+var modelNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,99}$`)
+
+// Service handles the business logic of the model registry.
+type Service struct {
+	repo      ModelRepository
+	endpoints endpoint.Allowlist
+}
+
+// NewService creates a new model service. Registered endpoints must be on
+// the endpoints allowlist.
+func NewService(repo ModelRepository, endpoints endpoint.Allowlist) *Service {
+	return &Service{repo: repo, endpoints: endpoints}
+}
+
+// List returns every registered model.
+func (s *Service) List() ([]ModelResponse, error) {
+	models, err := s.repo.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing models: %w", err)
+	}
+
+	response := make([]ModelResponse, len(models))
+	for i := range models {
+		response[i] = toResponse(&models[i])
+	}
+	return response, nil
+}
+
+// Get returns a model by name.
+func (s *Service) Get(name string) (*ModelResponse, error) {
+	m, err := s.find(name)
+	if err != nil {
+		return nil, err
+	}
+	response := toResponse(m)
+	return &response, nil
+}
+
+// Resolve returns the active model uploads should be processed with.
+func (s *Service) Resolve(name string) (*Model, error) {
+	m, err := s.find(name)
+	if err != nil {
+		return nil, err
+	}
+	if !m.Active {
+		return nil, fmt.Errorf("%w: %s", ErrModelInactive, name)
+	}
+	return m, nil
+}
+
+// Create registers a new model.
+func (s *Service) Create(req CreateModelRequest) (*ModelResponse, error) {
+	m := &Model{
+		Name:     strings.TrimSpace(req.Name),
+		Provider: strings.TrimSpace(req.Provider),
+		ModelID:  strings.TrimSpace(req.ModelID),
+		Endpoint: strings.TrimSpace(req.Endpoint),
+		Version:  strings.TrimSpace(req.Version),
+		TaskType: strings.TrimSpace(req.TaskType),
+		Active:   req.Active == nil || *req.Active,
+	}
+
+	options, err := normalizeOptions(req.DefaultOptions)
+	if err != nil {
+		return nil, err
+	}
+	m.DefaultOptions = options
+
+	if err := validateModel(m, s.endpoints); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.FindByName(m.Name); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrModelExists, m.Name)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("error querying model: %w", err)
+	}
+
+	if err := s.repo.Create(m); err != nil {
+		return nil, fmt.Errorf("error creating model: %w", err)
+	}
+
+	log.Printf("[SUCCESS] - Model %s registered (%s %s, version %q)", m.Name, m.Provider, m.ModelID, m.Version)
+	response := toResponse(m)
+	return &response, nil
+}
+
+// Update changes the fields present in req.
+func (s *Service) Update(name string, req UpdateModelRequest) (*ModelResponse, error) {
+	m, err := s.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Provider != nil {
+		m.Provider = strings.TrimSpace(*req.Provider)
+	}
+	if req.ModelID != nil {
+		m.ModelID = strings.TrimSpace(*req.ModelID)
+	}
+	if req.Endpoint != nil {
+		m.Endpoint = strings.TrimSpace(*req.Endpoint)
+	}
+	if req.Version != nil {
+		m.Version = strings.TrimSpace(*req.Version)
+	}
+	if req.TaskType != nil {
+		m.TaskType = strings.TrimSpace(*req.TaskType)
+	}
+	if req.DefaultOptions != nil {
+		options, err := normalizeOptions(req.DefaultOptions)
+		if err != nil {
+			return nil, err
+		}
+		m.DefaultOptions = options
+	}
+	if req.Active != nil {
+		m.Active = *req.Active
+	}
+
+	if err := validateModel(m, s.endpoints); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Save(m); err != nil {
+		return nil, fmt.Errorf("error updating model: %w", err)
+	}
+
+	log.Printf("[SUCCESS] - Model %s updated", m.Name)
+	response := toResponse(m)
+	return &response, nil
+}
+
+// Delete removes a model from the registry. Jobs already processed keep the
+// model name and version they recorded.
+func (s *Service) Delete(name string) error {
+	if err := s.repo.Delete(name); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s", ErrModelNotFound, name)
+		}
+		return fmt.Errorf("error deleting model: %w", err)
+	}
+
+	log.Printf("[SUCCESS] - Model %s deleted", name)
+	return nil
+}
+
+// InvalidateCache deletes the cached inference results of the named model,
+// or of every model when name is empty, so the next identical uploads are
+// run through the model again. name is matched against the model name
+// recorded by the worker, which is the model ID for the default model.
+func (s *Service) InvalidateCache(name string) (*CacheInvalidationResponse, error) {
+	deleted, err := s.repo.DeleteCachedResults(name)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting cached results: %w", err)
+	}
+
+	log.Printf("[SUCCESS] - Invalidated %d cached result(s) (model %q)", deleted, name)
+	return &CacheInvalidationResponse{Model: name, Deleted: deleted}, nil
+}
+
+func (s *Service) find(name string) (*Model, error) {
+	m, err := s.repo.FindByName(name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrModelNotFound, name)
+		}
+		return nil, fmt.Errorf("error querying model: %w", err)
+	}
+	return m, nil
+}
+
+func validateModel(m *Model, endpoints endpoint.Allowlist) error {
+	if !modelNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("%w: name must be 1-100 lowercase letters, digits, '.', '_' or '-'", ErrInvalidModel)
+	}
+
+	// Workers send the account's API key to the endpoint.
+	if m.Endpoint != "" {
+		if err := endpoints.Check(m.Endpoint); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidModel, err)
+		}
+	}
+
+	switch m.Provider {
+	case ProviderRoboflow, ProviderFake:
+	case ProviderWorkflow:
+		if parts := strings.Split(m.ModelID, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("%w: workflow model_id must be <workspace>/<workflow>", ErrInvalidModel)
+		}
+	default:
+		return fmt.Errorf("%w: unknown provider %q", ErrInvalidModel, m.Provider)
+	}
+
+	if m.TaskType == "" {
+		m.TaskType = TaskObjectDetection
+	}
+	switch m.TaskType {
+	case TaskObjectDetection, TaskInstanceSegmentation, TaskKeypointDetection,
+		TaskClassification, TaskMultiLabelClassification:
+	default:
+		return fmt.Errorf("%w: unknown task_type %q", ErrInvalidModel, m.TaskType)
+	}
+
+	if m.ModelID == "" && m.Provider != ProviderFake {
+		return fmt.Errorf("%w: model_id is required", ErrInvalidModel)
+	}
+	return nil
+}
+
+// normalizeOptions checks that options is a JSON object and returns its
+// compact form, defaulting to an empty object.
+func normalizeOptions(options json.RawMessage) (string, error) {
+	if len(options) == 0 || string(options) == "null" {
+		return "{}", nil
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(options, &decoded); err != nil {
+		return "", fmt.Errorf("%w: default_options must be a JSON object", ErrInvalidModel)
+	}
+
+	if chain, ok := decoded["postprocess"]; ok {
+		raw, err := json.Marshal(chain)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidModel, err)
+		}
+		if _, err := postprocess.Parse(raw); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidModel, err)
+		}
+	}
+
+	compact, err := json.Marshal(decoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidModel, err)
+	}
+	return string(compact), nil
+}
+
+func toResponse(m *Model) ModelResponse {
+	return ModelResponse{
+		ID:             m.ID,
+		Name:           m.Name,
+		Provider:       m.Provider,
+		ModelID:        m.ModelID,
+		Endpoint:       m.Endpoint,
+		Version:        m.Version,
+		TaskType:       m.TaskType,
+		DefaultOptions: json.RawMessage(m.DefaultOptions),
+		Active:         m.Active,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Supported model providers. They match the worker's detector backends.
+const (
+	ProviderRoboflow = "roboflow"
+	ProviderWorkflow = "roboflow_workflow"
+	ProviderFake     = "fake"
+)
+
+// Supported model task types. They decide how the worker parses responses.
+const (
+	TaskObjectDetection          = "object_detection"
+	TaskInstanceSegmentation     = "instance_segmentation"
+	TaskKeypointDetection        = "keypoint_detection"
+	TaskClassification           = "classification"
+	TaskMultiLabelClassification = "multi_label_classification"
+)
+
+// Model represents the models table in the database.
+type Model struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Name           string    `gorm:"column:name;type:varchar(100);uniqueIndex;not null" json:"name"`
+	Provider       string    `gorm:"column:provider;type:varchar(50);not null" json:"provider"`
+	ModelID        string    `gorm:"column:model_id;type:text;not null" json:"model_id"`
+	Endpoint       string    `gorm:"column:endpoint;type:text;not null;default:''" json:"endpoint"`
+	Version        string    `gorm:"column:version;type:varchar(100);not null;default:''" json:"version"`
+	TaskType       string    `gorm:"column:task_type;type:varchar(50);not null;default:'object_detection'" json:"task_type"`
+	DefaultOptions string    `gorm:"column:default_options;type:jsonb;not null;default:'{}'" json:"default_options"`
+	Active         bool      `gorm:"column:active;not null;default:true" json:"active"`
+	CreatedAt      time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at;not null;default:now()" json:"updated_at"`
+}
+
+func (Model) TableName() string {
+	return "models"
+}
+
+// BeforeCreate generates a UUID before inserting a new Model.
+func (m *Model) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// ModelResponse is the DTO returned by the admin model endpoints.
+type ModelResponse struct {
+	ID             uuid.UUID       `json:"id"`
+	Name           string          `json:"name"`
+	Provider       string          `json:"provider"`
+	ModelID        string          `json:"model_id"`
+	Endpoint       string          `json:"endpoint,omitempty"`
+	Version        string          `json:"version,omitempty"`
+	TaskType       string          `json:"task_type"`
+	DefaultOptions json.RawMessage `json:"default_options"`
+	Active         bool            `json:"active"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// CreateModelRequest is the payload for registering a model.
+type CreateModelRequest struct {
+	Name           string          `json:"name"`
+	Provider       string          `json:"provider"`
+	ModelID        string          `json:"model_id"`
+	Endpoint       string          `json:"endpoint"`
+	Version        string          `json:"version"`
+	TaskType       string          `json:"task_type"`
+	DefaultOptions json.RawMessage `json:"default_options"`
+	Active         *bool           `json:"active"`
+}
+
+// UpdateModelRequest is the payload for changing a model. Omitted fields are
+// left unchanged.
+type UpdateModelRequest struct {
+	Provider       *string         `json:"provider"`
+	ModelID        *string         `json:"model_id"`
+	Endpoint       *string         `json:"endpoint"`
+	Version        *string         `json:"version"`
+	TaskType       *string         `json:"task_type"`
+	DefaultOptions json.RawMessage `json:"default_options"`
+	Active         *bool           `json:"active"`
+}
+
+// CacheInvalidationResponse is the DTO returned by DELETE /admin/cache.
+type CacheInvalidationResponse struct {
+	Model   string `json:"model,omitempty"`
+	Deleted int64  `json:"deleted"`
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Handler exposes the admin endpoints of the worker registry.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new worker handler with its dependencies.
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{service: NewService(NewWorkerRepository(db))}
+}
+
+// ListWorkers handles GET /admin/workers. The optional "status" query
+// parameter keeps only live, stopped or dead workers.
+func (h *Handler) ListWorkers(c echo.Context) error {
+	log.Println("[STARTING] - calling route /admin/workers...")
+
+	workers, err := h.service.List(strings.TrimSpace(c.QueryParam("status")))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, workers)
+}
+
+// GetWorker handles GET /admin/workers/:id.
+func (h *Handler) GetWorker(c echo.Context) error {
+	log.Println("[STARTING] - calling route /admin/workers/:id...")
+
+	w, err := h.service.Get(strings.TrimSpace(c.Param("id")))
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, w)
+}
+
+func (h *Handler) errorResponse(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	message := "Error processing worker request"
+
+	switch {
+	case errors.Is(err, ErrWorkerNotFound):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, ErrInvalidStatus):
+		status, message = http.StatusBadRequest, err.Error()
+	default:
+		log.Printf("[ERROR] - %v", err)
+	}
+
+	return c.JSON(status, map[string]string{
+		"message": message,
+	})
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// statusExpr derives the state of a worker from its heartbeats, with the
+// database clock the workers record them with.
+var statusExpr = fmt.Sprintf(`CASE
+	WHEN stopped_at IS NOT NULL THEN '%s'
+	WHEN last_heartbeat_at >= now() - make_interval(secs => heartbeat_interval * %d) THEN '%s'
+	ELSE '%s' END`, StatusStopped, missedHeartbeats, StatusLive, StatusDead)
+
+// WorkerRepository defines the contract for reading the worker registry.
+type WorkerRepository interface {
+	// List returns the workers in status, or every worker when status is
+	// empty.
+	List(status string) ([]Worker, error)
+	FindByID(id string) (*Worker, error)
+}
+
+type postgresWorkerRepository struct {
+	db *gorm.DB
+}
+
+// NewWorkerRepository creates a new PostgreSQL-backed worker repository.
+func NewWorkerRepository(db *gorm.DB) WorkerRepository {
+	return &postgresWorkerRepository{db: db}
+}
+
+func (r *postgresWorkerRepository) List(status string) ([]Worker, error) {
+	var workers []Worker
+	query := r.selectWorkers()
+	if status != "" {
+		query = query.Where(statusExpr+" = ?", status)
+	}
+	if err := query.Order("started_at DESC").Find(&workers).Error; err != nil {
+		return nil, err
+	}
+	return workers, nil
+}
+
+func (r *postgresWorkerRepository) FindByID(id string) (*Worker, error) {
+	var w Worker
+	if err := r.selectWorkers().Where("id = ?", id).First(&w).Error; err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *postgresWorkerRepository) selectWorkers() *gorm.DB {
+	return r.db.Model(&Worker{}).Select("*, " + statusExpr + " AS status")
+}
@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWorkerNotFound = errors.New("worker not found")
+	ErrInvalidStatus  = errors.New("invalid status")
+)
+
+// Service handles queries of the worker registry.
+type Service struct {
+	repo WorkerRepository
+}
+
+// NewService creates a new worker service.
+func NewService(repo WorkerRepository) *Service {
+	return &Service{repo: repo}
+}
+
+// List returns the registered workers, most recently started first,
+// optionally only those in status.
+func (s *Service) List(status string) ([]WorkerResponse, error) {
+	switch status {
+	case "", StatusLive, StatusStopped, StatusDead:
+	default:
+		return nil, fmt.Errorf("%w: must be %q, %q or %q", ErrInvalidStatus, StatusLive, StatusStopped, StatusDead)
+	}
+
+	workers, err := s.repo.List(status)
+	if err != nil {
+		return nil, fmt.Errorf("error listing workers: %w", err)
+	}
+
+	response := make([]WorkerResponse, len(workers))
+	for i := range workers {
+		response[i] = toResponse(&workers[i])
+	}
+	return response, nil
+}
+
+// Get returns a worker by ID.
+func (s *Service) Get(id string) (*WorkerResponse, error) {
+	w, err := s.repo.FindByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrWorkerNotFound, id)
+		}
+		return nil, fmt.Errorf("error querying worker: %w", err)
+	}
+	response := toResponse(w)
+	return &response, nil
+}
+
+func toResponse(w *Worker) WorkerResponse {
+	return WorkerResponse{
+		ID:                w.ID,
+		Status:            w.Status,
+		Hostname:          w.Hostname,
+		Version:           w.Version,
+		Models:            json.RawMessage(w.Models),
+		Concurrency:       w.Concurrency,
+		HeartbeatInterval: w.HeartbeatInterval,
+		CurrentJobs:       json.RawMessage(w.CurrentJobs),
+		Processed:         w.Processed,
+		Failed:            w.Failed,
+		StartedAt:         w.StartedAt,
+		LastHeartbeatAt:   w.LastHeartbeatAt,
+		StoppedAt:         w.StoppedAt,
+	}
+}
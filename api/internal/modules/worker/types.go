@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Worker states, derived from the last heartbeat.
+const (
+	// StatusLive workers sent a heartbeat within three intervals.
+	StatusLive = "live"
+	// StatusStopped workers shut down and deregistered.
+	StatusStopped = "stopped"
+	// StatusDead workers stopped sending heartbeats without deregistering.
+	StatusDead = "dead"
+)
+
+// missedHeartbeats is the number of heartbeat intervals after which a
+// worker that did not deregister is considered dead.
+const missedHeartbeats = 3
+
+// Worker represents the workers table, maintained by the worker processes.
+// Status is computed when the row is read. HeartbeatInterval is in seconds.
+type Worker struct {
+	ID                string     `gorm:"column:id;type:varchar(255);primaryKey"`
+	Hostname          string     `gorm:"column:hostname;type:varchar(255);not null;default:''"`
+	Version           string     `gorm:"column:version;type:varchar(100);not null;default:''"`
+	Models            string     `gorm:"column:models;type:jsonb;not null;default:'[]'"`
+	Concurrency       int        `gorm:"column:concurrency;not null;default:0"`
+	HeartbeatInterval int        `gorm:"column:heartbeat_interval;not null;default:0"`
+	CurrentJobs       string     `gorm:"column:current_jobs;type:jsonb;not null;default:'[]'"`
+	Processed         int64      `gorm:"column:processed;not null;default:0"`
+	Failed            int64      `gorm:"column:failed;not null;default:0"`
+	StartedAt         time.Time  `gorm:"column:started_at;not null;default:now()"`
+	LastHeartbeatAt   time.Time  `gorm:"column:last_heartbeat_at;not null;default:now()"`
+	StoppedAt         *time.Time `gorm:"column:stopped_at"`
+	Status            string     `gorm:"column:status;->"`
+}
+
+func (Worker) TableName() string {
+	return "workers"
+}
+
+// WorkerResponse is the DTO returned by the admin worker endpoints.
+type WorkerResponse struct {
+	ID                string          `json:"id"`
+	Status            string          `json:"status"`
+	Hostname          string          `json:"hostname"`
+	Version           string          `json:"version"`
+	Models            json.RawMessage `json:"models"`
+	Concurrency       int             `json:"concurrency"`
+	HeartbeatInterval int             `json:"heartbeat_interval_seconds"`
+	CurrentJobs       json.RawMessage `json:"current_jobs"`
+	Processed         int64           `json:"processed"`
+	Failed            int64           `json:"failed"`
+	StartedAt         time.Time       `json:"started_at"`
+	LastHeartbeatAt   time.Time       `json:"last_heartbeat_at"`
+	StoppedAt         *time.Time      `json:"stopped_at,omitempty"`
+}
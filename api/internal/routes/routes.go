@@ -3,13 +3,16 @@ package routes
 import (
 	"govision/api/internal/middlewares"
 	"govision/api/internal/modules/auth"
+	"govision/api/internal/modules/deadletter"
 	"govision/api/internal/modules/file"
 	"govision/api/internal/modules/job"
+	"govision/api/internal/modules/model"
+	"govision/api/internal/modules/worker"
 
 	"github.com/labstack/echo/v4"
 )
 
-func InitRoutes(e *echo.Echo, fileHandler *file.Handler, jobHandler *job.Handler, authHandler *auth.Handler) {
+func InitRoutes(e *echo.Echo, fileHandler *file.Handler, jobHandler *job.Handler, authHandler *auth.Handler, modelHandler *model.Handler, deadLetterHandler *deadletter.Handler, workerHandler *worker.Handler) {
 	v1 := e.Group("/v1")
 
 	// Public routes
@@ -21,4 +24,23 @@ func InitRoutes(e *echo.Echo, fileHandler *file.Handler, jobHandler *job.Handler
 	protected := v1.Group("", middlewares.JWTAuth(authHandler.GetService()))
 	protected.POST("/image/upload", fileHandler.UploadFileImage)
 	protected.GET("/jobs/:id", jobHandler.GetJobStatus)
+
+	// Admin routes
+	admin := protected.Group("/admin", middlewares.AdminOnly(authHandler.GetService()))
+	admin.GET("/spool", fileHandler.GetSpoolStatus)
+	admin.GET("/models", modelHandler.ListModels)
+	admin.POST("/models", modelHandler.CreateModel)
+	admin.GET("/models/:name", modelHandler.GetModel)
+	admin.PATCH("/models/:name", modelHandler.UpdateModel)
+	admin.DELETE("/models/:name", modelHandler.DeleteModel)
+	admin.DELETE("/cache", modelHandler.InvalidateCache)
+	admin.GET("/dead-letters", deadLetterHandler.ListDeadLetters)
+	admin.POST("/dead-letters/replay", deadLetterHandler.ReplayDeadLetters)
+	admin.DELETE("/dead-letters", deadLetterHandler.PurgeDeadLetters)
+	admin.GET("/dead-letters/:job_id", deadLetterHandler.GetDeadLetter)
+	admin.POST("/dead-letters/:job_id/replay", deadLetterHandler.ReplayDeadLetter)
+	admin.DELETE("/dead-letters/:job_id", deadLetterHandler.PurgeDeadLetter)
+	admin.GET("/jobs/:id/events", jobHandler.GetJobEvents)
+	admin.GET("/workers", workerHandler.ListWorkers)
+	admin.GET("/workers/:id", workerHandler.GetWorker)
 }
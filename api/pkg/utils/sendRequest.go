@@ -1,33 +1,78 @@
 package utils
 
 import (
-	"bytes"
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"time"
 )
 
-func SendRequest(url string, imageBytes *bytes.Buffer, apiKey string) (error, []byte) {
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
+const (
+	// requestTimeout bounds a whole upload, body and response included.
+	requestTimeout = 5 * time.Minute
+	// responseHeaderTimeout bounds the wait for the response once the body
+	// has been sent.
+	responseHeaderTimeout = time.Minute
+)
 
-	encodedImage := base64.StdEncoding.EncodeToString(imageBytes.Bytes())
-	if err := writer.WriteField("image", encodedImage); err != nil {
-		return fmt.Errorf("Error writing image field: %v", err), nil
-	}
+// errRequestDone stops the body of a request that SendRequest gave up on.
+var errRequestDone = errors.New("request finished")
+
+var uploadClient = &http.Client{
+	Timeout: requestTimeout,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          16,
+	},
+}
+
+// SendRequest uploads image as the "image" file field of a multipart request.
+// The body is produced through an io.Pipe while the request is being sent, so
+// the image is never buffered or base64-encoded in memory. image is no longer
+// read once SendRequest returns, whatever the outcome, so the caller may
+// reuse or close it.
+func SendRequest(ctx context.Context, url string, filename string, image io.Reader, apiKey string) (error, []byte) {
+	bodyReader, bodyWriter := io.Pipe()
+	writer := multipart.NewWriter(bodyWriter)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		part, err := writer.CreateFormFile("image", filename)
+		if err != nil {
+			bodyWriter.CloseWithError(fmt.Errorf("Error writing image field: %v", err))
+			return
+		}
+		if _, err := io.Copy(part, image); err != nil {
+			bodyWriter.CloseWithError(fmt.Errorf("Error streaming image: %v", err))
+			return
+		}
+		bodyWriter.CloseWithError(writer.Close())
+	}()
+	defer func() {
+		// The transport may return before it has read the whole body, on
+		// errors or early responses: fail the pending writes and wait for the
+		// copy to stop.
+		bodyReader.CloseWithError(errRequestDone)
+		<-done
+	}()
 
-	writer.Close()
 	fullURL := fmt.Sprintf("%s?key=%s", url, apiKey)
-	req, err := http.NewRequest("POST", fullURL, &requestBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", fullURL, bodyReader)
 	if err != nil {
 		return fmt.Errorf("Error setting request to %v, %v", url, err), nil
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := uploadClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("Error sending request to %v: %v", url, err), nil
 	}
@@ -0,0 +1,318 @@
+// Package outbox implements the relay of the transactional outbox of job
+// messages: events are recorded in the same transaction as the job they
+// announce (see govision/pkg/outbox), and the relay publishes them to the job
+// queue afterwards. A crash between the two steps only delays publishing; it
+// cannot lose a job or queue one that was never saved.
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"govision/api/services/rabbitmq"
+	"govision/pkg/envelope"
+	"govision/pkg/queue"
+
+	events "govision/pkg/outbox"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 50
+	defaultMaxBackoff   = 5 * time.Minute
+	defaultRetention    = 24 * time.Hour
+	defaultLease        = time.Minute
+
+	purgeInterval = time.Hour
+	// recordTimeout bounds the transaction recording the outcome of a
+	// batch, which still runs once shutdown has begun.
+	recordTimeout = 5 * time.Second
+)
+
+// Config controls the relay.
+type Config struct {
+	// PollInterval is how often pending events are looked for.
+	PollInterval time.Duration
+	// BatchSize is the number of events claimed at a time.
+	BatchSize int
+	// Lease is how long claimed events are hidden from other relays while
+	// they are published. It should exceed the time to publish a batch.
+	Lease time.Duration
+	// MaxBackoff caps the delay before a failed event is retried.
+	MaxBackoff time.Duration
+	// Retention is how long sent events are kept before being deleted.
+	Retention time.Duration
+	// MessageVersion is the envelope version job messages are published
+	// in. It stays at version 1 until every worker reads version 2.
+	MessageVersion int
+}
+
+// ConfigFromEnv reads OUTBOX_POLL_INTERVAL, OUTBOX_BATCH_SIZE,
+// OUTBOX_LEASE, OUTBOX_MAX_BACKOFF, OUTBOX_RETENTION and
+// OUTBOX_MESSAGE_VERSION (1 or 2, default 1).
+func ConfigFromEnv() Config {
+	cfg := Config{
+		PollInterval:   defaultPollInterval,
+		BatchSize:      defaultBatchSize,
+		Lease:          defaultLease,
+		MaxBackoff:     defaultMaxBackoff,
+		Retention:      defaultRetention,
+		MessageVersion: envelope.VersionLegacy,
+	}
+
+	if raw := os.Getenv("OUTBOX_POLL_INTERVAL"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.PollInterval = value
+		} else {
+			log.Printf("[WARNING] - Invalid OUTBOX_POLL_INTERVAL %q, using %s", raw, defaultPollInterval)
+		}
+	}
+	if raw := os.Getenv("OUTBOX_BATCH_SIZE"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			cfg.BatchSize = value
+		} else {
+			log.Printf("[WARNING] - Invalid OUTBOX_BATCH_SIZE %q, using %d", raw, defaultBatchSize)
+		}
+	}
+	if raw := os.Getenv("OUTBOX_LEASE"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.Lease = value
+		} else {
+			log.Printf("[WARNING] - Invalid OUTBOX_LEASE %q, using %s", raw, defaultLease)
+		}
+	}
+	if raw := os.Getenv("OUTBOX_MAX_BACKOFF"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.MaxBackoff = value
+		} else {
+			log.Printf("[WARNING] - Invalid OUTBOX_MAX_BACKOFF %q, using %s", raw, defaultMaxBackoff)
+		}
+	}
+	if raw := os.Getenv("OUTBOX_RETENTION"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.Retention = value
+		} else {
+			log.Printf("[WARNING] - Invalid OUTBOX_RETENTION %q, using %s", raw, defaultRetention)
+		}
+	}
+	if raw := os.Getenv("OUTBOX_MESSAGE_VERSION"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && (value == envelope.VersionLegacy || value == envelope.Version) {
+			cfg.MessageVersion = value
+		} else {
+			log.Printf("[WARNING] - Invalid OUTBOX_MESSAGE_VERSION %q, using %d", raw, envelope.VersionLegacy)
+		}
+	}
+
+	return cfg
+}
+
+// Relay publishes pending outbox events. Delivery is at least once: an
+// event is marked sent only after the queue accepted it, so a crash in
+// between publishes it again. Several API instances may run a relay; events
+// are claimed with SKIP LOCKED and hidden for the lease by pushing back their
+// available_at, so no row lock or transaction is held while publishing. An
+// event whose lease runs out before its outcome is recorded is claimed again;
+// its attempt count fences off the outcome of the earlier claim.
+type Relay struct {
+	db        *gorm.DB
+	publisher queue.Publisher
+	cfg       Config
+}
+
+// NewRelay creates a relay publishing events recorded in db.
+func NewRelay(db *gorm.DB, publisher queue.Publisher, cfg Config) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = defaultLease
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultRetention
+	}
+	if cfg.MessageVersion == 0 {
+		cfg.MessageVersion = envelope.VersionLegacy
+	}
+	return &Relay{db: db, publisher: publisher, cfg: cfg}
+}
+
+// Run publishes pending events every PollInterval and deletes sent events
+// past their retention, until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	lastPurge := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			claimed, err := r.relayBatch(ctx)
+			if err != nil {
+				log.Printf("[OUTBOX] - Relay failed: %v", err)
+				break
+			}
+			if claimed < r.cfg.BatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPurge) >= purgeInterval {
+			lastPurge = time.Now()
+			r.purge()
+		}
+	}
+}
+
+// relayBatch claims up to BatchSize due events, publishes them and records
+// the outcome, returning how many events were claimed.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	batch, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Publishing stops on shutdown; the events left are made available
+	// again right away instead of waiting for their lease to run out.
+	outcomes := make([]error, len(batch))
+	published := 0
+	for i, event := range batch {
+		if ctx.Err() != nil {
+			break
+		}
+		outcomes[i] = r.publish(ctx, event)
+		published++
+	}
+
+	return len(batch), r.record(ctx, batch[:published], outcomes[:published], batch[published:])
+}
+
+// claim hides up to BatchSize due events for the lease and returns them,
+// their attempt count incremented.
+func (r *Relay) claim(ctx context.Context) ([]events.Event, error) {
+	now := time.Now()
+	var batch []events.Event
+	if err := r.db.WithContext(ctx).Raw(`
+		UPDATE outbox
+		SET attempts = attempts + 1, available_at = ?
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND available_at <= ?
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(r.cfg.Lease), now, r.cfg.BatchSize,
+	).Scan(&batch).Error; err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(batch, func(a, b events.Event) int { return cmp.Compare(a.ID, b.ID) })
+	return batch, nil
+}
+
+// record marks published events as sent, schedules the retry of failed ones
+// and releases the unpublished ones, in one transaction. Updates only apply
+// while the event still carries the attempt count of this claim.
+func (r *Relay) record(ctx context.Context, published []events.Event, outcomes []error, unpublished []events.Event) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		for i, event := range published {
+			updates := map[string]any{"sent_at": now}
+			if err := outcomes[i]; err != nil {
+				retryAt := now.Add(r.backoff(event.Attempts))
+				log.Printf("[OUTBOX] - Event %d (%s %s) failed, attempt %d, retrying at %s: %v",
+					event.ID, event.EventType, event.DedupeKey, event.Attempts, retryAt.Format(time.RFC3339), err)
+				updates = map[string]any{"last_error": err.Error(), "available_at": retryAt}
+			}
+
+			result := tx.Model(&events.Event{}).Where("id = ? AND attempts = ?", event.ID, event.Attempts).Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				log.Printf("[OUTBOX] - Event %d (%s %s): lease expired before its outcome was recorded, it was claimed again",
+					event.ID, event.EventType, event.DedupeKey)
+			}
+		}
+
+		for _, event := range unpublished {
+			if err := tx.Model(&events.Event{}).Where("id = ? AND attempts = ?", event.ID, event.Attempts).
+				Update("available_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Relay) publish(ctx context.Context, event events.Event) error {
+	switch event.EventType {
+	case events.EventJobCreated:
+		var msg rabbitmq.JobMessage
+		if err := json.Unmarshal([]byte(event.Payload), &msg); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+		msg.DedupeKey = event.DedupeKey
+		if msg.CreatedAt.IsZero() {
+			// Recorded before messages carried their creation time.
+			msg.CreatedAt = event.CreatedAt
+		}
+		body, err := msg.EncodeVersion(r.cfg.MessageVersion)
+		if err != nil {
+			return err
+		}
+		return r.publisher.Publish(ctx, msg.JobID, body)
+	case events.EventJobReplayed:
+		var replay events.ReplayPayload
+		if err := json.Unmarshal([]byte(event.Payload), &replay); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+		return r.publisher.Publish(ctx, replay.JobID, replay.Body)
+	default:
+		return fmt.Errorf("unknown event type %q", event.EventType)
+	}
+}
+
+// backoff doubles the retry delay with every attempt, up to MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.cfg.PollInterval
+	for i := 1; i < attempts && delay < r.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.cfg.MaxBackoff)
+}
+
+func (r *Relay) purge() {
+	result := r.db.Where("sent_at < ?", time.Now().Add(-r.cfg.Retention)).Delete(&events.Event{})
+	if result.Error != nil {
+		log.Printf("[OUTBOX] - Purge failed: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[OUTBOX] - Purged %d sent event(s)", result.RowsAffected)
+	}
+}
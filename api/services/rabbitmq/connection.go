@@ -1,42 +1,74 @@
 package rabbitmq
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
 
-	amqp "github.com/rabbitmq/amqp091-go"
+	"govision/pkg/amqpconn"
 )
 
-func PublisherFactory() JobPublisher {
-	log.Println("[INIT] - Connecting to RabbitMQ")
-	rabbitmq_url := os.Getenv("RABBITMQ_URL")
-	queue := os.Getenv("RABBITMQ_QUEUE")
+const (
+	defaultPublishWait    = 2 * time.Second
+	defaultConfirmTimeout = 5 * time.Second
+)
 
-	if rabbitmq_url == "" || queue == "" {
-		log.Fatalf("[ERROR] - Environment variables not found.")
-	}
+// PublisherConfig describes where and how jobs are published.
+type PublisherConfig struct {
+	Queue string
+	// Wait is how long a publication waits for a lost broker to come back
+	// before failing with ErrUnavailable.
+	Wait time.Duration
+	// ConfirmTimeout is how long a publication waits for the broker to
+	// confirm the message before failing with ErrNotConfirmed.
+	ConfirmTimeout time.Duration
+}
 
-	conn, err := amqp.Dial(os.Getenv("RABBITMQ_URL"))
-	if err != nil {
-		log.Fatalf("[ERROR] - Error connecting to RabbittMQ: %v", err)
+// PublisherConfigFromEnv reads RABBITMQ_QUEUE, RABBITMQ_PUBLISH_WAIT and
+// RABBITMQ_CONFIRM_TIMEOUT.
+func PublisherConfigFromEnv() PublisherConfig {
+	cfg := PublisherConfig{
+		Queue:          os.Getenv("RABBITMQ_QUEUE"),
+		Wait:           defaultPublishWait,
+		ConfirmTimeout: defaultConfirmTimeout,
 	}
 
-	ch, err := conn.Channel()
-	if err != nil {
-		log.Fatalf("[ERROR] - Error getting RabbitMQ channel: %v", err)
+	if raw := os.Getenv("RABBITMQ_PUBLISH_WAIT"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value >= 0 {
+			cfg.Wait = value
+		} else {
+			log.Printf("[WARNING] - Invalid RABBITMQ_PUBLISH_WAIT %q, using %s", raw, defaultPublishWait)
+		}
+	}
+	if raw := os.Getenv("RABBITMQ_CONFIRM_TIMEOUT"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.ConfirmTimeout = value
+		} else {
+			log.Printf("[WARNING] - Invalid RABBITMQ_CONFIRM_TIMEOUT %q, using %s", raw, defaultConfirmTimeout)
+		}
 	}
 
-	_, err = ch.QueueDeclare(
-		queue,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		log.Fatalf("[ERROR] - Error declaring queue: %v", err)
+	return cfg
+}
+
+// PublisherFactory starts a connection manager for RABBITMQ_URL and returns
+// a publisher to the named queue. The broker does not have to be up: the
+// connection is established in the background and re-established whenever
+// it is lost, and publishing fails with ErrUnavailable meanwhile. Close the
+// publisher to close the connection.
+func PublisherFactory(queueName string) *RabbitMQPublisher {
+	log.Println("[INIT] - Connecting to RabbitMQ")
+	connConfig := amqpconn.ConfigFromEnv()
+	cfg := PublisherConfigFromEnv()
+	cfg.Queue = queueName
+
+	if connConfig.URL == "" || cfg.Queue == "" {
+		log.Fatalf("[ERROR] - Environment variables not found.")
 	}
 
-	return NewRabbitMQPublisher(ch, queue)
+	conn := amqpconn.New(connConfig, amqpconn.DeclareQueue(cfg.Queue))
+	go conn.Run(context.Background())
+
+	return NewRabbitMQPublisher(conn, cfg)
 }
@@ -1,7 +1,114 @@
 package rabbitmq
 
-import "context"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
-type JobPublisher interface {
-	Publish(ctc context.Context, jobID string, imageURL string) error
-}
\ No newline at end of file
+	"govision/pkg/envelope"
+)
+
+var (
+	// ErrUnavailable is returned by publishers while the broker is unreachable.
+	ErrUnavailable = errors.New("message broker unavailable, try again later")
+
+	// ErrNotConfirmed is returned when the broker did not confirm a message:
+	// it rejected it, returned it as unroutable or did not answer in time.
+	// The message may not be queued, so publishing it again is safe.
+	ErrNotConfirmed = errors.New("message not confirmed by broker")
+)
+
+// JobMessage carries everything the worker needs to process an uploaded image.
+// Dimensions describe the stored image and the upright original it was derived
+// from; ScaleFactor is stored/original. ImageSHA256 is the hash of the stored bytes.
+// DedupeKey identifies the message across redeliveries; the worker processes a
+// key only once. User and Trace identify who and which request submitted the
+// job. JobMessage is also stored as is in the outbox and the spool, so fields
+// are only ever added to it.
+type JobMessage struct {
+	JobID          string
+	DedupeKey      string
+	ImageURL       string
+	ImageSHA256    string
+	OriginalWidth  int
+	OriginalHeight int
+	Width          int
+	Height         int
+	ScaleFactor    float64
+	Model          *ModelRef
+	Options        *JobOptions
+	User           *envelope.User
+	Trace          *envelope.Trace
+	CreatedAt      time.Time
+}
+
+// Encode returns the message body the worker decodes: a validated envelope
+// of the current version.
+func (msg JobMessage) Encode() ([]byte, error) {
+	return msg.EncodeVersion(envelope.Version)
+}
+
+// EncodeVersion returns the message body in the given envelope version,
+// validated like one of the current version.
+func (msg JobMessage) EncodeVersion(version int) ([]byte, error) {
+	model, err := json.Marshal(msg.Model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode model: %w", err)
+	}
+	options, err := json.Marshal(msg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode options: %w", err)
+	}
+
+	return envelope.EncodeVersion(envelope.Envelope{
+		Type:      envelope.TypeJobCreated,
+		DedupeKey: msg.DedupeKey,
+		CreatedAt: msg.CreatedAt,
+		User:      msg.User,
+		Trace:     msg.Trace,
+		Job: envelope.Job{
+			ID:       msg.JobID,
+			ImageURL: msg.ImageURL,
+			Image: envelope.Image{
+				SHA256:         msg.ImageSHA256,
+				OriginalWidth:  msg.OriginalWidth,
+				OriginalHeight: msg.OriginalHeight,
+				Width:          msg.Width,
+				Height:         msg.Height,
+				ScaleFactor:    msg.ScaleFactor,
+			},
+			Model: model,
+		},
+		Options: options,
+	}, version)
+}
+
+// JobOptions are the per-job processing options chosen at upload time.
+// They override the defaults of the job's model.
+type JobOptions struct {
+	Tiling *TilingOptions `json:"tiling,omitempty"`
+	// Postprocess is the chain of clean-up steps applied to the detections,
+	// replacing the model's default chain.
+	Postprocess json.RawMessage `json:"postprocess,omitempty"`
+}
+
+// TilingOptions ask the worker for tiled inference with square tiles of
+// TileSize pixels overlapping by Overlap (a fraction of TileSize).
+type TilingOptions struct {
+	TileSize int     `json:"tile_size"`
+	Overlap  float64 `json:"overlap"`
+}
+
+// ModelRef identifies the registered model a job must be processed with.
+// It is nil when the worker's default model should be used.
+type ModelRef struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Provider string          `json:"provider"`
+	ModelID  string          `json:"model_id"`
+	Endpoint string          `json:"endpoint,omitempty"`
+	Version  string          `json:"version,omitempty"`
+	TaskType string          `json:"task_type,omitempty"`
+	Options  json.RawMessage `json:"options,omitempty"`
+}
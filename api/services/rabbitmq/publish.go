@@ -2,41 +2,157 @@ package rabbitmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"govision/pkg/amqpconn"
+	"govision/pkg/queue"
+
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// RabbitMQPublisher publishes job messages in confirm mode: Publish returns
+// only once the broker has taken responsibility for the message.
+// Publications are serialized, so the broker's acknowledgement and any
+// return of an unroutable message always belong to the message in flight.
 type RabbitMQPublisher struct {
+	conn *amqpconn.Manager
+	cfg  PublisherConfig
+
+	mu      sync.Mutex
 	channel *amqp.Channel
-	queue   string
+	returns chan amqp.Return
 }
 
-func NewRabbitMQPublisher(ch *amqp.Channel, queue string) *RabbitMQPublisher {
+var _ queue.Publisher = (*RabbitMQPublisher)(nil)
+
+// NewRabbitMQPublisher creates a publisher to cfg.Queue over conn.
+func NewRabbitMQPublisher(conn *amqpconn.Manager, cfg PublisherConfig) *RabbitMQPublisher {
 	return &RabbitMQPublisher{
-		channel: ch,
-		queue:   queue,
+		conn: conn,
+		cfg:  cfg,
+	}
+}
+
+// getChannel returns the open publishing channel, opening a new one in
+// confirm mode after the previous channel or connection was lost. While the
+// broker is unreachable it waits up to cfg.Wait. The caller holds p.mu.
+func (p *RabbitMQPublisher) getChannel(ctx context.Context) (*amqp.Channel, error) {
+	if p.channel != nil && !p.channel.IsClosed() {
+		return p.channel, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Wait)
+	defer cancel()
+
+	ch, err := p.conn.Channel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("%w: failed to enable publisher confirms: %v", ErrUnavailable, err)
+	}
+
+	p.channel = ch
+	p.returns = ch.NotifyReturn(make(chan amqp.Return, 16))
+	return ch, nil
+}
+
+// Close closes the publishing channel and the connection. Publications
+// afterwards fail with ErrUnavailable.
+func (p *RabbitMQPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.resetChannel()
+	return p.conn.Close()
+}
+
+// resetChannel drops the publishing channel, so the next publication opens
+// a new one and declares the queue again. The caller holds p.mu.
+func (p *RabbitMQPublisher) resetChannel() {
+	if p.channel != nil {
+		p.channel.Close()
+	}
+	p.channel = nil
+	p.returns = nil
+}
+
+// returned reports whether the broker returned the message with the given
+// ID as unroutable. The broker sends the return before the acknowledgement,
+// so it is already buffered once the message is confirmed. Returns of
+// earlier messages that timed out are discarded.
+func (p *RabbitMQPublisher) returned(messageID string) (*amqp.Return, bool) {
+	for {
+		select {
+		case ret, ok := <-p.returns:
+			if !ok {
+				return nil, false
+			}
+			if ret.MessageId == messageID {
+				return &ret, true
+			}
+		default:
+			return nil, false
+		}
 	}
 }
 
-func (p *RabbitMQPublisher) Publish(
-	ctx context.Context,
-	jobID string,
-	imageURL string,
-) error {
-	body := fmt.Sprintf(`{"job_id": "%s", "image_url": "%s"}`, jobID, imageURL)
-	return p.channel.PublishWithContext(
+// Publish implements queue.Publisher. It returns once the broker confirmed
+// the message, failing with ErrUnavailable while the broker is unreachable
+// and with ErrNotConfirmed when the message may not have been queued.
+func (p *RabbitMQPublisher) Publish(ctx context.Context, jobID string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, err := p.getChannel(ctx)
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(
 		ctx,
 		"",
-		p.queue,
-		false,
+		p.cfg.Queue,
+		true,
 		false,
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        []byte(body),
-			MessageId:   jobID,
-			Timestamp:   time.Now(),
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         body,
+			MessageId:    jobID,
+			Timestamp:    time.Now(),
 		},
 	)
+	if err != nil {
+		if errors.Is(err, amqp.ErrClosed) {
+			p.resetChannel()
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return err
+	}
+
+	confirmCtx, cancel := context.WithTimeout(ctx, p.cfg.ConfirmTimeout)
+	defer cancel()
+
+	acked, err := confirmation.WaitContext(confirmCtx)
+	switch {
+	case err != nil:
+		// The confirmation may still arrive on this channel; start afresh
+		// so it cannot be mistaken for the next message's.
+		p.resetChannel()
+		return fmt.Errorf("%w: job %s: no confirmation within %s: %v", ErrNotConfirmed, jobID, p.cfg.ConfirmTimeout, err)
+	case !acked:
+		p.resetChannel()
+		return fmt.Errorf("%w: job %s: rejected by broker", ErrNotConfirmed, jobID)
+	}
+
+	if ret, ok := p.returned(jobID); ok {
+		p.resetChannel()
+		return fmt.Errorf("%w: job %s: unroutable (%d %s)", ErrNotConfirmed, jobID, ret.ReplyCode, ret.ReplyText)
+	}
+	return nil
 }
@@ -0,0 +1,332 @@
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxBytes      = 1 << 30
+	defaultMaxFiles      = 1000
+	defaultRetryInterval = 30 * time.Second
+
+	tmpDir        = "tmp"
+	metadataExt   = ".json"
+	partialSuffix = ".part"
+)
+
+// ErrFull is returned when an entry would exceed the spool limits.
+var ErrFull = errors.New("spool is full")
+
+// Config controls where images are spooled and how much disk they may use.
+type Config struct {
+	Dir           string
+	MaxBytes      int64
+	MaxFiles      int
+	RetryInterval time.Duration
+}
+
+// ConfigFromEnv reads SPOOL_DIR, SPOOL_MAX_BYTES, SPOOL_MAX_FILES and
+// SPOOL_RETRY_INTERVAL. An empty Dir means spooling is disabled.
+func ConfigFromEnv() Config {
+	cfg := Config{Dir: os.Getenv("SPOOL_DIR")}
+
+	if raw := os.Getenv("SPOOL_MAX_BYTES"); raw != "" {
+		if value, err := strconv.ParseInt(raw, 10, 64); err == nil && value > 0 {
+			cfg.MaxBytes = value
+		} else {
+			log.Printf("[WARNING] - Invalid SPOOL_MAX_BYTES %q, using %d", raw, defaultMaxBytes)
+		}
+	}
+
+	if raw := os.Getenv("SPOOL_MAX_FILES"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			cfg.MaxFiles = value
+		} else {
+			log.Printf("[WARNING] - Invalid SPOOL_MAX_FILES %q, using %d", raw, defaultMaxFiles)
+		}
+	}
+
+	if raw := os.Getenv("SPOOL_RETRY_INTERVAL"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.RetryInterval = value
+		} else {
+			log.Printf("[WARNING] - Invalid SPOOL_RETRY_INTERVAL %q, using %s", raw, defaultRetryInterval)
+		}
+	}
+
+	return cfg
+}
+
+// Entry describes an image waiting in the spool for the storage backend.
+// Payload is opaque to the spool and holds whatever the caller needs to
+// finish the job once the image is stored.
+type Entry struct {
+	JobID     string          `json:"job_id"`
+	Filename  string          `json:"filename"`
+	Size      int64           `json:"size"`
+	SpooledAt time.Time       `json:"spooled_at"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	ImageURL  string          `json:"image_url,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Stats summarizes the current spool usage, including the room reserved by
+// entries still being written.
+type Stats struct {
+	Count    int   `json:"count"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+	MaxFiles int   `json:"max_files"`
+}
+
+// Spool is a durable on-disk queue of images that could not be uploaded to
+// the storage backend. Each entry is an image file plus a JSON metadata file
+// named after its job ID; an entry only becomes visible once both exist.
+type Spool struct {
+	cfg   Config
+	mu    sync.Mutex
+	bytes int64
+	count int
+}
+
+// New opens (or creates) the spool directory and accounts for the entries
+// left over from a previous run. Leftover partial writes are removed.
+func New(cfg Config) (*Spool, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultMaxBytes
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = defaultMaxFiles
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfg.Dir, tmpDir), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	partials, _ := filepath.Glob(filepath.Join(cfg.Dir, tmpDir, "*"+partialSuffix))
+	staleMetadata, _ := filepath.Glob(filepath.Join(cfg.Dir, "*"+partialSuffix))
+	for _, partial := range append(partials, staleMetadata...) {
+		_ = os.Remove(partial)
+	}
+
+	s := &Spool{cfg: cfg}
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		s.bytes += e.Size
+		s.count++
+	}
+
+	log.Printf("[SPOOL] - Using %s (%d entries, %d bytes)", cfg.Dir, s.count, s.bytes)
+	return s, nil
+}
+
+// RetryInterval is how often spooled entries should be retried.
+func (s *Spool) RetryInterval() time.Duration {
+	return s.cfg.RetryInterval
+}
+
+// Begin starts writing an image for jobID. The data only enters the spool
+// once the returned Writer is committed, but the entry counts against the
+// limits from now on: Begin returns ErrFull when no entry is left, and
+// writes fail with ErrFull once the byte budget is used up. Concurrent
+// writers therefore cannot overshoot the limits together.
+func (s *Spool) Begin(jobID, filename string) (*Writer, error) {
+	if err := s.reserve(1, 0); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(s.cfg.Dir, tmpDir, jobID+partialSuffix)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		s.release(1, 0)
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	return &Writer{spool: s, file: f, jobID: jobID, filename: filename}, nil
+}
+
+// List returns the committed entries, oldest first.
+func (s *Spool) List() ([]Entry, error) {
+	paths, err := filepath.Glob(filepath.Join(s.cfg.Dir, "*"+metadataExt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(paths))
+	for _, path := range paths {
+		e, err := readEntry(path)
+		if err != nil {
+			log.Printf("[SPOOL] - Skipping unreadable entry %s: %v", filepath.Base(path), err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].SpooledAt.Before(entries[j].SpooledAt) })
+	return entries, nil
+}
+
+// Stats reports the current usage against the configured limits.
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Count: s.count, Bytes: s.bytes, MaxBytes: s.cfg.MaxBytes, MaxFiles: s.cfg.MaxFiles}
+}
+
+// Open returns the spooled image of an entry.
+func (s *Spool) Open(e Entry) (io.ReadCloser, error) {
+	return os.Open(s.imagePath(e.JobID))
+}
+
+// Update persists the retry bookkeeping of an entry.
+func (s *Spool) Update(e Entry) error {
+	return writeEntry(s.metadataPath(e.JobID), e)
+}
+
+// Remove deletes an entry once its image has been stored and its job queued.
+func (s *Spool) Remove(e Entry) error {
+	if err := os.Remove(s.metadataPath(e.JobID)); err != nil {
+		return fmt.Errorf("failed to remove spool entry %s: %w", e.JobID, err)
+	}
+	_ = os.Remove(s.imagePath(e.JobID))
+
+	s.release(1, e.Size)
+	return nil
+}
+
+func (s *Spool) imagePath(jobID string) string {
+	return filepath.Join(s.cfg.Dir, jobID)
+}
+
+func (s *Spool) metadataPath(jobID string) string {
+	return filepath.Join(s.cfg.Dir, jobID+metadataExt)
+}
+
+// reserve claims room for count entries and size bytes.
+func (s *Spool) reserve(count int, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count+count > s.cfg.MaxFiles || s.bytes+size > s.cfg.MaxBytes {
+		return ErrFull
+	}
+	s.count += count
+	s.bytes += size
+	return nil
+}
+
+func (s *Spool) release(count int, size int64) {
+	s.mu.Lock()
+	s.count -= count
+	s.bytes -= size
+	s.mu.Unlock()
+}
+
+// Writer receives the bytes of an image being spooled.
+type Writer struct {
+	spool    *Spool
+	file     *os.File
+	jobID    string
+	filename string
+	size     int64
+}
+
+// Write reserves room for p before writing it, failing with ErrFull when
+// the spool has none left.
+func (w *Writer) Write(p []byte) (int, error) {
+	if err := w.spool.reserve(0, int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := w.file.Write(p)
+	w.spool.release(0, int64(len(p)-n))
+	w.size += int64(n)
+	return n, err
+}
+
+// Commit makes the image durable and visible to List, storing payload with
+// it.
+func (w *Writer) Commit(payload any) error {
+	raw, err := json.Marshal(payload)
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(w.file.Name(), w.spool.imagePath(w.jobID))
+	}
+	if err == nil {
+		err = writeEntry(w.spool.metadataPath(w.jobID), Entry{
+			JobID:     w.jobID,
+			Filename:  w.filename,
+			Size:      w.size,
+			SpooledAt: time.Now(),
+			Payload:   raw,
+		})
+	}
+
+	if err != nil {
+		w.spool.release(1, w.size)
+		_ = os.Remove(w.file.Name())
+		_ = os.Remove(w.spool.imagePath(w.jobID))
+		return fmt.Errorf("failed to commit spool entry %s: %w", w.jobID, err)
+	}
+
+	log.Printf("[SPOOL] - Job %s spooled (%d bytes)", w.jobID, w.size)
+	return nil
+}
+
+// Discard drops the partially written image and its reservation.
+func (w *Writer) Discard() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+	w.spool.release(1, w.size)
+}
+
+func readEntry(path string) (Entry, error) {
+	var e Entry
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return e, err
+	}
+	if e.JobID == "" || strings.ContainsAny(e.JobID, `/\`) {
+		return e, fmt.Errorf("invalid job id %q", e.JobID)
+	}
+	return e, nil
+}
+
+// writeEntry replaces the metadata file atomically so a crash never leaves
+// a half-written entry behind.
+func writeEntry(path string, e Entry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + partialSuffix
+	if err := os.WriteFile(tmp, raw, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
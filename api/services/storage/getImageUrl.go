@@ -1,8 +1,10 @@
 package storage
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"io"
+
 	utils "govision/api/pkg/utils"
 )
 
@@ -11,8 +13,10 @@ type StorageService[T any] struct {
 	ResponseModel T
 }
 
-func (s *StorageService[T]) GetImageUrl(body *bytes.Buffer, apiKey string) (*T, error) {
-	err, respBytes := utils.SendRequest(s.URL, body, apiKey)
+// GetImageUrl streams body to the storage backend as a multipart file upload
+// and decodes the JSON response into the service's response model.
+func (s *StorageService[T]) GetImageUrl(ctx context.Context, filename string, body io.Reader, apiKey string) (*T, error) {
+	err, respBytes := utils.SendRequest(ctx, s.URL, filename, body, apiKey)
 	if err != nil {
 		return nil, err
 	}
@@ -25,6 +25,7 @@ const dom = Object.freeze({
     filePreview: $("filePreview"),
     fileList:    $("fileList"),
     uploadBtn:   $("uploadBtn"),
+    modelInput:  $("modelInput"),
     jobsBody:    $("jobsBody"),
     jobCount:    $("jobCount"),
     emptyState:  $("emptyState"),
@@ -53,6 +54,7 @@ const jobs = new Map();
  *   status: string,
  *   imageUrl: string | null,
  *   predictions: Array<Record<string, unknown>>,
+ *   classification: Record<string, any> | null,
  *   error: string | null,
  *   downloaded: boolean,
  *   createdAt: number,
@@ -102,7 +104,7 @@ function addFiles(files) {
     if (!files) return;
 
     for (const file of files) {
-        const valid = /^image\/(jpeg|png|gif)$/i.test(file.type) && file.size <= MAX_FILE_SIZE;
+        const valid = /^image\/(jpeg|png|gif|webp|bmp|tiff)$/i.test(file.type) && file.size <= MAX_FILE_SIZE;
         if (!valid) continue;
 
         const duplicate = selectedFiles.some((f) => f.name === file.name && f.size === file.size);
@@ -185,7 +187,10 @@ async function uploadSingleFile(file) {
     const tempId = createTempJob(file.name);
 
     try {
+        // Text fields must precede the file: the API reads the body as a stream.
         const formData = new FormData();
+        const model = dom.modelInput.value.trim();
+        if (model) formData.append("model", model);
         formData.append("file", file);
 
         const response = await authFetch(`${API_BASE}/image/upload`, {
@@ -224,6 +229,7 @@ function defaultJob(id) {
         status: "queued",
         imageUrl: null,
         predictions: [],
+        classification: null,
         error: null,
         downloaded: false,
         createdAt: Date.now(),
@@ -298,6 +304,7 @@ async function fetchJobStatus(jobId) {
             status: /** @type {string} */ (data.status) || job.status,
             imageUrl: /** @type {string} */ (data.image_url) || job.imageUrl,
             predictions: Array.isArray(data.predictions) ? data.predictions : job.predictions,
+            classification: data.classification || job.classification,
         });
 
         const updated = jobs.get(jobId);
@@ -338,7 +345,7 @@ function renderJobs() {
             createCell(createMonoSpan(job.isTemp ? "..." : job.id, TRUNCATE_ID)),
             createCell(createTruncatedSpan(job.fileName, TRUNCATE_FILE, "file-name")),
             createCell(createStatusBadge(job.status)),
-            createTextCell(isCompleted ? String(job.predictions.length) : "\u2014"),
+            createTextCell(isCompleted ? resultSummary(job) : "\u2014"),
         );
         fragment.appendChild(tr);
 
@@ -391,6 +398,10 @@ function buildDetailContent(td, job) {
     const statsDiv = document.createElement("div");
     statsDiv.className = "job-detail-stats";
 
+    if (job.classification) {
+        appendClassificationStats(statsDiv, job.classification);
+    }
+
     // Total objects card
     const totalCard = document.createElement("div");
     totalCard.className = "stat-card";
@@ -401,7 +412,7 @@ function buildDetailContent(td, job) {
     totalLabel.className = "stat-label";
     totalLabel.textContent = "Objects Detected";
     totalCard.append(totalValue, totalLabel);
-    statsDiv.appendChild(totalCard);
+    if (!job.classification) statsDiv.appendChild(totalCard);
 
     // Class breakdown
     const classCounts = {};
@@ -461,6 +472,62 @@ function buildDetailContent(td, job) {
     td.appendChild(wrapper);
 }
 
+/** Objects column text: the object count, or the top class of classifiers. */
+function resultSummary(job) {
+    if (job.classification) {
+        const predicted = job.classification.predicted_classes || [];
+        return job.classification.multi_label ? (predicted.join(", ") || "none") : String(job.classification.top);
+    }
+    return String(job.predictions.length);
+}
+
+/** Adds the top class and per-class scores of a classification job. */
+function appendClassificationStats(statsDiv, classification) {
+    const topCard = document.createElement("div");
+    topCard.className = "stat-card";
+    const topValue = document.createElement("div");
+    topValue.className = "stat-value";
+    topValue.textContent = String(classification.top);
+    const topLabel = document.createElement("div");
+    topLabel.className = "stat-label";
+    const confidence = Number(classification.confidence) || 0;
+    topLabel.textContent = `Top class (${(confidence * 100).toFixed(0)}%)`;
+    topCard.append(topValue, topLabel);
+    statsDiv.appendChild(topCard);
+
+    const predicted = new Set(classification.predicted_classes || []);
+    const scoresCard = document.createElement("div");
+    scoresCard.className = "stat-card";
+
+    const scoresLabel = document.createElement("div");
+    scoresLabel.className = "stat-label";
+    scoresLabel.style.marginBottom = "0.5rem";
+    scoresLabel.textContent = classification.multi_label ? "Class scores (predicted in bold)" : "Class scores";
+    scoresCard.appendChild(scoresLabel);
+
+    const ul = document.createElement("ul");
+    ul.className = "class-list";
+    for (const c of classification.classes || []) {
+        const li = document.createElement("li");
+
+        const nameSpan = document.createElement("span");
+        const dot = document.createElement("span");
+        dot.className = "class-dot";
+        dot.style.backgroundColor = BOX_COLORS[Math.abs(Number(c.class_id) || 0) % BOX_COLORS.length];
+        nameSpan.append(dot, String(c.class));
+        if (predicted.has(c.class)) nameSpan.style.fontWeight = "600";
+
+        const scoreSpan = document.createElement("span");
+        scoreSpan.className = "class-count";
+        scoreSpan.textContent = `${((Number(c.confidence) || 0) * 100).toFixed(0)}%`;
+
+        li.append(nameSpan, scoreSpan);
+        ul.appendChild(li);
+    }
+    scoresCard.appendChild(ul);
+    statsDiv.appendChild(scoresCard);
+}
+
 /** @returns {HTMLTableCellElement} */
 function createCell(child) {
     const td = document.createElement("td");
@@ -546,8 +613,9 @@ function onJobsTableClick(event) {
 // ── Canvas / bounding box drawing ────────────────────────────
 
 /**
- * Draws bounding boxes over the source image on a canvas.
- * Predictions use **center-based** coordinates.
+ * Draws detections over the source image on a canvas: segmentation polygons
+ * when present, bounding boxes otherwise, plus pose keypoints.
+ * Predictions use **center-based** box coordinates.
  * @param {HTMLCanvasElement} canvas
  * @param {HTMLImageElement} image
  * @param {Array<Record<string, unknown>>} predictions
@@ -578,9 +646,19 @@ function drawBoundingBoxes(canvas, image, predictions) {
         const confidence = Number(p.confidence) || 0;
         const label = `${p.class || "object"} ${(confidence * 100).toFixed(0)}%`;
 
-        // box
+        // polygon (segmentation) or box
         ctx.strokeStyle = color;
-        ctx.strokeRect(x, y, w, h);
+        const points = Array.isArray(p.points) ? p.points : [];
+        if (points.length >= 3) {
+            drawPolygon(ctx, points, color);
+        } else {
+            ctx.strokeRect(x, y, w, h);
+        }
+
+        // keypoints (pose)
+        if (Array.isArray(p.keypoints)) {
+            drawKeypoints(ctx, p.keypoints, color, lineWidth);
+        }
 
         // label background
         const metrics = ctx.measureText(label);
@@ -597,6 +675,36 @@ function drawBoundingBoxes(canvas, image, predictions) {
     }
 }
 
+/** Outlines a segmentation polygon and fills it with a translucent tint. */
+function drawPolygon(ctx, points, color) {
+    ctx.beginPath();
+    points.forEach((pt, i) => {
+        const px = Number(pt.x) || 0;
+        const py = Number(pt.y) || 0;
+        if (i === 0) ctx.moveTo(px, py);
+        else ctx.lineTo(px, py);
+    });
+    ctx.closePath();
+
+    ctx.save();
+    ctx.globalAlpha = 0.25;
+    ctx.fillStyle = color;
+    ctx.fill();
+    ctx.restore();
+    ctx.stroke();
+}
+
+/** Marks pose keypoints as small dots. */
+function drawKeypoints(ctx, keypoints, color, lineWidth) {
+    const radius = Math.max(3, lineWidth * 1.5);
+    ctx.fillStyle = color;
+    for (const kp of keypoints) {
+        ctx.beginPath();
+        ctx.arc(Number(kp.x) || 0, Number(kp.y) || 0, radius, 0, Math.PI * 2);
+        ctx.fill();
+    }
+}
+
 /**
  * @param {string} url
  * @returns {Promise<HTMLImageElement>}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS models (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name            VARCHAR(100) NOT NULL UNIQUE,
+    provider        VARCHAR(50)  NOT NULL,
+    model_id        TEXT         NOT NULL,
+    endpoint        TEXT         NOT NULL DEFAULT '',
+    version         VARCHAR(100) NOT NULL DEFAULT '',
+    default_options JSONB        NOT NULL DEFAULT '{}'::jsonb,
+    active          BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at      TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS model_name    VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS model_version VARCHAR(100) NOT NULL DEFAULT '';
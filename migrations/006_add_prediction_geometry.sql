@@ -0,0 +1,4 @@
+ALTER TABLE predictions ADD COLUMN IF NOT EXISTS detection_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE predictions ADD COLUMN IF NOT EXISTS parent_id    VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE predictions ADD COLUMN IF NOT EXISTS points       JSONB;
+ALTER TABLE predictions ADD COLUMN IF NOT EXISTS keypoints    JSONB;
@@ -0,0 +1,14 @@
+ALTER TABLE models ADD COLUMN IF NOT EXISTS task_type VARCHAR(50) NOT NULL DEFAULT 'object_detection';
+ALTER TABLE jobs   ADD COLUMN IF NOT EXISTS task_type VARCHAR(50) NOT NULL DEFAULT 'object_detection';
+
+CREATE TABLE IF NOT EXISTS classifications (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_id     VARCHAR(255)     NOT NULL REFERENCES jobs(job_id) ON DELETE CASCADE,
+    class      VARCHAR(255)     NOT NULL,
+    class_id   INTEGER          NOT NULL,
+    confidence DOUBLE PRECISION NOT NULL,
+    predicted  BOOLEAN          NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_classifications_job_id ON classifications(job_id);
@@ -0,0 +1 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS postprocess JSONB NOT NULL DEFAULT '[]'::jsonb;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS rate_limits (
+    name          VARCHAR(100)     PRIMARY KEY,
+    tokens        DOUBLE PRECISION NOT NULL,
+    updated_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    blocked_until TIMESTAMPTZ
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS inference_cache (
+    cache_key     VARCHAR(64)  PRIMARY KEY,
+    job_id        VARCHAR(255) NOT NULL,
+    model_name    VARCHAR(100) NOT NULL DEFAULT '',
+    model_version VARCHAR(100) NOT NULL DEFAULT '',
+    result        JSONB        NOT NULL,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_inference_cache_model_name ON inference_cache(model_name);
+CREATE INDEX IF NOT EXISTS idx_inference_cache_expires_at ON inference_cache(expires_at);
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS cached_from VARCHAR(255);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id           BIGSERIAL    PRIMARY KEY,
+    event_type   VARCHAR(100) NOT NULL,
+    dedupe_key   VARCHAR(255) NOT NULL UNIQUE,
+    payload      JSONB        NOT NULL,
+    attempts     INTEGER      NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    available_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    sent_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(available_at) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_sent_at ON outbox(sent_at) WHERE sent_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS processed_messages (
+    dedupe_key   VARCHAR(255) PRIMARY KEY,
+    job_id       VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_messages_job_id ON processed_messages(job_id);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id              UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_id          VARCHAR(255) NOT NULL UNIQUE,
+    reason          VARCHAR(50)  NOT NULL,
+    error           TEXT         NOT NULL DEFAULT '',
+    payload         TEXT         NOT NULL,
+    model_name      VARCHAR(100) NOT NULL DEFAULT '',
+    attempts        INTEGER      NOT NULL DEFAULT 1,
+    replay_count    INTEGER      NOT NULL DEFAULT 0,
+    first_failed_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    last_failed_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    replayed_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_reason ON dead_letters(reason);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_last_failed_at ON dead_letters(last_failed_at);
+
+CREATE TABLE IF NOT EXISTS job_events (
+    id         BIGSERIAL    PRIMARY KEY,
+    job_id     VARCHAR(255) NOT NULL,
+    event_type VARCHAR(50)  NOT NULL,
+    actor      VARCHAR(255) NOT NULL DEFAULT '',
+    detail     JSONB        NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_events_job_id ON job_events(job_id, created_at);
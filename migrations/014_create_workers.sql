@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS workers (
+    id                 VARCHAR(255) PRIMARY KEY,
+    hostname           VARCHAR(255) NOT NULL DEFAULT '',
+    version            VARCHAR(100) NOT NULL DEFAULT '',
+    models             JSONB        NOT NULL DEFAULT '[]',
+    concurrency        INTEGER      NOT NULL DEFAULT 0,
+    heartbeat_interval INTEGER      NOT NULL DEFAULT 0,
+    current_jobs       JSONB        NOT NULL DEFAULT '[]',
+    processed          BIGINT       NOT NULL DEFAULT 0,
+    failed             BIGINT       NOT NULL DEFAULT 0,
+    started_at         TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    last_heartbeat_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    stopped_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_workers_last_heartbeat_at ON workers(last_heartbeat_at);
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS worker_id VARCHAR(255);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS job_queue (
+    id          BIGSERIAL    PRIMARY KEY,
+    queue       VARCHAR(255) NOT NULL,
+    message_id  VARCHAR(255) NOT NULL,
+    body        BYTEA        NOT NULL,
+    attempts    INTEGER      NOT NULL DEFAULT 0,
+    enqueued_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    visible_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_visible ON job_queue(queue, visible_at, id);
@@ -0,0 +1,3 @@
+-- Admin rights are granted out of band (api users grant-admin), never derived
+-- from the self-declared email of an account.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
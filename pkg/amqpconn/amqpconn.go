@@ -0,0 +1,301 @@
+// Package amqpconn keeps a RabbitMQ connection alive across broker restarts.
+// It is shared by the API publisher and the worker consumer: the connection
+// is re-dialled with jittered exponential backoff whenever it is lost, and
+// every channel handed out re-declares the topology it relies on.
+package amqpconn
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// ErrClosed is returned once the manager has been closed.
+var ErrClosed = errors.New("rabbitmq connection manager closed")
+
+var metrics = expvar.NewMap("rabbitmq")
+
+// Config describes how to reach the broker.
+type Config struct {
+	URL string
+	// MinBackoff is the pause before the first reconnection attempt. It
+	// doubles after each failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// ConfigFromEnv reads RABBITMQ_URL, RABBITMQ_RECONNECT_MIN_BACKOFF and
+// RABBITMQ_RECONNECT_MAX_BACKOFF.
+func ConfigFromEnv() Config {
+	return Config{
+		URL:        os.Getenv("RABBITMQ_URL"),
+		MinBackoff: envDuration("RABBITMQ_RECONNECT_MIN_BACKOFF", defaultMinBackoff),
+		MaxBackoff: envDuration("RABBITMQ_RECONNECT_MAX_BACKOFF", defaultMaxBackoff),
+	}
+}
+
+// Topology declares the exchanges and queues a channel uses. It runs on
+// every channel the manager opens, so they exist again after the broker
+// lost them.
+type Topology func(ch *amqp.Channel) error
+
+// DeclareQueue returns the topology of the durable job queue name and of
+// its retry queue. The API and the worker declare them with the same
+// arguments.
+func DeclareQueue(name string) Topology {
+	return func(ch *amqp.Channel) error {
+		if _, err := ch.QueueDeclare(name, true, false, false, false, nil); err != nil {
+			return err
+		}
+		_, err := ch.QueueDeclare(RetryQueue(name), true, false, false, false, amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": name,
+		})
+		return err
+	}
+}
+
+// RetryQueue names the queue holding the requeued messages of the job queue
+// name. Nothing consumes it: each message waits there for its per-message
+// TTL, then the broker dead-letters it back to the job queue.
+func RetryQueue(name string) string {
+	return name + ".retry"
+}
+
+// Manager owns the connection to the broker and replaces it when it closes.
+type Manager struct {
+	cfg      Config
+	topology Topology
+
+	mu    sync.Mutex
+	conn  *amqp.Connection
+	ready chan struct{} // closed while conn is usable
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a manager. Nothing is dialled until Run is called.
+func New(cfg Config, topology Topology) *Manager {
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(cfg.MinBackoff, defaultMaxBackoff)
+	}
+	return &Manager{cfg: cfg, topology: topology, ready: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Run dials the broker and re-dials it every time the connection closes,
+// until ctx is cancelled or the manager is closed.
+func (m *Manager) Run(ctx context.Context) {
+	backoff := m.cfg.MinBackoff
+	for {
+		conn, err := m.dial()
+		if err != nil {
+			wait := jitter(backoff)
+			log.Printf("[RABBITMQ] - Connection failed, retrying in %s: %v", wait.Round(time.Millisecond), err)
+			metrics.Add("dial_errors", 1)
+			if !m.sleep(ctx, wait) {
+				return
+			}
+			backoff = min(backoff*2, m.cfg.MaxBackoff)
+			continue
+		}
+		backoff = m.cfg.MinBackoff
+		if m.isClosed() {
+			conn.Close()
+			return
+		}
+
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		m.setConnection(conn)
+		log.Println("[RABBITMQ] - Connected")
+
+		select {
+		case <-ctx.Done():
+			m.Close()
+			return
+		case <-m.done:
+			return
+		case reason := <-closed:
+			m.clearConnection()
+			if m.isClosed() {
+				return
+			}
+			metrics.Add("disconnects", 1)
+			log.Printf("[RABBITMQ] - Connection lost: %v", reason)
+		}
+	}
+}
+
+func (m *Manager) dial() (*amqp.Connection, error) {
+	conn, err := amqp.Dial(m.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Declare the topology once up front, so a broker that rejects it is
+	// reported here rather than on the first publish.
+	if m.topology != nil {
+		ch, err := conn.Channel()
+		if err == nil {
+			err = m.topology(ch)
+			ch.Close()
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (m *Manager) setConnection(conn *amqp.Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.conn = conn
+	close(m.ready)
+	metrics.Set("connected", boolVar(true))
+}
+
+func (m *Manager) clearConnection() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.conn = nil
+	m.ready = make(chan struct{})
+	metrics.Set("connected", boolVar(false))
+}
+
+// Connected reports whether a connection is currently open.
+func (m *Manager) Connected() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conn != nil && !m.conn.IsClosed()
+}
+
+// Connection waits until the broker is reachable and returns the current
+// connection. It fails when ctx is done first.
+func (m *Manager) Connection(ctx context.Context) (*amqp.Connection, error) {
+	for {
+		m.mu.Lock()
+		conn, ready := m.conn, m.ready
+		m.mu.Unlock()
+
+		if conn != nil && !conn.IsClosed() {
+			return conn, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-m.done:
+			return nil, ErrClosed
+		case <-ready:
+		}
+	}
+}
+
+// Channel opens a channel on the current connection, waiting for one while
+// the broker is down, and declares the topology on it.
+func (m *Manager) Channel(ctx context.Context) (*amqp.Channel, error) {
+	conn, err := m.Connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if m.topology != nil {
+		if err := m.topology(ch); err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+	return ch, nil
+}
+
+func (m *Manager) isClosed() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops reconnecting and closes the current connection.
+func (m *Manager) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+
+		m.mu.Lock()
+		conn := m.conn
+		m.mu.Unlock()
+		if conn != nil {
+			err = conn.Close()
+		}
+	})
+	return err
+}
+
+// sleep waits for d and reports false when the manager should stop instead.
+func (m *Manager) sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		m.Close()
+		return false
+	case <-m.done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// jitter spreads reconnection attempts of many processes over [d/2, d], so
+// they do not all hit a restarted broker at once.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+func boolVar(value bool) *expvar.Int {
+	v := new(expvar.Int)
+	if value {
+		v.Set(1)
+	}
+	return v
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		log.Printf("[WARNING] - Invalid %s %q, using %s", name, raw, fallback)
+		return fallback
+	}
+	return value
+}
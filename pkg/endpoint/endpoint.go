@@ -0,0 +1,92 @@
+// Package endpoint decides which inference servers a registered model may
+// point at. Workers send the account's credentials to a model's endpoint, so
+// only https URLs on hosts the operator listed are accepted: the API refuses
+// to register anything else and workers refuse to call it.
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultHosts are the hosts of the hosted Roboflow APIs, allowed when
+// MODEL_ENDPOINT_ALLOWLIST is unset.
+var DefaultHosts = []string{
+	"serverless.roboflow.com",
+	"detect.roboflow.com",
+	"classify.roboflow.com",
+	"outline.roboflow.com",
+}
+
+// ErrNotAllowed is returned for endpoints outside the allowlist.
+var ErrNotAllowed = errors.New("endpoint not allowed")
+
+// Allowlist is the set of hosts model endpoints may use. An entry is a host
+// name, optionally with a port, or "*.domain" for any subdomain of domain.
+// Entries without a port only match the default https port.
+type Allowlist struct {
+	hosts []string
+}
+
+// NewAllowlist creates an allowlist of the given hosts.
+func NewAllowlist(hosts []string) Allowlist {
+	var a Allowlist
+	for _, host := range hosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			a.hosts = append(a.hosts, host)
+		}
+	}
+	return a
+}
+
+// AllowlistFromEnv reads MODEL_ENDPOINT_ALLOWLIST, a comma-separated list of
+// hosts. It defaults to DefaultHosts; "none" forbids custom endpoints.
+func AllowlistFromEnv() Allowlist {
+	raw, ok := os.LookupEnv("MODEL_ENDPOINT_ALLOWLIST")
+	switch {
+	case !ok || strings.TrimSpace(raw) == "":
+		return NewAllowlist(DefaultHosts)
+	case strings.EqualFold(strings.TrimSpace(raw), "none"):
+		return Allowlist{}
+	default:
+		return NewAllowlist(strings.Split(raw, ","))
+	}
+}
+
+// Hosts returns the entries of the allowlist.
+func (a Allowlist) Hosts() []string {
+	return a.hosts
+}
+
+// Check returns nil when raw is an https URL on an allowed host, and an
+// error wrapping ErrNotAllowed otherwise.
+func (a Allowlist) Check(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: %q is not an absolute URL", ErrNotAllowed, raw)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: %q must use https", ErrNotAllowed, raw)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: %q must not carry credentials", ErrNotAllowed, raw)
+	}
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	for _, entry := range a.hosts {
+		entryHost, entryPort, hasPort := strings.Cut(entry, ":")
+		if hasPort && entryPort != port || !hasPort && port != "" && port != "443" {
+			continue
+		}
+		if entryHost == host {
+			return nil
+		}
+		if domain, ok := strings.CutPrefix(entryHost, "*."); ok && strings.HasSuffix(host, "."+domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %q is not in MODEL_ENDPOINT_ALLOWLIST", ErrNotAllowed, u.Host)
+}
@@ -0,0 +1,232 @@
+// Package envelope defines the messages exchanged by the API and the workers
+// over the job queue. Every message is a JSON envelope that names its type
+// and version, so workers can tell formats apart while API instances and
+// workers of different releases run side by side.
+//
+// Version 1 is the flat job message published before envelopes existed; it
+// has no version field. Decode reads both versions, Encode writes the
+// current one. EncodeVersion can still write version 1 for workers of
+// releases that predate envelopes, which cannot read version 2.
+package envelope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+)
+
+// TypeJobCreated announces a job to process.
+const TypeJobCreated = "job.created"
+
+// Message versions.
+const (
+	// VersionLegacy is the unversioned flat job message.
+	VersionLegacy = 1
+	// Version is the version written by Encode.
+	Version = 2
+)
+
+var (
+	// ErrInvalid is returned for messages that are malformed or miss
+	// required fields.
+	ErrInvalid = errors.New("invalid message")
+	// ErrUnsupportedVersion is returned for versions this release cannot
+	// read, typically written by a newer release.
+	ErrUnsupportedVersion = errors.New("unsupported message version")
+)
+
+// Envelope is a message of the job queue. DedupeKey identifies the message
+// across redeliveries. Options are the per-job processing options chosen at
+// upload time; like Job.Model they are kept as raw JSON, their schema
+// belongs to the producer and the consumer.
+type Envelope struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	DedupeKey string          `json:"dedupe_key,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	User      *User           `json:"user,omitempty"`
+	Trace     *Trace          `json:"trace,omitempty"`
+	Job       Job             `json:"job"`
+	Options   json.RawMessage `json:"options,omitempty"`
+}
+
+// Job is the payload of a job.created message. Model is the registered
+// model to use, absent when the worker's default model applies.
+type Job struct {
+	ID       string          `json:"id"`
+	ImageURL string          `json:"image_url"`
+	Image    Image           `json:"image"`
+	Model    json.RawMessage `json:"model,omitempty"`
+}
+
+// Image describes the stored image and the upright original it was derived
+// from. ScaleFactor is stored/original and SHA256 the hash of the stored
+// bytes.
+type Image struct {
+	SHA256         string  `json:"sha256"`
+	OriginalWidth  int     `json:"original_width"`
+	OriginalHeight int     `json:"original_height"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	ScaleFactor    float64 `json:"scale_factor"`
+}
+
+// User is the authenticated user who submitted the job.
+type User struct {
+	ID string `json:"id"`
+}
+
+// legacyMessage is the layout of version 1 messages.
+type legacyMessage struct {
+	JobID     string          `json:"job_id"`
+	DedupeKey string          `json:"dedupe_key"`
+	ImageURL  string          `json:"image_url"`
+	Image     Image           `json:"image"`
+	Model     json.RawMessage `json:"model"`
+	Options   json.RawMessage `json:"options"`
+}
+
+// Encode validates env and returns it as a message body of the current
+// version.
+func Encode(env Envelope) ([]byte, error) {
+	return EncodeVersion(env, Version)
+}
+
+// EncodeVersion validates env as a message of the current version and
+// returns it as a message body of the given version. Version 1 bodies drop
+// the creation time, user and trace.
+func EncodeVersion(env Envelope, version int) ([]byte, error) {
+	if version != VersionLegacy && version != Version {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, version)
+	}
+
+	env.Version = Version
+	env.normalize()
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	if version == Version {
+		return json.Marshal(env)
+	}
+
+	return json.Marshal(legacyMessage{
+		JobID:     env.Job.ID,
+		DedupeKey: env.DedupeKey,
+		ImageURL:  env.Job.ImageURL,
+		Image:     env.Job.Image,
+		Model:     env.Job.Model,
+		Options:   env.Options,
+	})
+}
+
+// Decode parses and validates a message body of any supported version.
+// Version 1 messages are converted: they carry no creation time, user or
+// trace, and a missing scale factor means the image was not resized.
+func Decode(body []byte) (*Envelope, error) {
+	var head struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(body, &head); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	var env Envelope
+	switch {
+	case head.Version == nil || *head.Version == VersionLegacy:
+		var legacy legacyMessage
+		if err := json.Unmarshal(body, &legacy); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		env = Envelope{
+			Type:      TypeJobCreated,
+			Version:   VersionLegacy,
+			DedupeKey: legacy.DedupeKey,
+			Job: Job{
+				ID:       legacy.JobID,
+				ImageURL: legacy.ImageURL,
+				Image:    legacy.Image,
+				Model:    legacy.Model,
+			},
+			Options: legacy.Options,
+		}
+		if env.Job.Image.ScaleFactor == 0 {
+			env.Job.Image.ScaleFactor = 1
+		}
+	case *head.Version == Version:
+		if err := json.Unmarshal(body, &env); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w %d (this release reads up to %d)", ErrUnsupportedVersion, *head.Version, Version)
+	}
+
+	env.normalize()
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// normalize treats an explicit null in the raw JSON fields as an absent
+// value.
+func (env *Envelope) normalize() {
+	env.Job.Model = omitNull(env.Job.Model)
+	env.Options = omitNull(env.Options)
+}
+
+// Validate checks the fields every consumer relies on.
+func (env *Envelope) Validate() error {
+	if env.Type != TypeJobCreated {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalid, env.Type)
+	}
+	if env.Version != VersionLegacy && env.Version != Version {
+		return fmt.Errorf("%w %d", ErrUnsupportedVersion, env.Version)
+	}
+
+	if env.Version != VersionLegacy {
+		if env.DedupeKey == "" {
+			return fmt.Errorf("%w: dedupe_key is required", ErrInvalid)
+		}
+		if env.CreatedAt.IsZero() {
+			return fmt.Errorf("%w: created_at is required", ErrInvalid)
+		}
+		if env.User != nil && env.User.ID == "" {
+			return fmt.Errorf("%w: user.id is required", ErrInvalid)
+		}
+		if env.Trace != nil && !validTraceParent(env.Trace.Parent) {
+			return fmt.Errorf("%w: malformed traceparent %q", ErrInvalid, env.Trace.Parent)
+		}
+	}
+
+	if env.Job.ID == "" {
+		return fmt.Errorf("%w: job id is required", ErrInvalid)
+	}
+	if u, err := url.Parse(env.Job.ImageURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: image_url must be an absolute http(s) URL", ErrInvalid)
+	}
+
+	image := env.Job.Image
+	if image.OriginalWidth < 0 || image.OriginalHeight < 0 || image.Width < 0 || image.Height < 0 {
+		return fmt.Errorf("%w: negative image dimensions", ErrInvalid)
+	}
+	if image.ScaleFactor <= 0 || math.IsInf(image.ScaleFactor, 0) || math.IsNaN(image.ScaleFactor) {
+		return fmt.Errorf("%w: scale_factor must be positive", ErrInvalid)
+	}
+
+	for name, raw := range map[string]json.RawMessage{"model": env.Job.Model, "options": env.Options} {
+		if len(raw) > 0 && (!json.Valid(raw) || raw[0] != '{') {
+			return fmt.Errorf("%w: %s must be an object", ErrInvalid, name)
+		}
+	}
+	return nil
+}
+
+func omitNull(raw json.RawMessage) json.RawMessage {
+	if string(raw) == "null" {
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,82 @@
+package envelope
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testEnvelope() Envelope {
+	return Envelope{
+		Type:      TypeJobCreated,
+		DedupeKey: "job-1",
+		CreatedAt: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		User:      &User{ID: "user-1"},
+		Job: Job{
+			ID:       "job-1",
+			ImageURL: "https://images.example.com/1.jpg",
+			Image:    Image{SHA256: "abc", OriginalWidth: 400, OriginalHeight: 300, Width: 200, Height: 150, ScaleFactor: 0.5},
+			Model:    json.RawMessage(`{"name":"cars"}`),
+		},
+		Options: json.RawMessage(`{"tiling":{"tile_size":640,"overlap":0.2}}`),
+	}
+}
+
+// Workers of releases before envelopes decode the flat layout of version 1
+// with encoding/json and nothing else.
+func TestEncodeVersionLegacy(t *testing.T) {
+	body, err := EncodeVersion(testEnvelope(), VersionLegacy)
+	if err != nil {
+		t.Fatalf("EncodeVersion() error = %v", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if _, ok := fields["version"]; ok {
+		t.Errorf("version 1 body %s has a version field", body)
+	}
+
+	var legacy legacyMessage
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		t.Fatalf("decoding version 1 body: %v", err)
+	}
+	if legacy.JobID != "job-1" || legacy.DedupeKey != "job-1" || legacy.ImageURL != "https://images.example.com/1.jpg" || legacy.Image.ScaleFactor != 0.5 {
+		t.Errorf("version 1 body = %+v", legacy)
+	}
+
+	env, err := Decode(body)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if env.Version != VersionLegacy || env.Job.ID != "job-1" || string(env.Job.Model) != `{"name":"cars"}` || string(env.Options) != `{"tiling":{"tile_size":640,"overlap":0.2}}` {
+		t.Errorf("decoded envelope = %+v", env)
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	body, err := EncodeVersion(testEnvelope(), Version)
+	if err != nil {
+		t.Fatalf("EncodeVersion() error = %v", err)
+	}
+	env, err := Decode(body)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if env.Version != Version || env.User == nil || env.User.ID != "user-1" || env.CreatedAt.IsZero() {
+		t.Errorf("decoded envelope = %+v", env)
+	}
+
+	if _, err := EncodeVersion(testEnvelope(), 3); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("EncodeVersion() with version 3 error = %v, want ErrUnsupportedVersion", err)
+	}
+
+	// Version 1 bodies are held to the rules of the current version.
+	invalid := testEnvelope()
+	invalid.DedupeKey = ""
+	if _, err := EncodeVersion(invalid, VersionLegacy); !errors.Is(err, ErrInvalid) {
+		t.Errorf("EncodeVersion() without dedupe key error = %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,65 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Trace is the W3C trace context (https://www.w3.org/TR/trace-context/) of
+// the request that produced a message, so its processing can be correlated
+// with the request.
+type Trace struct {
+	Parent string `json:"traceparent"`
+	State  string `json:"tracestate,omitempty"`
+}
+
+// TraceFromHeaders returns the trace context of the traceparent and
+// tracestate request headers, or starts a new trace when traceparent is
+// missing or malformed.
+func TraceFromHeaders(traceparent, tracestate string) *Trace {
+	traceparent = strings.ToLower(strings.TrimSpace(traceparent))
+	if validTraceParent(traceparent) {
+		return &Trace{Parent: traceparent, State: strings.TrimSpace(tracestate)}
+	}
+	return NewTrace()
+}
+
+// NewTrace starts a new sampled trace.
+func NewTrace() *Trace {
+	traceID := make([]byte, 16)
+	spanID := make([]byte, 8)
+	rand.Read(traceID)
+	rand.Read(spanID)
+	return &Trace{Parent: "00-" + hex.EncodeToString(traceID) + "-" + hex.EncodeToString(spanID) + "-01"}
+}
+
+// TraceID returns the trace ID, or "" for a nil trace.
+func (t *Trace) TraceID() string {
+	if t == nil || len(t.Parent) < 35 {
+		return ""
+	}
+	return t.Parent[3:35]
+}
+
+// validTraceParent reports whether s is a version 00 traceparent:
+// 00-<32 hex trace ID>-<16 hex parent ID>-<2 hex flags>, IDs not all zeros.
+func validTraceParent(s string) bool {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return false
+	}
+	traceID, parentID, flags := parts[1], parts[2], parts[3]
+	return len(traceID) == 32 && len(parentID) == 16 && len(flags) == 2 &&
+		isLowerHex(traceID+parentID+flags) &&
+		strings.Trim(traceID, "0") != "" && strings.Trim(parentID, "0") != ""
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+// Package outbox defines the rows of the transactional outbox: the events
+// the API and the workers record in the same transaction as the job change
+// they announce. The API's relay publishes them to the job queue afterwards.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event types.
+const (
+	// EventJobCreated announces a new job; its payload is the API's job
+	// message.
+	EventJobCreated = "job.created"
+	// EventJobReplayed sends a message back to the queue unchanged, for a
+	// dead-letter replay or a job requeued by the reaper; its payload is a
+	// ReplayPayload.
+	EventJobReplayed = "job.replayed"
+)
+
+// Event is a row of the outbox table. DedupeKey identifies the event across
+// redeliveries: it travels with the message so consumers can drop copies.
+type Event struct {
+	ID          int64 `gorm:"primaryKey"`
+	EventType   string
+	DedupeKey   string
+	Payload     string `gorm:"type:jsonb"`
+	Attempts    int
+	LastError   *string
+	CreatedAt   time.Time
+	AvailableAt time.Time
+	SentAt      *time.Time
+}
+
+func (Event) TableName() string {
+	return "outbox"
+}
+
+// ReplayPayload carries a message body to publish again unchanged. Body is
+// not necessarily valid JSON, so it is stored base64-encoded.
+type ReplayPayload struct {
+	JobID string `json:"job_id"`
+	Body  []byte `json:"body"`
+}
+
+// Enqueue records an event in tx, to be published once tx commits. An event
+// already recorded under the same dedupe key is kept as is.
+func Enqueue(tx *gorm.DB, eventType, dedupeKey string, payload any) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	now := time.Now()
+	event := Event{
+		EventType:   eventType,
+		DedupeKey:   dedupeKey,
+		Payload:     string(encoded),
+		CreatedAt:   now,
+		AvailableAt: now,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "dedupe_key"}},
+		DoNothing: true,
+	}).Create(&event).Error
+}
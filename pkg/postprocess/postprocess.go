@@ -0,0 +1,110 @@
+// Package postprocess defines the post-processing chain run on detections
+// between inference and storage: its step types, their parameters and their
+// validation. The API validates chains with it when models are registered
+// and images uploaded; the worker validates them again before applying them,
+// so both sides accept exactly the same chains.
+package postprocess
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Step types.
+const (
+	StepNMS           = "nms"
+	StepMinConfidence = "min_confidence"
+	StepArea          = "area"
+	StepRename        = "rename"
+	StepROI           = "roi"
+)
+
+// Step is one stage of the chain. Type selects the stage and which fields
+// it reads:
+//
+//	nms             IoU (default 0.5), ClassAgnostic
+//	min_confidence  Confidence for every class, Classes per class
+//	area            MinArea, MaxArea in square pixels (0 = no bound)
+//	rename          Mapping from model class to stored class
+//	roi             Region, a polygon the box center must fall in
+type Step struct {
+	Type          string             `json:"type"`
+	IoU           float64            `json:"iou,omitempty"`
+	ClassAgnostic bool               `json:"class_agnostic,omitempty"`
+	Confidence    float64            `json:"confidence,omitempty"`
+	Classes       map[string]float64 `json:"classes,omitempty"`
+	MinArea       float64            `json:"min_area,omitempty"`
+	MaxArea       float64            `json:"max_area,omitempty"`
+	Mapping       map[string]string  `json:"mapping,omitempty"`
+	Region        []Point            `json:"region,omitempty"`
+}
+
+// Point is a vertex of a region of interest, in image pixels.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Parse decodes and validates a chain. Unknown fields are rejected so typos
+// do not silently disable a step.
+func Parse(raw json.RawMessage) ([]Step, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	var steps []Step
+	if err := decoder.Decode(&steps); err != nil {
+		return nil, fmt.Errorf("postprocess must be a list of steps: %w", err)
+	}
+	if err := Validate(steps); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// Validate checks that every step has a known type and usable parameters.
+func Validate(steps []Step) error {
+	for i, step := range steps {
+		if err := validateStep(step); err != nil {
+			return fmt.Errorf("postprocess step %d (%s): %w", i, step.Type, err)
+		}
+	}
+	return nil
+}
+
+func validateStep(step Step) error {
+	switch step.Type {
+	case StepNMS:
+		if step.IoU < 0 || step.IoU > 1 {
+			return errors.New("iou must be between 0 and 1")
+		}
+	case StepMinConfidence:
+		if step.Confidence < 0 || step.Confidence > 1 {
+			return errors.New("confidence must be between 0 and 1")
+		}
+		for class, threshold := range step.Classes {
+			if threshold < 0 || threshold > 1 {
+				return fmt.Errorf("confidence of class %q must be between 0 and 1", class)
+			}
+		}
+	case StepArea:
+		if step.MinArea < 0 || step.MaxArea < 0 {
+			return errors.New("areas must not be negative")
+		}
+		if step.MaxArea > 0 && step.MaxArea < step.MinArea {
+			return errors.New("max_area must not be below min_area")
+		}
+	case StepRename:
+		if len(step.Mapping) == 0 {
+			return errors.New("mapping must not be empty")
+		}
+	case StepROI:
+		if len(step.Region) < 3 {
+			return errors.New("region needs at least 3 points")
+		}
+	default:
+		return errors.New("unknown step type")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package postprocess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    int
+		wantErr string
+	}{
+		{name: "empty chain", raw: `[]`},
+		{
+			name: "every step type",
+			raw: `[
+				{"type":"nms","iou":0.4,"class_agnostic":true},
+				{"type":"min_confidence","confidence":0.5,"classes":{"car":0.7}},
+				{"type":"area","min_area":10,"max_area":100},
+				{"type":"rename","mapping":{"car":"vehicle"}},
+				{"type":"roi","region":[{"x":0,"y":0},{"x":10,"y":0},{"x":10,"y":10}]}
+			]`,
+			want: 5,
+		},
+		{name: "nms without iou", raw: `[{"type":"nms"}]`, want: 1},
+		{name: "area without max", raw: `[{"type":"area","min_area":10}]`, want: 1},
+		{name: "not a list", raw: `{"type":"nms"}`, wantErr: "must be a list of steps"},
+		{name: "unknown field", raw: `[{"type":"nms","iuo":0.4}]`, wantErr: "unknown field"},
+		{name: "unknown type", raw: `[{"type":"blur"}]`, wantErr: "step 0 (blur): unknown step type"},
+		{name: "iou above 1", raw: `[{"type":"nms","iou":1.5}]`, wantErr: "iou must be between 0 and 1"},
+		{name: "negative confidence", raw: `[{"type":"min_confidence","confidence":-0.1}]`, wantErr: "confidence must be"},
+		{name: "class confidence above 1", raw: `[{"type":"min_confidence","classes":{"car":2}}]`, wantErr: `class "car"`},
+		{name: "negative area", raw: `[{"type":"area","min_area":-1}]`, wantErr: "must not be negative"},
+		{name: "max below min", raw: `[{"type":"area","min_area":10,"max_area":5}]`, wantErr: "max_area must not be below"},
+		{name: "empty mapping", raw: `[{"type":"rename"}]`, wantErr: "mapping must not be empty"},
+		{name: "region of two points", raw: `[{"type":"roi","region":[{"x":0,"y":0},{"x":1,"y":1}]}]`, wantErr: "at least 3 points"},
+		{name: "index of the bad step", raw: `[{"type":"nms"},{"type":"rename"}]`, wantErr: "step 1 (rename)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := Parse([]byte(tt.raw))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(steps) != tt.want {
+				t.Errorf("Parse() returned %d step(s), want %d", len(steps), tt.want)
+			}
+		})
+	}
+}
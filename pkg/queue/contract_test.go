@@ -0,0 +1,290 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// settleWait is how long a test waits for a message that must not arrive.
+const settleWait = 200 * time.Millisecond
+
+// backend is a queue under test, publisher and consumer alike.
+type backend interface {
+	Publisher
+	Consumer
+}
+
+// newQueue creates an empty queue and returns a function connecting
+// consumers and publishers to it.
+type newQueue func(t *testing.T) func() backend
+
+// backends returns the backends the contract runs against: memory always,
+// Postgres when QUEUE_TEST_DATABASE_URL names a database the tests may
+// create the job_queue table in.
+func backends(t *testing.T) map[string]newQueue {
+	queues := map[string]newQueue{
+		BackendMemory: func(t *testing.T) func() backend {
+			m := NewMemory()
+			t.Cleanup(func() { m.Close() })
+			return func() backend { return m }
+		},
+	}
+	if db := testDB(t); db != nil {
+		queues[BackendPostgres] = func(t *testing.T) func() backend {
+			cfg := testPostgresConfig()
+			return func() backend {
+				q := NewPostgres(db, cfg)
+				t.Cleanup(func() { q.Close() })
+				return q
+			}
+		}
+	}
+	return queues
+}
+
+var (
+	testDBOnce sync.Once
+	testDBConn *gorm.DB
+	testDBErr  error
+)
+
+// testDB connects to QUEUE_TEST_DATABASE_URL and creates the job_queue
+// table, or returns nil when the variable is unset.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("QUEUE_TEST_DATABASE_URL")
+	if dsn == "" {
+		return nil
+	}
+
+	testDBOnce.Do(func() {
+		testDBConn, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if testDBErr != nil {
+			return
+		}
+		migration, err := os.ReadFile("../../migrations/015_create_job_queue.sql")
+		if err != nil {
+			testDBErr = err
+			return
+		}
+		testDBErr = testDBConn.Exec(string(migration)).Error
+	})
+	if testDBErr != nil {
+		t.Fatalf("preparing QUEUE_TEST_DATABASE_URL: %v", testDBErr)
+	}
+	return testDBConn
+}
+
+// testPostgresConfig returns fast settings on a queue of the test's own.
+func testPostgresConfig() Config {
+	return Config{
+		Queue:             fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		Prefetch:          10,
+		PollInterval:      10 * time.Millisecond,
+		VisibilityTimeout: 5 * time.Second,
+		MaxAttempts:       10,
+		MinBackoff:        10 * time.Millisecond,
+		MaxBackoff:        50 * time.Millisecond,
+	}
+}
+
+func consume(t *testing.T, c Consumer) (<-chan Delivery, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	msgs, err := c.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+	return msgs, cancel
+}
+
+func publish(t *testing.T, p Publisher, id, body string) {
+	t.Helper()
+	if err := p.Publish(context.Background(), id, []byte(body)); err != nil {
+		t.Fatalf("Publish(%s) error = %v", id, err)
+	}
+}
+
+func receive(t *testing.T, msgs <-chan Delivery) Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-msgs:
+		if !ok {
+			t.Fatal("deliveries closed, want a message")
+		}
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+		return nil
+	}
+}
+
+func expectNone(t *testing.T, msgs <-chan Delivery) {
+	t.Helper()
+	select {
+	case d, ok := <-msgs:
+		if ok {
+			t.Fatalf("message %s delivered, want none", d.ID())
+		}
+	case <-time.After(settleWait):
+	}
+}
+
+func TestContract(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Run("delivers in order and acks", func(t *testing.T) {
+				q := open(t)()
+				for i := range 3 {
+					publish(t, q, fmt.Sprintf("job-%d", i), fmt.Sprintf("body-%d", i))
+				}
+				msgs, _ := consume(t, q)
+
+				for i := range 3 {
+					d := receive(t, msgs)
+					if d.ID() != fmt.Sprintf("job-%d", i) || string(d.Body()) != fmt.Sprintf("body-%d", i) {
+						t.Errorf("delivery %d = %s %q", i, d.ID(), d.Body())
+					}
+					if err := d.Ack(); err != nil {
+						t.Errorf("Ack() error = %v", err)
+					}
+				}
+				expectNone(t, msgs)
+			})
+
+			t.Run("rejected messages are dropped", func(t *testing.T) {
+				q := open(t)()
+				publish(t, q, "job-1", "body")
+				msgs, _ := consume(t, q)
+
+				if err := receive(t, msgs).Nack(false); err != nil {
+					t.Errorf("Nack(false) error = %v", err)
+				}
+				expectNone(t, msgs)
+			})
+
+			t.Run("requeued messages are delivered again", func(t *testing.T) {
+				q := open(t)()
+				publish(t, q, "job-1", "body")
+				msgs, _ := consume(t, q)
+
+				if err := receive(t, msgs).Nack(true); err != nil {
+					t.Errorf("Nack(true) error = %v", err)
+				}
+				d := receive(t, msgs)
+				if d.ID() != "job-1" || string(d.Body()) != "body" {
+					t.Errorf("redelivery = %s %q, want job-1 \"body\"", d.ID(), d.Body())
+				}
+				d.Ack()
+			})
+
+			t.Run("a delivery is settled once", func(t *testing.T) {
+				q := open(t)()
+				publish(t, q, "job-1", "body")
+				msgs, _ := consume(t, q)
+
+				d := receive(t, msgs)
+				if err := d.Ack(); err != nil {
+					t.Fatalf("Ack() error = %v", err)
+				}
+				if err := d.Ack(); !errors.Is(err, ErrSettled) {
+					t.Errorf("second Ack() error = %v, want ErrSettled", err)
+				}
+				if err := d.Nack(true); !errors.Is(err, ErrSettled) {
+					t.Errorf("Nack() after Ack() error = %v, want ErrSettled", err)
+				}
+				expectNone(t, msgs)
+			})
+
+			t.Run("close returns unsettled deliveries", func(t *testing.T) {
+				connect := open(t)
+				first := connect()
+				publish(t, first, "job-1", "body")
+				msgs, cancel := consume(t, first)
+
+				receive(t, msgs)
+				cancel()
+				if err := first.Close(); err != nil {
+					t.Fatalf("Close() error = %v", err)
+				}
+
+				second := connect()
+				d := receive(t, mustConsume(t, second))
+				if d.ID() != "job-1" {
+					t.Errorf("delivery after Close = %s, want job-1", d.ID())
+				}
+				d.Ack()
+			})
+
+			t.Run("each message goes to one consumer", func(t *testing.T) {
+				connect := open(t)
+				publisher := connect()
+				const total = 20
+				for i := range total {
+					publish(t, publisher, fmt.Sprintf("job-%02d", i), "body")
+				}
+
+				var (
+					mu   sync.Mutex
+					seen []string
+					wg   sync.WaitGroup
+				)
+				all, stop := make(chan struct{}), make(chan struct{})
+				var allOnce sync.Once
+				for range 2 {
+					msgs := mustConsume(t, connect())
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for {
+							select {
+							case <-stop:
+								return
+							case d := <-msgs:
+								mu.Lock()
+								seen = append(seen, d.ID())
+								if len(seen) == total {
+									allOnce.Do(func() { close(all) })
+								}
+								mu.Unlock()
+								d.Ack()
+							}
+						}
+					}()
+				}
+
+				select {
+				case <-all:
+					// Duplicates would arrive after the last expected message.
+					time.Sleep(settleWait)
+				case <-time.After(10 * time.Second):
+				}
+				close(stop)
+				wg.Wait()
+
+				slices.Sort(seen)
+				distinct := len(slices.Compact(slices.Clone(seen)))
+				if len(seen) != total || distinct != total {
+					t.Errorf("consumers saw %d message(s), %d distinct, want %d", len(seen), distinct, total)
+				}
+			})
+		})
+	}
+}
+
+func mustConsume(t *testing.T, c Consumer) <-chan Delivery {
+	t.Helper()
+	msgs, _ := consume(t, c)
+	return msgs
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is an in-process queue, both publisher and consumer. Deliveries
+// are settled like those of the other backends, so code using it behaves
+// as it would against a broker.
+type Memory struct {
+	mu       sync.Mutex
+	pending  []*memoryDelivery
+	inFlight map[*memoryDelivery]struct{}
+	signal   chan struct{}
+}
+
+var (
+	_ Publisher = (*Memory)(nil)
+	_ Consumer  = (*Memory)(nil)
+)
+
+// NewMemory creates an empty in-memory queue.
+func NewMemory() *Memory {
+	return &Memory{inFlight: make(map[*memoryDelivery]struct{}), signal: make(chan struct{}, 1)}
+}
+
+// Publish implements Publisher.
+func (m *Memory) Publish(ctx context.Context, id string, body []byte) error {
+	m.push(&memoryDelivery{queue: m, id: id, body: append([]byte(nil), body...)})
+	return nil
+}
+
+// Consume implements Consumer. Several consumers may share the queue; each
+// message goes to one of them.
+func (m *Memory) Consume(ctx context.Context) (<-chan Delivery, error) {
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		for {
+			d := m.pop()
+			if d == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-m.signal:
+					continue
+				}
+			}
+
+			select {
+			case out <- d:
+			case <-ctx.Done():
+				m.settle(d, true)
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Len returns the number of messages waiting to be delivered.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.pending)
+}
+
+// Close implements Consumer and Publisher: unsettled deliveries go back
+// to the queue.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	inFlight := make([]*memoryDelivery, 0, len(m.inFlight))
+	for d := range m.inFlight {
+		inFlight = append(inFlight, d)
+	}
+	m.mu.Unlock()
+
+	for _, d := range inFlight {
+		m.settle(d, true)
+	}
+	return nil
+}
+
+func (m *Memory) push(d *memoryDelivery) {
+	m.mu.Lock()
+	m.pending = append(m.pending, d)
+	m.mu.Unlock()
+
+	select {
+	case m.signal <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes the oldest pending message, or returns nil.
+func (m *Memory) pop() *memoryDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.pending) == 0 {
+		return nil
+	}
+	d := m.pending[0]
+	m.pending = m.pending[1:]
+	m.inFlight[d] = struct{}{}
+	return d
+}
+
+// settle removes d from the deliveries in flight, putting it back in the
+// queue when requeue is set. It fails when d was already settled.
+func (m *Memory) settle(d *memoryDelivery, requeue bool) error {
+	m.mu.Lock()
+	_, ok := m.inFlight[d]
+	delete(m.inFlight, d)
+	m.mu.Unlock()
+
+	if !ok {
+		return ErrSettled
+	}
+	if requeue {
+		// A fresh delivery, so the settled one cannot be settled again.
+		m.push(&memoryDelivery{queue: m, id: d.id, body: d.body})
+	}
+	return nil
+}
+
+type memoryDelivery struct {
+	queue *Memory
+	id    string
+	body  []byte
+}
+
+func (d *memoryDelivery) ID() string   { return d.id }
+func (d *memoryDelivery) Body() []byte { return d.body }
+
+func (d *memoryDelivery) Ack() error {
+	return d.queue.settle(d, false)
+}
+
+func (d *memoryDelivery) Nack(requeue bool) error {
+	return d.queue.settle(d, requeue)
+}
@@ -0,0 +1,321 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrLeaseLost is returned when settling a Postgres delivery whose
+// visibility timeout ran out: the message was or will be delivered again.
+var ErrLeaseLost = errors.New("delivery lease lost")
+
+// releaseTimeout bounds the statements that settle deliveries outside of a
+// consumer's context: requeues, dead letters and the releases of Close.
+const releaseTimeout = 5 * time.Second
+
+// Postgres is a queue in the job_queue table, both publisher and consumer.
+// Consumers claim rows with FOR UPDATE SKIP LOCKED and hide them for the
+// visibility timeout, which they keep extending while the messages are in
+// flight. If a consumer dies, its messages become visible again and are
+// delivered to another one. The attempt count of a row doubles as the lease
+// of the consumer that claimed it last.
+//
+// Requeued messages stay hidden for a backoff that grows with their attempts.
+// A message requeued on its last attempt, or found visible again after it
+// because its consumers kept dying, is dead-lettered instead, like RabbitMQ
+// does for quorum queues with a delivery limit.
+type Postgres struct {
+	db  *gorm.DB
+	cfg Config
+
+	mu       sync.Mutex
+	inFlight map[int64]*postgresDelivery
+	settled  chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+var (
+	_ Publisher = (*Postgres)(nil)
+	_ Consumer  = (*Postgres)(nil)
+)
+
+// NewPostgres creates a queue named cfg.Queue in db.
+func NewPostgres(db *gorm.DB, cfg Config) *Postgres {
+	cfg = cfg.WithDefaults()
+	return &Postgres{
+		db:       db,
+		cfg:      cfg,
+		inFlight: make(map[int64]*postgresDelivery),
+		settled:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Publish implements Publisher. The message is committed when it returns.
+func (q *Postgres) Publish(ctx context.Context, id string, body []byte) error {
+	return q.db.WithContext(ctx).Exec(
+		`INSERT INTO job_queue (queue, message_id, body) VALUES (?, ?, ?)`,
+		q.cfg.Queue, id, body,
+	).Error
+}
+
+// Consume implements Consumer. At most Prefetch deliveries are unsettled at
+// a time.
+func (q *Postgres) Consume(ctx context.Context) (<-chan Delivery, error) {
+	out := make(chan Delivery)
+	go q.extendLeases()
+	go func() {
+		defer close(out)
+		for ctx.Err() == nil {
+			free := q.cfg.Prefetch - q.inFlightCount()
+			if free <= 0 {
+				q.wait(ctx, nil)
+				continue
+			}
+
+			claimed, err := q.claim(ctx, free)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("[QUEUE] - Failed to claim messages: %v", err)
+				}
+				q.wait(ctx, time.After(q.cfg.PollInterval))
+				continue
+			}
+			if len(claimed) == 0 {
+				q.wait(ctx, time.After(q.cfg.PollInterval))
+				continue
+			}
+
+			for i, d := range claimed {
+				select {
+				case out <- d:
+				case <-ctx.Done():
+					for _, rest := range claimed[i:] {
+						rest.release(0, true)
+					}
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// wait blocks until ctx is done, a delivery is settled or timeout fires.
+func (q *Postgres) wait(ctx context.Context, timeout <-chan time.Time) {
+	select {
+	case <-ctx.Done():
+	case <-q.settled:
+	case <-timeout:
+	}
+}
+
+// claim hides up to limit visible messages for the visibility timeout and
+// returns them as deliveries. Messages past their last attempt are
+// dead-lettered instead.
+func (q *Postgres) claim(ctx context.Context, limit int) ([]*postgresDelivery, error) {
+	var rows []struct {
+		ID        int64
+		MessageID string
+		Body      []byte
+		Attempts  int
+	}
+	if err := q.db.WithContext(ctx).Raw(`
+		UPDATE job_queue
+		SET attempts = attempts + 1, visible_at = now() + make_interval(secs => ?)
+		WHERE id IN (
+			SELECT id FROM job_queue
+			WHERE queue = ? AND visible_at <= now()
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, message_id, body, attempts`,
+		q.cfg.VisibilityTimeout.Seconds(), q.cfg.Queue, limit,
+	).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*postgresDelivery, 0, len(rows))
+	for _, row := range rows {
+		d := &postgresDelivery{queue: q, id: row.ID, messageID: row.MessageID, body: row.Body, lease: row.Attempts}
+		if d.lease > q.cfg.MaxAttempts {
+			if err := q.deadLetter(ctx, d); err != nil {
+				log.Printf("[QUEUE] - %v", err)
+			}
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	q.mu.Lock()
+	for _, d := range deliveries {
+		q.inFlight[d.id] = d
+	}
+	q.mu.Unlock()
+	return deliveries, nil
+}
+
+// deadLetter hands d to the DeadLetter hook and removes its message from the
+// queue. When the hook fails, the message stays hidden until its visibility
+// timeout runs out and is dead-lettered again on its next claim.
+func (q *Postgres) deadLetter(ctx context.Context, d *postgresDelivery) error {
+	if q.cfg.DeadLetter == nil {
+		log.Printf("[QUEUE] - Dropping message %s after %d attempts", d.messageID, d.lease)
+	} else if err := q.cfg.DeadLetter(ctx, d.messageID, d.body, d.lease); err != nil {
+		return fmt.Errorf("failed to dead-letter message %s after %d attempts: %w", d.messageID, d.lease, err)
+	}
+	return d.exec(ctx, `DELETE FROM job_queue WHERE id = ? AND attempts = ?`, d.id, d.lease)
+}
+
+// extendLeases pushes back the visibility timeout of the deliveries in
+// flight, three times per timeout, until Close.
+func (q *Postgres) extendLeases() {
+	ticker := time.NewTicker(q.cfg.VisibilityTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+
+		q.mu.Lock()
+		deliveries := make([]*postgresDelivery, 0, len(q.inFlight))
+		for _, d := range q.inFlight {
+			deliveries = append(deliveries, d)
+		}
+		q.mu.Unlock()
+
+		for _, d := range deliveries {
+			if err := d.exec(context.Background(),
+				`UPDATE job_queue SET visible_at = now() + make_interval(secs => ?) WHERE id = ? AND attempts = ?`,
+				q.cfg.VisibilityTimeout.Seconds(), d.id, d.lease,
+			); err != nil && !errors.Is(err, ErrLeaseLost) {
+				log.Printf("[QUEUE] - Failed to extend lease of message %s: %v", d.messageID, err)
+			}
+		}
+	}
+}
+
+func (q *Postgres) inFlightCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.inFlight)
+}
+
+// settle removes d from the deliveries in flight, failing when it was
+// already settled.
+func (q *Postgres) settle(d *postgresDelivery) error {
+	q.mu.Lock()
+	_, ok := q.inFlight[d.id]
+	delete(q.inFlight, d.id)
+	q.mu.Unlock()
+
+	if !ok {
+		return ErrSettled
+	}
+	select {
+	case q.settled <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Close implements Consumer and Publisher: it stops extending leases and
+// makes the unsettled deliveries visible again right away.
+func (q *Postgres) Close() error {
+	q.stopOnce.Do(func() { close(q.stop) })
+
+	q.mu.Lock()
+	deliveries := make([]*postgresDelivery, 0, len(q.inFlight))
+	for _, d := range q.inFlight {
+		deliveries = append(deliveries, d)
+	}
+	q.mu.Unlock()
+
+	var errs []error
+	for _, d := range deliveries {
+		if err := d.release(0, false); err != nil && !errors.Is(err, ErrSettled) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type postgresDelivery struct {
+	queue     *Postgres
+	id        int64
+	messageID string
+	body      []byte
+	lease     int
+}
+
+func (d *postgresDelivery) ID() string   { return d.messageID }
+func (d *postgresDelivery) Body() []byte { return d.body }
+
+func (d *postgresDelivery) Ack() error {
+	if err := d.queue.settle(d); err != nil {
+		return err
+	}
+	return d.exec(context.Background(), `DELETE FROM job_queue WHERE id = ? AND attempts = ?`, d.id, d.lease)
+}
+
+// Nack drops the message, or requeues it after a backoff. Requeuing it on its
+// last attempt dead-letters it.
+func (d *postgresDelivery) Nack(requeue bool) error {
+	if !requeue {
+		return d.Ack()
+	}
+	if d.lease < d.queue.cfg.MaxAttempts {
+		return d.release(d.queue.cfg.Backoff(d.lease), false)
+	}
+
+	if err := d.queue.settle(d); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	return d.queue.deadLetter(ctx, d)
+}
+
+// release settles d and makes its message visible again after delay. A
+// refunded attempt, for a message that was claimed but never handed out,
+// does not count towards MaxAttempts.
+func (d *postgresDelivery) release(delay time.Duration, refund bool) error {
+	if err := d.queue.settle(d); err != nil {
+		return err
+	}
+
+	refunded := 0
+	if refund {
+		refunded = 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	return d.exec(ctx,
+		`UPDATE job_queue SET visible_at = now() + make_interval(secs => ?), attempts = attempts - ? WHERE id = ? AND attempts = ?`,
+		delay.Seconds(), refunded, d.id, d.lease,
+	)
+}
+
+// exec runs a statement on the row of d, reporting ErrLeaseLost when the
+// row was claimed again or is gone.
+func (d *postgresDelivery) exec(ctx context.Context, sql string, values ...any) error {
+	result := d.queue.db.WithContext(ctx).Exec(sql, values...)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: message %s", ErrLeaseLost, d.messageID)
+	}
+	return nil
+}
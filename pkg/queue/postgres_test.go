@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// postgresQueue returns a Postgres queue of the test's own, skipping the
+// test when QUEUE_TEST_DATABASE_URL is unset.
+func postgresQueue(t *testing.T, cfg Config) (*Postgres, *gorm.DB) {
+	t.Helper()
+	db := testDB(t)
+	if db == nil {
+		t.Skip("QUEUE_TEST_DATABASE_URL is not set")
+	}
+	q := NewPostgres(db, cfg)
+	t.Cleanup(func() { q.Close() })
+	return q, db
+}
+
+// expireLeases makes every message of cfg.Queue visible, as if its
+// consumer had died.
+func expireLeases(t *testing.T, db *gorm.DB, cfg Config) {
+	t.Helper()
+	if err := db.Exec(`UPDATE job_queue SET visible_at = now() WHERE queue = ?`, cfg.Queue).Error; err != nil {
+		t.Fatalf("expiring leases: %v", err)
+	}
+}
+
+func TestPostgresClaimHidesMessages(t *testing.T) {
+	cfg := testPostgresConfig()
+	first, db := postgresQueue(t, cfg)
+	second := NewPostgres(db, cfg)
+	t.Cleanup(func() { second.Close() })
+
+	publish(t, first, "job-1", "body")
+	d := receive(t, mustConsume(t, first))
+	// The lease of the first consumer is extended while it holds the
+	// message, well within the visibility timeout.
+	expectNone(t, mustConsume(t, second))
+	d.Ack()
+}
+
+func TestPostgresLeaseLost(t *testing.T) {
+	cfg := testPostgresConfig()
+	// Long enough for no lease extension to run during the test.
+	cfg.VisibilityTimeout = time.Minute
+	first, db := postgresQueue(t, cfg)
+	second := NewPostgres(db, cfg)
+	t.Cleanup(func() { second.Close() })
+
+	publish(t, first, "job-1", "body")
+	msgs, stopFirst := consume(t, first)
+	stale := receive(t, msgs)
+	stopFirst()
+
+	expireLeases(t, db, cfg)
+	current := receive(t, mustConsume(t, second))
+	if current.ID() != "job-1" {
+		t.Fatalf("redelivery = %s, want job-1", current.ID())
+	}
+
+	// The attempt count fences off the consumer whose lease expired.
+	if err := stale.Ack(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Ack() with an expired lease error = %v, want ErrLeaseLost", err)
+	}
+	if err := current.Ack(); err != nil {
+		t.Errorf("Ack() error = %v", err)
+	}
+}
+
+// deadLetters records the messages handed to Config.DeadLetter.
+type deadLetters struct {
+	mu       sync.Mutex
+	ids      []string
+	attempts []int
+}
+
+func (l *deadLetters) record(_ context.Context, id string, _ []byte, attempts int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ids = append(l.ids, id)
+	l.attempts = append(l.attempts, attempts)
+	return nil
+}
+
+func (l *deadLetters) wait(t *testing.T) ([]string, []int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		if len(l.ids) > 0 {
+			defer l.mu.Unlock()
+			return l.ids, l.attempts
+		}
+		l.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no message dead-lettered")
+	return nil, nil
+}
+
+func queueLength(t *testing.T, db *gorm.DB, cfg Config) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Raw(`SELECT count(*) FROM job_queue WHERE queue = ?`, cfg.Queue).Scan(&count).Error; err != nil {
+		t.Fatalf("counting messages: %v", err)
+	}
+	return count
+}
+
+func TestPostgresRequeueDeadLettersAfterMaxAttempts(t *testing.T) {
+	var letters deadLetters
+	cfg := testPostgresConfig()
+	cfg.MaxAttempts = 2
+	cfg.DeadLetter = letters.record
+	q, db := postgresQueue(t, cfg)
+
+	publish(t, q, "job-1", "body")
+	msgs := mustConsume(t, q)
+
+	start := time.Now()
+	if err := receive(t, msgs).Nack(true); err != nil {
+		t.Fatalf("first Nack(true) error = %v", err)
+	}
+	d := receive(t, msgs)
+	if waited := time.Since(start); waited < cfg.MinBackoff {
+		t.Errorf("requeued message delivered after %s, want at least %s", waited, cfg.MinBackoff)
+	}
+	if err := d.Nack(true); err != nil {
+		t.Fatalf("second Nack(true) error = %v", err)
+	}
+
+	ids, attempts := letters.wait(t)
+	if len(ids) != 1 || ids[0] != "job-1" || attempts[0] != 2 {
+		t.Errorf("dead letters = %v after %v attempt(s), want job-1 after 2", ids, attempts)
+	}
+	expectNone(t, msgs)
+	if n := queueLength(t, db, cfg); n != 0 {
+		t.Errorf("%d message(s) left in the queue, want 0", n)
+	}
+}
+
+func TestPostgresClaimDeadLettersAfterMaxAttempts(t *testing.T) {
+	var letters deadLetters
+	cfg := testPostgresConfig()
+	cfg.MaxAttempts = 2
+	cfg.DeadLetter = letters.record
+	q, db := postgresQueue(t, cfg)
+
+	publish(t, q, "job-1", "body")
+	// Two consumers died holding the message.
+	if err := db.Exec(`UPDATE job_queue SET attempts = 2 WHERE queue = ?`, cfg.Queue).Error; err != nil {
+		t.Fatalf("setting attempts: %v", err)
+	}
+
+	msgs := mustConsume(t, q)
+	ids, attempts := letters.wait(t)
+	if len(ids) != 1 || ids[0] != "job-1" || attempts[0] != 3 {
+		t.Errorf("dead letters = %v after %v attempt(s), want job-1 after 3", ids, attempts)
+	}
+	expectNone(t, msgs)
+	if n := queueLength(t, db, cfg); n != 0 {
+		t.Errorf("%d message(s) left in the queue, want 0", n)
+	}
+}
+
+func TestPostgresDeadLetterFailureKeepsMessage(t *testing.T) {
+	cfg := testPostgresConfig()
+	cfg.MaxAttempts = 1
+	cfg.DeadLetter = func(context.Context, string, []byte, int) error { return errors.New("database down") }
+	q, db := postgresQueue(t, cfg)
+
+	publish(t, q, "job-1", "body")
+	if err := receive(t, mustConsume(t, q)).Nack(true); err == nil {
+		t.Error("Nack(true) error = nil, want the dead letter failure")
+	}
+	if n := queueLength(t, db, cfg); n != 1 {
+		t.Errorf("%d message(s) left in the queue, want 1", n)
+	}
+}
@@ -0,0 +1,216 @@
+// Package queue abstracts the job queue between the API and the workers.
+// Messages are opaque bodies identified by their job ID; the transport is
+// RabbitMQ, a Postgres table, or memory for tests and single-process runs.
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values for Config.Backend.
+const (
+	// BackendRabbitMQ queues jobs in RabbitMQ (RABBITMQ_URL).
+	BackendRabbitMQ = "rabbitmq"
+	// BackendPostgres queues jobs in the job_queue table of the database.
+	BackendPostgres = "postgres"
+	// BackendMemory queues jobs in the process. Nothing reaches another
+	// process, so it only suits tests.
+	BackendMemory = "memory"
+)
+
+const (
+	defaultQueue             = "jobs"
+	defaultPollInterval      = time.Second
+	defaultVisibilityTimeout = 5 * time.Minute
+	defaultMaxAttempts       = 10
+	defaultMinBackoff        = time.Second
+	defaultMaxBackoff        = 5 * time.Minute
+)
+
+// ErrSettled is returned when a delivery is acknowledged or rejected twice.
+var ErrSettled = errors.New("delivery already settled")
+
+// Publisher sends messages to the job queue. Publish returns once the queue
+// has taken responsibility for the message.
+type Publisher interface {
+	Publish(ctx context.Context, id string, body []byte) error
+	Close() error
+}
+
+// Delivery is a message handed to a consumer. It must be settled once, with
+// Ack or Nack; until then no other consumer receives it.
+type Delivery interface {
+	// ID is the message ID given to Publish.
+	ID() string
+	Body() []byte
+	// Ack removes the message from the queue.
+	Ack() error
+	// Nack puts the message back in the queue to be delivered again when
+	// requeue is true, and drops it otherwise.
+	Nack(requeue bool) error
+}
+
+// Consumer receives messages from the job queue.
+type Consumer interface {
+	// Consume returns the deliveries of the queue. Cancelling ctx stops
+	// the deliveries and closes the channel, but deliveries already handed
+	// out can still be settled until Close.
+	Consume(ctx context.Context) (<-chan Delivery, error)
+	// Close puts the deliveries not settled yet back in the queue.
+	Close() error
+}
+
+// Config selects and tunes the queue backend.
+type Config struct {
+	Backend string
+	// AllowMemory permits BackendMemory, which is refused otherwise so that
+	// a deployment cannot end up with an API and workers that never meet.
+	AllowMemory bool
+	// Queue names the queue; publishers and consumers must agree on it.
+	Queue string
+	// Prefetch caps the deliveries a consumer holds unsettled.
+	Prefetch int
+	// PollInterval is how often the Postgres backend looks for messages
+	// while the queue is empty.
+	PollInterval time.Duration
+	// VisibilityTimeout is how long a Postgres delivery stays hidden from
+	// other consumers. Consumers extend it while the message is processed,
+	// so it only runs out when the consumer died.
+	VisibilityTimeout time.Duration
+	// MaxAttempts caps the deliveries of a message. A message requeued on
+	// its last attempt is handed to DeadLetter and removed from the queue.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound how long a requeued message waits
+	// before it is delivered again: the delay starts at MinBackoff and
+	// doubles with every attempt.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// DeadLetter records the messages that ran out of attempts. When nil
+	// they are logged and dropped.
+	DeadLetter DeadLetterFunc
+}
+
+// Validate rejects settings a process must not start with.
+func (cfg Config) Validate() error {
+	if cfg.Backend == BackendMemory && !cfg.AllowMemory {
+		return errors.New("the memory job queue is not shared between processes, so jobs would never be processed; set QUEUE_ALLOW_MEMORY=true to use it for tests or local experiments")
+	}
+	return nil
+}
+
+// WithDefaults returns cfg with its unset settings at their defaults.
+func (cfg Config) WithDefaults() Config {
+	if cfg.Queue == "" {
+		cfg.Queue = defaultQueue
+	}
+	if cfg.Prefetch <= 0 {
+		cfg.Prefetch = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	return cfg
+}
+
+// Backoff returns how long a message requeued on its given attempt waits
+// before it is delivered again.
+func (cfg Config) Backoff(attempts int) time.Duration {
+	delay := cfg.MinBackoff
+	for i := 1; i < attempts && delay < cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, cfg.MaxBackoff)
+}
+
+// DeadLetterFunc records a message given up on after attempts deliveries.
+// The message stays in the queue when it fails.
+type DeadLetterFunc func(ctx context.Context, id string, body []byte, attempts int) error
+
+// ConfigFromEnv reads QUEUE_BACKEND ("rabbitmq", "postgres" or "memory"),
+// QUEUE_NAME (default: RABBITMQ_QUEUE, then "jobs"), QUEUE_POLL_INTERVAL,
+// QUEUE_VISIBILITY_TIMEOUT, QUEUE_MAX_ATTEMPTS, QUEUE_MIN_BACKOFF,
+// QUEUE_MAX_BACKOFF and QUEUE_ALLOW_MEMORY.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:           strings.ToLower(os.Getenv("QUEUE_BACKEND")),
+		AllowMemory:       os.Getenv("QUEUE_ALLOW_MEMORY") == "true",
+		Queue:             os.Getenv("QUEUE_NAME"),
+		PollInterval:      defaultPollInterval,
+		VisibilityTimeout: defaultVisibilityTimeout,
+		MaxAttempts:       defaultMaxAttempts,
+		MinBackoff:        defaultMinBackoff,
+		MaxBackoff:        defaultMaxBackoff,
+	}
+
+	switch cfg.Backend {
+	case "":
+		cfg.Backend = BackendRabbitMQ
+	case BackendRabbitMQ, BackendPostgres, BackendMemory:
+	default:
+		log.Printf("[WARNING] - Invalid QUEUE_BACKEND %q, using %s", cfg.Backend, BackendRabbitMQ)
+		cfg.Backend = BackendRabbitMQ
+	}
+
+	if cfg.Queue == "" {
+		cfg.Queue = os.Getenv("RABBITMQ_QUEUE")
+	}
+	if cfg.Queue == "" {
+		cfg.Queue = defaultQueue
+	}
+
+	if raw := os.Getenv("QUEUE_POLL_INTERVAL"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.PollInterval = value
+		} else {
+			log.Printf("[WARNING] - Invalid QUEUE_POLL_INTERVAL %q, using %s", raw, defaultPollInterval)
+		}
+	}
+	if raw := os.Getenv("QUEUE_VISIBILITY_TIMEOUT"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.VisibilityTimeout = value
+		} else {
+			log.Printf("[WARNING] - Invalid QUEUE_VISIBILITY_TIMEOUT %q, using %s", raw, defaultVisibilityTimeout)
+		}
+	}
+	if raw := os.Getenv("QUEUE_MAX_ATTEMPTS"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			cfg.MaxAttempts = value
+		} else {
+			log.Printf("[WARNING] - Invalid QUEUE_MAX_ATTEMPTS %q, using %d", raw, defaultMaxAttempts)
+		}
+	}
+	if raw := os.Getenv("QUEUE_MIN_BACKOFF"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.MinBackoff = value
+		} else {
+			log.Printf("[WARNING] - Invalid QUEUE_MIN_BACKOFF %q, using %s", raw, defaultMinBackoff)
+		}
+	}
+	if raw := os.Getenv("QUEUE_MAX_BACKOFF"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.MaxBackoff = value
+		} else {
+			log.Printf("[WARNING] - Invalid QUEUE_MAX_BACKOFF %q, using %s", raw, defaultMaxBackoff)
+		}
+	}
+
+	return cfg
+}
@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	cfg := Config{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{1000, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := cfg.Backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestConfigFromEnvRetries(t *testing.T) {
+	t.Setenv("QUEUE_MAX_ATTEMPTS", "3")
+	t.Setenv("QUEUE_MIN_BACKOFF", "2s")
+	t.Setenv("QUEUE_MAX_BACKOFF", "30s")
+	if cfg := ConfigFromEnv(); cfg.MaxAttempts != 3 || cfg.MinBackoff != 2*time.Second || cfg.MaxBackoff != 30*time.Second {
+		t.Errorf("MaxAttempts, MinBackoff, MaxBackoff = %d, %s, %s, want 3, 2s, 30s", cfg.MaxAttempts, cfg.MinBackoff, cfg.MaxBackoff)
+	}
+
+	t.Setenv("QUEUE_MAX_ATTEMPTS", "0")
+	t.Setenv("QUEUE_MIN_BACKOFF", "-1s")
+	t.Setenv("QUEUE_MAX_BACKOFF", "soon")
+	if cfg := ConfigFromEnv(); cfg.MaxAttempts != defaultMaxAttempts || cfg.MinBackoff != defaultMinBackoff || cfg.MaxBackoff != defaultMaxBackoff {
+		t.Errorf("MaxAttempts, MinBackoff, MaxBackoff = %d, %s, %s, want the defaults", cfg.MaxAttempts, cfg.MinBackoff, cfg.MaxBackoff)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "rabbitmq", cfg: Config{Backend: BackendRabbitMQ}},
+		{name: "postgres", cfg: Config{Backend: BackendPostgres}},
+		{name: "memory", cfg: Config{Backend: BackendMemory}, wantErr: true},
+		{name: "memory, allowed", cfg: Config{Backend: BackendMemory, AllowMemory: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
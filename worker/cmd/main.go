@@ -9,11 +9,21 @@ import (
 	"os/signal"
 	"syscall"
 
+	"govision/worker/internal/cache"
+	"govision/worker/internal/detector"
+	"govision/worker/internal/domain"
+	"govision/worker/internal/metrics"
+	"govision/worker/internal/ratelimit"
+	"govision/worker/internal/reaper"
+	"govision/worker/internal/registry"
 	"govision/worker/internal/repository/postgres"
 	"govision/worker/internal/services/rabbitmq"
-	"govision/worker/internal/services/roboflow"
+	"govision/worker/internal/tiling"
 	"govision/worker/internal/worker"
 
+	"govision/pkg/amqpconn"
+	"govision/pkg/queue"
+
 	pgconn "govision/worker/internal/services/postgres"
 
 	"github.com/joho/godotenv"
@@ -23,20 +33,17 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds | log.Lshortfile)
 
 	_ = godotenv.Load()
-	rabbitConnString := os.Getenv("RABBITMQ_URL")
-	rabbitQueueString := os.Getenv("RABBITMQ_QUEUE")
-	roboflowAPIKey := os.Getenv("ROBOFLOW_API_KEY")
-	roboflowModel := os.Getenv("ROBOFLOW_MODEL")
 	databaseURL := os.Getenv("DATABASE_URL")
+	queueConfig := queue.ConfigFromEnv()
 
-	if rabbitConnString == "" || rabbitQueueString == "" {
-		log.Printf("[ERROR] - Environment variables not found.")
-		panic(errors.New("environment variables not found"))
+	if err := queueConfig.Validate(); err != nil {
+		log.Printf("[ERROR] - Invalid job queue configuration: %v", err)
+		panic(err)
 	}
 
-	if roboflowAPIKey == "" || roboflowModel == "" {
-		log.Printf("[ERROR] - Roboflow environment variables not found.")
-		panic(errors.New("ROBOFLOW_API_KEY and ROBOFLOW_MODEL must be set"))
+	if queueConfig.Backend == queue.BackendRabbitMQ && os.Getenv("RABBITMQ_URL") == "" {
+		log.Printf("[ERROR] - Environment variables not found.")
+		panic(errors.New("environment variables not found"))
 	}
 
 	if databaseURL == "" {
@@ -61,38 +68,115 @@ func main() {
 	// Repository
 	predictionRepo := postgres.NewPredictionRepository(db)
 
-	// RabbitMQ connection
-	rabbitMQConnection, err := rabbitmq.NewRabbittMQConnection(rabbitConnString)
-	if err != nil {
-		log.Printf("[ERROR] - RabbitMQ connection error: %v", err)
-		panic(err)
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		go metrics.Serve(ctx, addr)
+	}
+
+	// Detectors
+	detectorConfig := detector.ConfigFromEnv()
+	if limitConfig := ratelimit.ConfigFromEnv(); limitConfig.Enabled() {
+		var store ratelimit.Store = postgres.NewRateLimitRepository(db)
+		if limitConfig.Backend == ratelimit.BackendMemory {
+			store = ratelimit.NewMemoryStore()
+		}
+		detectorConfig.Limiter, err = ratelimit.New(limitConfig, store)
+		if err != nil {
+			log.Printf("[ERROR] - Rate limiter configuration error: %v", err)
+			panic(err)
+		}
+		effective := detectorConfig.Limiter.Config()
+		log.Printf("[WORKER] - Rate limit: %g call(s)/s, burst %g, bucket %q (%s)",
+			effective.Rate, effective.Burst, effective.Bucket, limitConfig.Backend)
 	}
-	defer rabbitMQConnection.Close()
 
-	ch, err := rabbitMQConnection.Channel()
+	detectors, err := detector.NewRegistry(detectorConfig)
 	if err != nil {
-		log.Printf("[ERROR] - RabbitMQ channel error: %v", err)
+		log.Printf("[ERROR] - Detector configuration error: %v", err)
 		panic(err)
 	}
-	defer ch.Close()
+	log.Printf("[WORKER] - Default model: %s (%s backend)", detectors.DefaultModel().Name, detectorConfig.Backend)
 
 	// Consumer
-	consumer := rabbitmq.NewRabbitMQConsumer(ch, rabbitQueueString)
+	workerConfig := worker.ConfigFromEnv()
+	queueConfig.Prefetch = workerConfig.Prefetch
+	log.Printf("[WORKER] - Job queue backend: %s (queue %q)", queueConfig.Backend, queueConfig.Queue)
+
+	// Messages requeued too often (rate limits, shutdowns) join the other
+	// dead letters.
+	queueConfig.DeadLetter = func(_ context.Context, id string, body []byte, attempts int) error {
+		return predictionRepo.SaveDeadLetter(domain.DeadLetter{
+			JobID:   id,
+			Reason:  domain.ReasonMaxAttempts,
+			Error:   fmt.Sprintf("gave up after %d deliveries", attempts),
+			Payload: body,
+		})
+	}
+
+	var consumer queue.Consumer
+	switch queueConfig.Backend {
+	case queue.BackendPostgres:
+		consumer = queue.NewPostgres(db, queueConfig)
+	case queue.BackendMemory:
+		log.Println("[WARNING] - The memory job queue is not shared with the API, no jobs will arrive")
+		consumer = queue.NewMemory()
+	default:
+		// RabbitMQ connection, re-established whenever the broker goes away.
+		// It outlives ctx so in-flight jobs can still be acknowledged on
+		// shutdown.
+		rabbitMQConnection := amqpconn.New(amqpconn.ConfigFromEnv(), amqpconn.DeclareQueue(queueConfig.Queue))
+		go rabbitMQConnection.Run(context.Background())
+		defer rabbitMQConnection.Close()
+
+		consumer = rabbitmq.NewRabbitMQConsumer(rabbitMQConnection, queueConfig)
+	}
 
 	msgs, err := consumer.Consume(ctx)
 	if err != nil {
+		if ctx.Err() != nil {
+			log.Println("[WORKER] - Stopped before connecting to the job queue")
+			return
+		}
 		log.Printf("[ERROR] - Failed to start consuming: %v", err)
 		panic(err)
 	}
 
-	// Roboflow client
-	rfClient := roboflow.NewClient(roboflowAPIKey, roboflowModel)
-
 	// Worker
-	w := worker.New(rfClient, predictionRepo)
+	var results *cache.Cache
+	if cacheConfig := cache.ConfigFromEnv(); cacheConfig.Enabled {
+		results = cache.New(cacheConfig, postgres.NewCacheRepository(db))
+		go results.RunPurger(ctx)
+		log.Printf("[WORKER] - Result cache enabled (ttl %s, %d in-memory entries)", cacheConfig.TTL, cacheConfig.LRUSize)
+	}
+
+	if reaperConfig := reaper.ConfigFromEnv(); reaperConfig.Enabled {
+		go reaper.New(reaperConfig, postgres.NewReaperRepository(db)).Run(ctx)
+		log.Printf("[WORKER] - Reaper enabled (jobs pending for over %s, %d attempt(s) max)", reaperConfig.StuckAfter, reaperConfig.MaxAttempts)
+	}
+
+	// Registry entry, kept alive until every in-flight job has settled.
+	workerRegistry := registry.New(registry.ConfigFromEnv(), postgres.NewRegistryRepository(db), workerConfig.Concurrency)
+	workerConfig.ID = workerRegistry.ID()
 
-	fmt.Println("Successfully connected to RabbitMQ instance")
+	w := worker.New(detectors, predictionRepo, tiling.New(tiling.ConfigFromEnv()), results, workerConfig)
+
+	registryCtx, stopRegistry := context.WithCancel(context.Background())
+	registryDone := make(chan struct{})
+	go func() {
+		defer close(registryDone)
+		workerRegistry.Run(registryCtx, w)
+	}()
+	log.Printf("[WORKER] - Registered as %s", workerRegistry.ID())
+
+	fmt.Println("Successfully connected to the job queue")
+	fmt.Printf("[*] - Processing up to %d job(s) at once (prefetch %d)\n", workerConfig.Concurrency, workerConfig.Prefetch)
 	fmt.Println("[*] - Waiting for messages")
 
 	w.ProcessMessages(ctx, msgs)
+	stopRegistry()
+	<-registryDone
+
+	if err := consumer.Close(); err != nil {
+		log.Printf("[WARNING] - Failed to close job queue consumer: %v", err)
+	}
+	log.Println("[WORKER] - Shutdown complete")
 }
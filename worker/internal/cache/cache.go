@@ -0,0 +1,272 @@
+// Package cache stores inference results by image content, model and
+// options, so identical requests are answered without calling the model.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"govision/worker/internal/domain"
+)
+
+const (
+	defaultTTL           = 7 * 24 * time.Hour
+	defaultLRUTTL        = 5 * time.Minute
+	defaultPurgeInterval = time.Hour
+)
+
+// ErrNotFound is returned by stores for missing or expired entries.
+var ErrNotFound = errors.New("cache entry not found")
+
+var metrics = expvar.NewMap("cache")
+
+// Entry is a cached inference result. JobID is the job that produced it.
+type Entry struct {
+	Key          string
+	JobID        string
+	ModelName    string
+	ModelVersion string
+	Result       domain.DetectionResult
+	CreatedAt    time.Time
+	ExpiresAt    *time.Time
+}
+
+// Store persists entries.
+type Store interface {
+	// Get returns the live entry for key, or ErrNotFound.
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Put saves entry, replacing any previous entry with the same key.
+	Put(ctx context.Context, entry Entry) error
+	// Purge deletes expired entries and returns how many were removed.
+	Purge(ctx context.Context) (int64, error)
+}
+
+// Config controls the result cache.
+type Config struct {
+	Enabled bool
+	// TTL is how long a result stays valid. Zero keeps results forever.
+	TTL time.Duration
+	// LRUSize is the number of entries kept in memory in front of the
+	// store. Zero disables the in-process layer.
+	LRUSize int
+	// LRUTTL bounds how long the in-process layer serves an entry, and so
+	// how long an entry invalidated in the store may still be used.
+	LRUTTL time.Duration
+	// Namespace is mixed into every key; changing it invalidates all
+	// existing entries at once.
+	Namespace string
+	// PurgeInterval is how often expired entries are deleted.
+	PurgeInterval time.Duration
+}
+
+// ConfigFromEnv reads CACHE_ENABLED, CACHE_TTL ("0" never expires),
+// CACHE_LRU_SIZE, CACHE_LRU_TTL, CACHE_NAMESPACE and CACHE_PURGE_INTERVAL.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		TTL:           defaultTTL,
+		LRUTTL:        defaultLRUTTL,
+		Namespace:     os.Getenv("CACHE_NAMESPACE"),
+		PurgeInterval: defaultPurgeInterval,
+	}
+
+	if raw := os.Getenv("CACHE_ENABLED"); raw != "" {
+		if value, err := strconv.ParseBool(raw); err == nil {
+			cfg.Enabled = value
+		} else {
+			log.Printf("[WARNING] - Invalid CACHE_ENABLED %q, cache disabled", raw)
+		}
+	}
+	if raw := os.Getenv("CACHE_TTL"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value >= 0 {
+			cfg.TTL = value
+		} else {
+			log.Printf("[WARNING] - Invalid CACHE_TTL %q, using %s", raw, defaultTTL)
+		}
+	}
+	if raw := os.Getenv("CACHE_LRU_SIZE"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value >= 0 {
+			cfg.LRUSize = value
+		} else {
+			log.Printf("[WARNING] - Invalid CACHE_LRU_SIZE %q, in-memory cache disabled", raw)
+		}
+	}
+	if raw := os.Getenv("CACHE_LRU_TTL"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.LRUTTL = value
+		} else {
+			log.Printf("[WARNING] - Invalid CACHE_LRU_TTL %q, using %s", raw, defaultLRUTTL)
+		}
+	}
+	if raw := os.Getenv("CACHE_PURGE_INTERVAL"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.PurgeInterval = value
+		} else {
+			log.Printf("[WARNING] - Invalid CACHE_PURGE_INTERVAL %q, using %s", raw, defaultPurgeInterval)
+		}
+	}
+
+	return cfg
+}
+
+// Cache looks up and records inference results.
+type Cache struct {
+	cfg   Config
+	store Store
+	lru   *lru
+}
+
+// New creates a cache over store.
+func New(cfg Config, store Store) *Cache {
+	if cfg.LRUTTL <= 0 {
+		cfg.LRUTTL = defaultLRUTTL
+	}
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = defaultPurgeInterval
+	}
+
+	c := &Cache{cfg: cfg, store: store}
+	if cfg.LRUSize > 0 {
+		c.lru = newLRU(cfg.LRUSize, cfg.LRUTTL)
+	}
+	return c
+}
+
+// Key identifies the result of running model on the image with the given
+// SHA-256 and tiling options. The model's fingerprint covers the effective
+// configuration it runs with, so changing ROBOFLOW_PARAMETERS, the base URL
+// or the task type of the default model does not serve stale results. Model
+// options that do not change the model's output (the post-processing chain
+// and tiling defaults, which are passed resolved) are left out. It returns ""
+// when the image hash is unknown.
+func (c *Cache) Key(imageSHA256 string, model *domain.ModelSpec, tiling *domain.TilingOptions) (string, error) {
+	if imageSHA256 == "" || model == nil {
+		return "", nil
+	}
+
+	var options map[string]json.RawMessage
+	if len(model.Options) > 0 {
+		if err := json.Unmarshal(model.Options, &options); err != nil {
+			return "", fmt.Errorf("invalid model options: %w", err)
+		}
+		delete(options, "postprocess")
+		delete(options, "tiling")
+	}
+
+	// Map keys are marshalled in sorted order, so the encoding is stable.
+	encoded, err := json.Marshal(map[string]any{
+		"namespace": c.cfg.Namespace,
+		"image":     imageSHA256,
+		"provider":  model.Provider,
+		"model_id":  model.ModelID,
+		"endpoint":  model.Endpoint,
+		"version":   model.Version,
+		"task_type": model.TaskType,
+		"options":   options,
+		"config":    model.Fingerprint,
+		"tiling":    tiling,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get returns the cached entry for key. Lookup errors are logged and
+// reported as misses, so a failing cache never fails a job.
+func (c *Cache) Get(ctx context.Context, key string) (*Entry, bool) {
+	if key == "" {
+		return nil, false
+	}
+
+	if c.lru != nil {
+		if entry, ok := c.lru.get(key); ok {
+			metrics.Add("hits", 1)
+			metrics.Add("lru_hits", 1)
+			return entry, true
+		}
+	}
+
+	entry, err := c.store.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("[CACHE] - Lookup of %s failed: %v", key, err)
+			metrics.Add("errors", 1)
+		}
+		metrics.Add("misses", 1)
+		return nil, false
+	}
+
+	if c.lru != nil {
+		c.lru.put(entry)
+	}
+	metrics.Add("hits", 1)
+	return entry, true
+}
+
+// Put records the result produced by jobID. Errors are logged only.
+func (c *Cache) Put(ctx context.Context, key, jobID string, model *domain.ModelSpec, result *domain.DetectionResult) {
+	if key == "" {
+		return
+	}
+
+	entry := Entry{
+		Key:          key,
+		JobID:        jobID,
+		ModelName:    model.Name,
+		ModelVersion: model.Version,
+		Result:       *result,
+		CreatedAt:    time.Now(),
+	}
+	if c.cfg.TTL > 0 {
+		expiresAt := entry.CreatedAt.Add(c.cfg.TTL)
+		entry.ExpiresAt = &expiresAt
+	}
+
+	if err := c.store.Put(ctx, entry); err != nil {
+		log.Printf("[CACHE] - Failed to store result of job %s: %v", jobID, err)
+		metrics.Add("errors", 1)
+		return
+	}
+	if c.lru != nil {
+		c.lru.put(&entry)
+	}
+	metrics.Add("stores", 1)
+}
+
+// RunPurger deletes expired entries every PurgeInterval until ctx is
+// cancelled. Entries without expiry are never purged.
+func (c *Cache) RunPurger(ctx context.Context) {
+	if c.cfg.TTL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := c.store.Purge(ctx)
+			if err != nil {
+				log.Printf("[CACHE] - Purge failed: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("[CACHE] - Purged %d expired result(s)", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"govision/worker/internal/domain"
+)
+
+const imageSHA256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func baseModel() *domain.ModelSpec {
+	return &domain.ModelSpec{
+		Name:        "fruits",
+		Provider:    "roboflow",
+		ModelID:     "fruits/3",
+		Endpoint:    "https://detect.roboflow.com",
+		Version:     "3",
+		TaskType:    "object_detection",
+		Options:     json.RawMessage(`{"confidence":40,"postprocess":[{"type":"nms"}],"tiling":{"tile_size":640}}`),
+		Fingerprint: "env-a",
+	}
+}
+
+func TestKey(t *testing.T) {
+	c := New(Config{Enabled: true}, newMemoryStore())
+	base, err := c.Key(imageSHA256, baseModel(), nil)
+	if err != nil || base == "" {
+		t.Fatalf("Key() = %q, %v", base, err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Cache, model *domain.ModelSpec) (image string, tiling *domain.TilingOptions)
+		same   bool
+	}{
+		{name: "image", change: func(*Cache, *domain.ModelSpec) (string, *domain.TilingOptions) {
+			return "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752", nil
+		}},
+		{name: "provider", change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.Provider = "local"
+			return imageSHA256, nil
+		}},
+		{name: "model id", change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.ModelID = "fruits/4"
+			return imageSHA256, nil
+		}},
+		{name: "version", change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.Version = "4"
+			return imageSHA256, nil
+		}},
+		{name: "endpoint", change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.Endpoint = "https://inference.example.com"
+			return imageSHA256, nil
+		}},
+		{name: "task type", change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.TaskType = "instance_segmentation"
+			return imageSHA256, nil
+		}},
+		{name: "config fingerprint", change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.Fingerprint = "env-b"
+			return imageSHA256, nil
+		}},
+		{name: "model option", change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.Options = json.RawMessage(`{"confidence":50}`)
+			return imageSHA256, nil
+		}},
+		{name: "tiling", change: func(*Cache, *domain.ModelSpec) (string, *domain.TilingOptions) {
+			return imageSHA256, &domain.TilingOptions{TileSize: 640, Overlap: 0.2}
+		}},
+		{name: "namespace", change: func(c *Cache, _ *domain.ModelSpec) (string, *domain.TilingOptions) {
+			c.cfg.Namespace = "v2"
+			return imageSHA256, nil
+		}},
+		{name: "model name", same: true, change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.Name = "fruits-renamed"
+			return imageSHA256, nil
+		}},
+		{name: "post-processing and tiling defaults", same: true, change: func(_ *Cache, m *domain.ModelSpec) (string, *domain.TilingOptions) {
+			m.Options = json.RawMessage(`{"tiling":{"tile_size":320},"confidence":40}`)
+			return imageSHA256, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(Config{Enabled: true}, newMemoryStore())
+			model := baseModel()
+			image, tiling := tt.change(c, model)
+
+			key, err := c.Key(image, model, tiling)
+			if err != nil {
+				t.Fatalf("Key() error = %v", err)
+			}
+			if same := key == base; same != tt.same {
+				t.Errorf("key equal to the base key = %t, want %t", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestKeyWithoutImageHash(t *testing.T) {
+	c := New(Config{Enabled: true}, newMemoryStore())
+	if key, err := c.Key("", baseModel(), nil); key != "" || err != nil {
+		t.Errorf("Key() = %q, %v, want no key", key, err)
+	}
+	if key, err := c.Key(imageSHA256, nil, nil); key != "" || err != nil {
+		t.Errorf("Key() without model = %q, %v, want no key", key, err)
+	}
+
+	model := baseModel()
+	model.Options = json.RawMessage(`[1, 2]`)
+	if _, err := c.Key(imageSHA256, model, nil); err == nil {
+		t.Error("Key() with options that are not an object error = nil")
+	}
+}
+
+func entry(key string) *Entry {
+	return &Entry{Key: key, JobID: "job-" + key}
+}
+
+func TestLRUEvictsTheLeastRecentlyUsed(t *testing.T) {
+	l := newLRU(2, time.Minute)
+	l.put(entry("a"))
+	l.put(entry("b"))
+	l.get("a")
+	l.put(entry("c"))
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := l.get(key); ok != want {
+			t.Errorf("get(%s) found = %t, want %t", key, ok, want)
+		}
+	}
+
+	// Replacing an entry refreshes it without evicting anything.
+	l.put(&Entry{Key: "a", JobID: "job-a2"})
+	if got, ok := l.get("a"); !ok || got.JobID != "job-a2" {
+		t.Errorf("get(a) = %v, %t, want the replacement", got, ok)
+	}
+	if _, ok := l.get("c"); !ok {
+		t.Error("get(c) missed after a replacement")
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+	l := newLRU(10, 30*time.Millisecond)
+	soon := time.Now().Add(10 * time.Millisecond)
+	l.put(entry("long"))
+	l.put(&Entry{Key: "short", ExpiresAt: &soon})
+
+	if _, ok := l.get("long"); !ok {
+		t.Fatal("get(long) missed before the TTL")
+	}
+	time.Sleep(15 * time.Millisecond)
+	if _, ok := l.get("short"); ok {
+		t.Error("get(short) hit after the entry expired, before the TTL")
+	}
+	if _, ok := l.get("long"); !ok {
+		t.Error("get(long) missed before the TTL")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := l.get("long"); ok {
+		t.Error("get(long) hit after the TTL")
+	}
+}
+
+func TestCacheExpiredEntriesMiss(t *testing.T) {
+	for _, lruSize := range []int{0, 10} {
+		t.Run(fmt.Sprintf("lru size %d", lruSize), func(t *testing.T) {
+			store := newMemoryStore()
+			c := New(Config{Enabled: true, TTL: 30 * time.Millisecond, LRUSize: lruSize, LRUTTL: time.Hour}, store)
+			ctx := context.Background()
+
+			c.Put(ctx, "key", "job-1", baseModel(), &domain.DetectionResult{})
+			got, ok := c.Get(ctx, "key")
+			if !ok || got.JobID != "job-1" {
+				t.Fatalf("Get() = %v, %t, want the entry of job-1", got, ok)
+			}
+			if got.ExpiresAt == nil {
+				t.Fatal("entry has no expiry")
+			}
+
+			time.Sleep(40 * time.Millisecond)
+			if got, ok := c.Get(ctx, "key"); ok {
+				t.Errorf("Get() = %v after the TTL, want a miss", got)
+			}
+		})
+	}
+}
+
+func TestCacheWithoutTTLKeepsEntries(t *testing.T) {
+	store := newMemoryStore()
+	c := New(Config{Enabled: true}, store)
+	c.Put(context.Background(), "key", "job-1", baseModel(), &domain.DetectionResult{})
+
+	got, ok := c.Get(context.Background(), "key")
+	if !ok || got.ExpiresAt != nil {
+		t.Errorf("Get() = %v, %t, want an entry without expiry", got, ok)
+	}
+}
+
+func TestCacheServesFromTheLRU(t *testing.T) {
+	store := newMemoryStore()
+	c := New(Config{Enabled: true, LRUSize: 10}, store)
+	ctx := context.Background()
+
+	c.Put(ctx, "key", "job-1", baseModel(), &domain.DetectionResult{})
+	for range 3 {
+		if _, ok := c.Get(ctx, "key"); !ok {
+			t.Fatal("Get() missed")
+		}
+	}
+	if store.gets != 0 {
+		t.Errorf("store read %d time(s), want 0", store.gets)
+	}
+}
+
+// memoryStore is a Store that honours ExpiresAt like the Postgres one.
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	gets    int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]Entry)}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	entry, ok := s.entries[key]
+	if !ok || entry.ExpiresAt != nil && !entry.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &entry, nil
+}
+
+func (s *memoryStore) Put(_ context.Context, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.Key] = entry
+	return nil
+}
+
+func (s *memoryStore) Purge(context.Context) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a fixed-size in-process cache of entries, evicting the least
+// recently used one when full. Entries are served for at most ttl, so
+// entries deleted from the store stop being served shortly after.
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type lruItem struct {
+	entry *Entry
+	until time.Time
+}
+
+func newLRU(capacity int, ttl time.Duration) *lru {
+	return &lru{capacity: capacity, ttl: ttl, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lru) get(key string) (*Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	item := elem.Value.(*lruItem)
+	if time.Now().After(item.until) {
+		l.order.Remove(elem)
+		delete(l.items, key)
+		return nil, false
+	}
+
+	l.order.MoveToFront(elem)
+	return item.entry, true
+}
+
+func (l *lru) put(entry *Entry) {
+	item := &lruItem{entry: entry, until: time.Now().Add(l.ttl)}
+	if entry.ExpiresAt != nil && entry.ExpiresAt.Before(item.until) {
+		item.until = *entry.ExpiresAt
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.items[entry.Key]; ok {
+		elem.Value = item
+		l.order.MoveToFront(elem)
+		return
+	}
+
+	l.items[entry.Key] = l.order.PushFront(item)
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruItem).entry.Key)
+	}
+}
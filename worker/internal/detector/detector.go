@@ -0,0 +1,78 @@
+package detector
+
+import (
+	"fmt"
+	"os"
+
+	"govision/pkg/endpoint"
+	"govision/worker/internal/domain"
+	"govision/worker/internal/ratelimit"
+	"govision/worker/internal/services/fake"
+	"govision/worker/internal/services/roboflow"
+)
+
+// Supported values for DETECTOR_BACKEND.
+const (
+	BackendRoboflow = "roboflow"
+	BackendWorkflow = "roboflow_workflow"
+	BackendFake     = "fake"
+)
+
+// Config selects and configures the inference backend.
+type Config struct {
+	Backend  string
+	Roboflow roboflow.Config
+	// Limiter, when set, rate limits the calls of Roboflow backends. It is
+	// shared by every model, as they draw on the same account.
+	Limiter *ratelimit.Limiter
+	// Endpoints lists the hosts registered models may send requests, and
+	// thereby the Roboflow credentials, to.
+	Endpoints endpoint.Allowlist
+}
+
+// ConfigFromEnv reads DETECTOR_BACKEND (default "roboflow"), the Roboflow
+// client settings and MODEL_ENDPOINT_ALLOWLIST.
+func ConfigFromEnv() Config {
+	backend := os.Getenv("DETECTOR_BACKEND")
+	if backend == "" {
+		backend = BackendRoboflow
+	}
+
+	return Config{
+		Backend:   backend,
+		Roboflow:  roboflow.ConfigFromEnv(),
+		Endpoints: endpoint.AllowlistFromEnv(),
+	}
+}
+
+// New builds the detector for the configured backend.
+func New(cfg Config) (domain.Detector, error) {
+	switch cfg.Backend {
+	case BackendRoboflow:
+		client, err := roboflow.NewClient(cfg.Roboflow)
+		if err != nil {
+			return nil, err
+		}
+		return limit(client, cfg.Limiter), nil
+	case BackendWorkflow:
+		client, err := roboflow.NewWorkflowClient(cfg.Roboflow)
+		if err != nil {
+			return nil, err
+		}
+		return limit(client, cfg.Limiter), nil
+	case BackendFake:
+		det := fake.New()
+		det.TaskType = cfg.Roboflow.TaskType
+		return det, nil
+	default:
+		return nil, fmt.Errorf("unknown detector backend %q", cfg.Backend)
+	}
+}
+
+// limit wraps det with the limiter, if any.
+func limit(det domain.Detector, limiter *ratelimit.Limiter) domain.Detector {
+	if limiter == nil {
+		return det
+	}
+	return ratelimit.Wrap(det, limiter)
+}
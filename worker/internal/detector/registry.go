@@ -0,0 +1,213 @@
+package detector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"govision/worker/internal/domain"
+	"govision/worker/internal/services/roboflow"
+)
+
+// ModelOptions are the default options stored with a registered model.
+type ModelOptions struct {
+	// Parameters are passed to the backend: query parameters for a Roboflow
+	// model, inputs for a Roboflow workflow.
+	Parameters map[string]any `json:"parameters"`
+}
+
+// Registry implements domain.DetectorResolver. Jobs without a model use the
+// detector built from the worker configuration; jobs naming a registered
+// model get a client for that model, created on first use and reused after.
+// Registered models inherit credentials and transport settings from the
+// worker configuration, so a model endpoint outside the configured allowlist
+// is refused rather than sent the worker's API key.
+type Registry struct {
+	base            Config
+	defaultDetector domain.Detector
+	defaultModel    domain.ModelSpec
+
+	mu        sync.Mutex
+	detectors map[string]resolved
+}
+
+// resolved is a detector built for a registered model.
+type resolved struct {
+	detector    domain.Detector
+	fingerprint string
+}
+
+var _ domain.DetectorResolver = (*Registry)(nil)
+
+// NewRegistry builds the default detector from cfg and prepares the cache of
+// per-model detectors.
+func NewRegistry(cfg Config) (*Registry, error) {
+	det, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultModel := defaultModelSpec(cfg)
+	if defaultModel.Fingerprint, err = fingerprint(cfg); err != nil {
+		return nil, err
+	}
+
+	return &Registry{
+		base:            cfg,
+		defaultDetector: det,
+		defaultModel:    defaultModel,
+		detectors:       make(map[string]resolved),
+	}, nil
+}
+
+// DefaultModel describes the model used for jobs that do not name one.
+func (r *Registry) DefaultModel() domain.ModelSpec {
+	return r.defaultModel
+}
+
+// Resolve returns the detector for model.
+func (r *Registry) Resolve(model *domain.ModelSpec) (domain.Detector, *domain.ModelSpec, error) {
+	if model == nil {
+		spec := r.defaultModel
+		return r.defaultDetector, &spec, nil
+	}
+
+	spec := *model
+	if spec.TaskType == "" {
+		spec.TaskType = domain.TaskObjectDetection
+	}
+	if spec.Version == "" {
+		spec.Version = versionOf(spec.Provider, spec.ModelID)
+	}
+
+	key := strings.Join([]string{spec.Provider, spec.ModelID, spec.Endpoint, spec.TaskType, string(spec.Options)}, "\x00")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.detectors[key]; ok {
+		spec.Fingerprint = entry.fingerprint
+		return entry.detector, &spec, nil
+	}
+
+	cfg, err := r.configFor(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("model %s: %w", spec.Name, err)
+	}
+	det, err := New(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("model %s: %w", spec.Name, err)
+	}
+	if spec.Fingerprint, err = fingerprint(cfg); err != nil {
+		return nil, nil, fmt.Errorf("model %s: %w", spec.Name, err)
+	}
+
+	r.detectors[key] = resolved{detector: det, fingerprint: spec.Fingerprint}
+	return det, &spec, nil
+}
+
+// configFor derives the backend configuration of a registered model from the
+// worker configuration.
+func (r *Registry) configFor(spec domain.ModelSpec) (Config, error) {
+	cfg := r.base
+	cfg.Backend = spec.Provider
+
+	var opts ModelOptions
+	if len(spec.Options) > 0 {
+		if err := json.Unmarshal(spec.Options, &opts); err != nil {
+			return cfg, fmt.Errorf("invalid model options: %w", err)
+		}
+	}
+	if opts.Parameters != nil {
+		cfg.Roboflow.Parameters = opts.Parameters
+	}
+
+	if spec.Endpoint != "" {
+		if err := r.base.Endpoints.Check(spec.Endpoint); err != nil {
+			return cfg, err
+		}
+		cfg.Roboflow.BaseURL = spec.Endpoint
+	}
+	cfg.Roboflow.TaskType = spec.TaskType
+
+	switch spec.Provider {
+	case BackendRoboflow:
+		cfg.Roboflow.Model = spec.ModelID
+	case BackendWorkflow:
+		workspace, workflow, ok := strings.Cut(spec.ModelID, "/")
+		if !ok || workspace == "" || workflow == "" {
+			return cfg, fmt.Errorf("workflow model id %q must be <workspace>/<workflow>", spec.ModelID)
+		}
+		cfg.Roboflow.WorkspaceID = workspace
+		cfg.Roboflow.WorkflowID = workflow
+	}
+
+	return cfg, nil
+}
+
+// defaultModelSpec names the model configured through the environment.
+func defaultModelSpec(cfg Config) domain.ModelSpec {
+	spec := domain.ModelSpec{Provider: cfg.Backend, TaskType: cfg.Roboflow.TaskType}
+	if spec.TaskType == "" {
+		spec.TaskType = domain.TaskObjectDetection
+	}
+
+	switch cfg.Backend {
+	case BackendRoboflow:
+		spec.ModelID = cfg.Roboflow.Model
+	case BackendWorkflow:
+		spec.ModelID = cfg.Roboflow.WorkspaceID + "/" + cfg.Roboflow.WorkflowID
+	default:
+		spec.ModelID = cfg.Backend
+	}
+
+	spec.Name = spec.ModelID
+	spec.Version = versionOf(spec.Provider, spec.ModelID)
+	return spec
+}
+
+// fingerprint hashes the settings of cfg that shape a model's output: the
+// backend, the server it calls and what it asks that server for. Transport
+// settings, credentials and the request style are left out, as they do not
+// change the result.
+func fingerprint(cfg Config) (string, error) {
+	rf := cfg.Roboflow
+	baseURL := strings.TrimRight(rf.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = roboflow.DefaultBaseURL
+	}
+
+	// Map keys are marshalled in sorted order, so the encoding is stable.
+	encoded, err := json.Marshal(map[string]any{
+		"backend":           cfg.Backend,
+		"base_url":          baseURL,
+		"model":             rf.Model,
+		"workspace_id":      rf.WorkspaceID,
+		"workflow_id":       rf.WorkflowID,
+		"task_type":         rf.TaskType,
+		"parameters":        rf.Parameters,
+		"image_input":       rf.ImageInput,
+		"detections_output": rf.DetectionsOutput,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid model configuration: %w", err)
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// versionOf extracts the version of a Roboflow model id ("project/3" -> "3").
+// Other providers carry no version in their identifiers.
+func versionOf(provider, modelID string) string {
+	if provider != BackendRoboflow {
+		return ""
+	}
+	if i := strings.LastIndex(modelID, "/"); i >= 0 {
+		return modelID[i+1:]
+	}
+	return ""
+}
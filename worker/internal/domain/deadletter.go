@@ -0,0 +1,30 @@
+package domain
+
+// Reasons a message is dead-lettered, stored with the dead letter so
+// operators can filter and replay failures by cause.
+const (
+	ReasonInvalidMessage  = "invalid_message"
+	ReasonJobNotCreated   = "job_not_created"
+	ReasonNoDetector      = "no_detector"
+	ReasonInferenceFailed = "inference_failed"
+	ReasonEmptyResult     = "empty_result"
+	ReasonInvalidOptions  = "invalid_options"
+	ReasonSaveFailed      = "save_failed"
+	ReasonPanic           = "panic"
+	// ReasonTimeout marks jobs the reaper found stuck in pending after their
+	// last allowed attempt.
+	ReasonTimeout = "timeout"
+	// ReasonMaxAttempts marks messages the job queue gave up on after
+	// QUEUE_MAX_ATTEMPTS deliveries.
+	ReasonMaxAttempts = "max_attempts"
+)
+
+// DeadLetter is a message the worker gave up on. Payload is the message
+// body exactly as received, so it can be published again unchanged.
+type DeadLetter struct {
+	JobID     string
+	Reason    string
+	Error     string
+	Payload   []byte
+	ModelName string
+}
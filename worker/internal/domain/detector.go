@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Detector runs object detection on an image. Implementations wrap a specific
+// inference backend and translate its response into normalized detections.
+type Detector interface {
+	Detect(ctx context.Context, imageURL string) (*DetectionResult, error)
+}
+
+// ImageDetector is implemented by detectors that can also run on encoded
+// image bytes, which tiled inference needs to send crops of an image.
+type ImageDetector interface {
+	DetectImage(ctx context.Context, image []byte) (*DetectionResult, error)
+}
+
+// Model task types. They decide how a backend response is parsed.
+const (
+	TaskObjectDetection          = "object_detection"
+	TaskInstanceSegmentation     = "instance_segmentation"
+	TaskKeypointDetection        = "keypoint_detection"
+	TaskClassification           = "classification"
+	TaskMultiLabelClassification = "multi_label_classification"
+)
+
+// IsClassificationTask reports whether a task type produces class scores
+// for the whole image instead of located objects.
+func IsClassificationTask(taskType string) bool {
+	return taskType == TaskClassification || taskType == TaskMultiLabelClassification
+}
+
+// DetectorResolver picks the detector for a job's model. A nil model selects
+// the worker's default. The returned spec names the model that will actually
+// run, with its version resolved.
+type DetectorResolver interface {
+	Resolve(model *ModelSpec) (Detector, *ModelSpec, error)
+}
+
+// Detection is a single object found in an image. X and Y are the center of
+// the bounding box, in pixels of the image that was sent for inference.
+// Segmentation models add the object outline in Points and pose models its
+// Keypoints, in the same pixel space. ParentID links a detection to the one it
+// was derived from, e.g. in multi-stage workflows.
+type Detection struct {
+	X           float64    `json:"x"`
+	Y           float64    `json:"y"`
+	Width       float64    `json:"width"`
+	Height      float64    `json:"height"`
+	Confidence  float64    `json:"confidence"`
+	Class       string     `json:"class"`
+	ClassID     int        `json:"class_id"`
+	DetectionID string     `json:"detection_id,omitempty"`
+	ParentID    string     `json:"parent_id,omitempty"`
+	Points      []Point    `json:"points,omitempty"`
+	Keypoints   []Keypoint `json:"keypoints,omitempty"`
+}
+
+// Point is a vertex of a segmentation polygon.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Keypoint is a named landmark predicted by a pose model.
+type Keypoint struct {
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Confidence float64 `json:"confidence"`
+	Class      string  `json:"class"`
+	ClassID    int     `json:"class_id"`
+}
+
+// DetectionResult is the normalized output of a Detector. Classification is
+// set instead of Detections for classification models. Outputs holds any
+// additional named results a backend produced (e.g. workflow counts or
+// crops), as raw JSON.
+type DetectionResult struct {
+	Detections     []Detection                `json:"detections,omitempty"`
+	Classification *Classification            `json:"classification,omitempty"`
+	Outputs        map[string]json.RawMessage `json:"outputs,omitempty"`
+}
+
+// Classification is the whole-image result of a classification model.
+// Single-label models predict exactly one class, Top. Multi-label models
+// predict every class in Predicted, which may be empty. Classes holds the
+// score of every class, highest confidence first.
+type Classification struct {
+	MultiLabel bool         `json:"multi_label"`
+	Top        string       `json:"top"`
+	Confidence float64      `json:"confidence"`
+	Predicted  []string     `json:"predicted"`
+	Classes    []ClassScore `json:"classes"`
+}
+
+// ClassScore is the confidence of one class in a classification.
+type ClassScore struct {
+	Class      string  `json:"class"`
+	ClassID    int     `json:"class_id"`
+	Confidence float64 `json:"confidence"`
+}
@@ -1,6 +1,132 @@
 package domain
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"govision/pkg/envelope"
+	"govision/pkg/postprocess"
+)
+
+// JobMessage is a job read from the queue. Version is the envelope version
+// it was published with; messages older than version 2 carry no CreatedAt,
+// UserID or Trace.
 type JobMessage struct {
-	JobID    string `json:"job_id"`
-	ImageURL string `json:"image_url"`
-}
\ No newline at end of file
+	JobID string `json:"job_id"`
+	// DedupeKey identifies the message across redeliveries. A key whose
+	// result was saved is not processed again. Empty for older messages.
+	DedupeKey string      `json:"dedupe_key,omitempty"`
+	ImageURL  string      `json:"image_url"`
+	Image     ImageInfo   `json:"image"`
+	Model     *ModelSpec  `json:"model,omitempty"`
+	Options   *JobOptions `json:"options,omitempty"`
+
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at,omitempty"`
+	UserID    string          `json:"user_id,omitempty"`
+	Trace     *envelope.Trace `json:"trace,omitempty"`
+}
+
+// DecodeJobMessage validates a message body of any envelope version the
+// worker reads and returns its job. Errors wrap envelope.ErrInvalid or
+// envelope.ErrUnsupportedVersion.
+func DecodeJobMessage(body []byte) (JobMessage, error) {
+	env, err := envelope.Decode(body)
+	if err != nil {
+		return JobMessage{}, err
+	}
+
+	job := JobMessage{
+		JobID:     env.Job.ID,
+		DedupeKey: env.DedupeKey,
+		ImageURL:  env.Job.ImageURL,
+		Image:     ImageInfo(env.Job.Image),
+		Version:   env.Version,
+		CreatedAt: env.CreatedAt,
+		Trace:     env.Trace,
+	}
+	if env.User != nil {
+		job.UserID = env.User.ID
+	}
+	if len(env.Job.Model) > 0 {
+		if err := json.Unmarshal(env.Job.Model, &job.Model); err != nil {
+			return JobMessage{}, fmt.Errorf("%w: model: %v", envelope.ErrInvalid, err)
+		}
+	}
+	if len(env.Options) > 0 {
+		if err := json.Unmarshal(env.Options, &job.Options); err != nil {
+			return JobMessage{}, fmt.Errorf("%w: options: %v", envelope.ErrInvalid, err)
+		}
+	}
+	return job, nil
+}
+
+// JobOptions are the per-job processing options chosen at upload time. They
+// take precedence over the defaults of the job's model.
+type JobOptions struct {
+	Tiling      *TilingOptions     `json:"tiling,omitempty"`
+	Postprocess []postprocess.Step `json:"postprocess,omitempty"`
+}
+
+// TilingOptions enable tiled inference: the image is cut into TileSize x
+// TileSize tiles, neighbours sharing Overlap (a fraction of TileSize), and
+// each tile is sent to the detector on its own. A zero TileSize disables it.
+type TilingOptions struct {
+	TileSize int     `json:"tile_size"`
+	Overlap  float64 `json:"overlap"`
+}
+
+// ModelSpec describes the registered model a job asked for. Provider matches
+// a detector backend and ModelID is the backend's model identifier (a
+// Roboflow "project/version", or "workspace/workflow" for workflows).
+// Endpoint, when set, overrides the backend's base URL. TaskType selects the
+// response parser; empty means object detection. Fingerprint is set by the
+// resolver and identifies the effective backend configuration the model runs
+// with, including settings inherited from the worker's environment.
+type ModelSpec struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Provider    string          `json:"provider"`
+	ModelID     string          `json:"model_id"`
+	Endpoint    string          `json:"endpoint,omitempty"`
+	Version     string          `json:"version,omitempty"`
+	TaskType    string          `json:"task_type,omitempty"`
+	Options     json.RawMessage `json:"options,omitempty"`
+	Fingerprint string          `json:"-"`
+}
+
+// ModelName returns the name of the requested model, or "" when the job
+// uses the worker's default model.
+func (m *ModelSpec) ModelName() string {
+	if m == nil {
+		return ""
+	}
+	return m.Name
+}
+
+// DefaultOptions decodes the processing options stored with the model. Its
+// "tiling" and "postprocess" entries apply to jobs that do not set their own.
+func (m *ModelSpec) DefaultOptions() (*JobOptions, error) {
+	var opts JobOptions
+	if m == nil || len(m.Options) == 0 {
+		return &opts, nil
+	}
+	if err := json.Unmarshal(m.Options, &opts); err != nil {
+		return nil, fmt.Errorf("invalid model options: %w", err)
+	}
+	return &opts, nil
+}
+
+// ImageInfo describes the normalized image referenced by ImageURL and the
+// upright original it was derived from. Dividing prediction coordinates by
+// ScaleFactor maps them back onto the original image. SHA256 is the hash of
+// the stored image bytes.
+type ImageInfo struct {
+	SHA256         string  `json:"sha256"`
+	OriginalWidth  int     `json:"original_width"`
+	OriginalHeight int     `json:"original_height"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	ScaleFactor    float64 `json:"scale_factor"`
+}
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"database/sql/driver"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,13 +11,28 @@ import (
 
 // Job represents the jobs table in the database.
 type Job struct {
-	ID          uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	JobID       string         `gorm:"column:job_id;type:varchar(255);uniqueIndex;not null" json:"job_id"`
-	ImageURL    string         `gorm:"column:image_url;type:text;not null" json:"image_url"`
-	Status      string         `gorm:"column:status;type:varchar(50);not null;default:'completed'" json:"status"`
-	ProcessedAt time.Time      `gorm:"column:processed_at;not null;default:now()" json:"processed_at"`
-	CreatedAt   time.Time      `gorm:"column:created_at;not null;default:now()" json:"created_at"`
-	Predictions []DBPrediction `gorm:"foreignKey:JobID;references:JobID" json:"predictions,omitempty"`
+	ID             uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	JobID          string         `gorm:"column:job_id;type:varchar(255);uniqueIndex;not null" json:"job_id"`
+	ImageURL       string         `gorm:"column:image_url;type:text;not null" json:"image_url"`
+	Status         string         `gorm:"column:status;type:varchar(50);not null;default:'completed'" json:"status"`
+	ImageWidth     int            `gorm:"column:image_width;type:integer;not null;default:0" json:"image_width"`
+	ImageHeight    int            `gorm:"column:image_height;type:integer;not null;default:0" json:"image_height"`
+	OriginalWidth  int            `gorm:"column:original_width;type:integer;not null;default:0" json:"original_width"`
+	OriginalHeight int            `gorm:"column:original_height;type:integer;not null;default:0" json:"original_height"`
+	ScaleFactor    float64        `gorm:"column:scale_factor;type:double precision;not null;default:1" json:"scale_factor"`
+	Outputs        string         `gorm:"column:outputs;type:jsonb;not null;default:'{}'" json:"outputs"`
+	ModelName      string         `gorm:"column:model_name;type:varchar(100);not null;default:''" json:"model_name"`
+	ModelVersion   string         `gorm:"column:model_version;type:varchar(100);not null;default:''" json:"model_version"`
+	TaskType       string         `gorm:"column:task_type;type:varchar(50);not null;default:'object_detection'" json:"task_type"`
+	Postprocess    string         `gorm:"column:postprocess;type:jsonb;not null;default:'[]'" json:"postprocess"`
+	CachedFrom     *string        `gorm:"column:cached_from;type:varchar(255)" json:"cached_from,omitempty"`
+	Attempts       int            `gorm:"column:attempts;type:integer;not null;default:0" json:"attempts"`
+	StartedAt      *time.Time     `gorm:"column:started_at" json:"started_at,omitempty"`
+	Message        string         `gorm:"column:message;type:text;not null;default:''" json:"-"`
+	WorkerID       *string        `gorm:"column:worker_id;type:varchar(255)" json:"worker_id,omitempty"`
+	ProcessedAt    time.Time      `gorm:"column:processed_at;not null;default:now()" json:"processed_at"`
+	CreatedAt      time.Time      `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+	Predictions    []DBPrediction `gorm:"foreignKey:JobID;references:JobID" json:"predictions,omitempty"`
 }
 
 func (Job) TableName() string {
@@ -32,16 +49,20 @@ func (j *Job) BeforeCreate(tx *gorm.DB) error {
 
 // DBPrediction represents the predictions table in the database.
 type DBPrediction struct {
-	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	JobID      string    `gorm:"column:job_id;type:varchar(255);not null;index:idx_predictions_job_id" json:"job_id"`
-	X          float64   `gorm:"column:x;type:double precision;not null" json:"x"`
-	Y          float64   `gorm:"column:y;type:double precision;not null" json:"y"`
-	Width      float64   `gorm:"column:width;type:double precision;not null" json:"width"`
-	Height     float64   `gorm:"column:height;type:double precision;not null" json:"height"`
-	Confidence float64   `gorm:"column:confidence;type:double precision;not null" json:"confidence"`
-	Class      string    `gorm:"column:class;type:varchar(255);not null" json:"class"`
-	ClassID    int       `gorm:"column:class_id;type:integer;not null" json:"class_id"`
-	CreatedAt  time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	JobID       string    `gorm:"column:job_id;type:varchar(255);not null;index:idx_predictions_job_id" json:"job_id"`
+	X           float64   `gorm:"column:x;type:double precision;not null" json:"x"`
+	Y           float64   `gorm:"column:y;type:double precision;not null" json:"y"`
+	Width       float64   `gorm:"column:width;type:double precision;not null" json:"width"`
+	Height      float64   `gorm:"column:height;type:double precision;not null" json:"height"`
+	Confidence  float64   `gorm:"column:confidence;type:double precision;not null" json:"confidence"`
+	Class       string    `gorm:"column:class;type:varchar(255);not null" json:"class"`
+	ClassID     int       `gorm:"column:class_id;type:integer;not null" json:"class_id"`
+	DetectionID string    `gorm:"column:detection_id;type:varchar(255);not null;default:''" json:"detection_id"`
+	ParentID    string    `gorm:"column:parent_id;type:varchar(255);not null;default:''" json:"parent_id"`
+	Points      JSON      `gorm:"column:points;type:jsonb" json:"points,omitempty"`
+	Keypoints   JSON      `gorm:"column:keypoints;type:jsonb" json:"keypoints,omitempty"`
+	CreatedAt   time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
 }
 
 func (DBPrediction) TableName() string {
@@ -55,3 +76,90 @@ func (p *DBPrediction) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// DBClassification represents the classifications table in the database:
+// one row per class score of a classification job.
+type DBClassification struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	JobID      string    `gorm:"column:job_id;type:varchar(255);not null;index:idx_classifications_job_id" json:"job_id"`
+	Class      string    `gorm:"column:class;type:varchar(255);not null" json:"class"`
+	ClassID    int       `gorm:"column:class_id;type:integer;not null" json:"class_id"`
+	Confidence float64   `gorm:"column:confidence;type:double precision;not null" json:"confidence"`
+	Predicted  bool      `gorm:"column:predicted;not null;default:false" json:"predicted"`
+	CreatedAt  time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (DBClassification) TableName() string {
+	return "classifications"
+}
+
+// BeforeCreate generates a UUID before inserting a new DBClassification.
+func (c *DBClassification) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// DBCacheEntry represents the inference_cache table: a model result reusable
+// by every job with the same image, model and options.
+type DBCacheEntry struct {
+	CacheKey     string     `gorm:"column:cache_key;type:varchar(64);primaryKey"`
+	JobID        string     `gorm:"column:job_id;type:varchar(255);not null"`
+	ModelName    string     `gorm:"column:model_name;type:varchar(100);not null;default:''"`
+	ModelVersion string     `gorm:"column:model_version;type:varchar(100);not null;default:''"`
+	Result       string     `gorm:"column:result;type:jsonb;not null"`
+	CreatedAt    time.Time  `gorm:"column:created_at;not null;default:now()"`
+	ExpiresAt    *time.Time `gorm:"column:expires_at"`
+}
+
+func (DBCacheEntry) TableName() string {
+	return "inference_cache"
+}
+
+// DBProcessedMessage represents the processed_messages table: the dedupe
+// keys of messages whose result was saved.
+type DBProcessedMessage struct {
+	DedupeKey   string    `gorm:"column:dedupe_key;type:varchar(255);primaryKey"`
+	JobID       string    `gorm:"column:job_id;type:varchar(255);not null"`
+	ProcessedAt time.Time `gorm:"column:processed_at;not null;default:now()"`
+}
+
+func (DBProcessedMessage) TableName() string {
+	return "processed_messages"
+}
+
+// JSON holds a raw JSON document stored in a nullable JSONB column. The empty
+// value is stored as NULL.
+type JSON string
+
+// Value implements driver.Valuer.
+func (j JSON) Value() (driver.Value, error) {
+	if j == "" {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan implements sql.Scanner.
+func (j *JSON) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*j = ""
+	case string:
+		*j = JSON(v)
+	case []byte:
+		*j = JSON(v)
+	default:
+		return errors.New("unsupported JSON column type")
+	}
+	return nil
+}
+
+// MarshalJSON writes the stored document as is.
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
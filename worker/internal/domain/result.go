@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"govision/pkg/postprocess"
+)
+
+// JobResult represents a completed job with its detections,
+// ready to be persisted in the database.
+type JobResult struct {
+	JobID        string
+	ImageURL     string
+	Status       string
+	ProcessedAt  time.Time
+	Image        ImageInfo
+	ModelName    string
+	ModelVersion string
+	TaskType     string
+	CountObjects int
+	Detections   []Detection
+	// Classification is set for classification models instead of Detections.
+	Classification *Classification
+	Outputs        map[string]json.RawMessage
+	// Postprocess records the post-processing steps applied to Detections.
+	Postprocess []AppliedStep
+	// CachedFrom is the job whose inference result was reused, when the
+	// result came from the cache.
+	CachedFrom string
+	// DedupeKey is the key of the message that produced the result. It is
+	// recorded with the result so redeliveries of the message are skipped.
+	DedupeKey string
+	// WorkerID identifies the worker process that produced the result.
+	WorkerID string
+}
+
+// AppliedStep is a post-processing step as it ran on a job, with the
+// number of detections before and after it.
+type AppliedStep struct {
+	postprocess.Step
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
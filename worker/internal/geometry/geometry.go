@@ -0,0 +1,111 @@
+// Package geometry holds the box arithmetic shared by the worker's
+// detection pipeline.
+package geometry
+
+import (
+	"math"
+	"sort"
+
+	"govision/worker/internal/domain"
+)
+
+// Area returns the area of a detection's box.
+func Area(d domain.Detection) float64 {
+	return math.Max(d.Width, 0) * math.Max(d.Height, 0)
+}
+
+// IoU returns the intersection over union of two boxes given by their
+// centers and sizes, as Roboflow reports them.
+func IoU(a, b domain.Detection) float64 {
+	intersection := Intersection(a, b)
+	union := Area(a) + Area(b) - intersection
+	if union <= 0 {
+		return 0
+	}
+	return intersection / union
+}
+
+// IoS returns the intersection over the area of the smaller box. Unlike IoU
+// it is 1 when one box lies inside the other, however much smaller it is,
+// such as the part of an object cut off at the edge of an image tile.
+func IoS(a, b domain.Detection) float64 {
+	smaller := math.Min(Area(a), Area(b))
+	if smaller <= 0 {
+		return 0
+	}
+	return Intersection(a, b) / smaller
+}
+
+// Intersection returns the area shared by two boxes.
+func Intersection(a, b domain.Detection) float64 {
+	left := math.Max(a.X-a.Width/2, b.X-b.Width/2)
+	right := math.Min(a.X+a.Width/2, b.X+b.Width/2)
+	top := math.Max(a.Y-a.Height/2, b.Y-b.Height/2)
+	bottom := math.Min(a.Y+a.Height/2, b.Y+b.Height/2)
+
+	if right <= left || bottom <= top {
+		return 0
+	}
+	return (right - left) * (bottom - top)
+}
+
+// Union returns a with its box grown to also cover b.
+func Union(a, b domain.Detection) domain.Detection {
+	left := math.Min(a.X-a.Width/2, b.X-b.Width/2)
+	right := math.Max(a.X+a.Width/2, b.X+b.Width/2)
+	top := math.Min(a.Y-a.Height/2, b.Y-b.Height/2)
+	bottom := math.Max(a.Y+a.Height/2, b.Y+b.Height/2)
+
+	a.X, a.Y = (left+right)/2, (top+bottom)/2
+	a.Width, a.Height = right-left, bottom-top
+	return a
+}
+
+// NMS applies greedy non-maximum suppression: detections are visited by
+// descending confidence and dropped when they overlap an already kept one
+// by more than iouThreshold. With classAware set only detections of the same
+// class suppress each other. The input slice is not modified.
+func NMS(detections []domain.Detection, iouThreshold float64, classAware bool) []domain.Detection {
+	if len(detections) < 2 {
+		return detections
+	}
+
+	sorted := make([]domain.Detection, len(detections))
+	copy(sorted, detections)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Confidence > sorted[j].Confidence })
+
+	kept := make([]domain.Detection, 0, len(sorted))
+	for _, candidate := range sorted {
+		suppressed := false
+		for _, k := range kept {
+			if classAware && k.Class != candidate.Class {
+				continue
+			}
+			if IoU(k, candidate) > iouThreshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+// Contains reports whether p lies inside polygon, using the even-odd rule.
+// Polygons with fewer than three vertices contain nothing.
+func Contains(polygon []domain.Point, p domain.Point) bool {
+	if len(polygon) < 3 {
+		return false
+	}
+
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
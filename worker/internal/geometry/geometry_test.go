@@ -0,0 +1,106 @@
+package geometry
+
+import (
+	"math"
+	"testing"
+
+	"govision/worker/internal/domain"
+)
+
+// box returns a detection of class covering left..right, top..bottom.
+func box(class string, left, top, right, bottom, confidence float64) domain.Detection {
+	return domain.Detection{
+		X: (left + right) / 2, Y: (top + bottom) / 2,
+		Width: right - left, Height: bottom - top,
+		Class: class, Confidence: confidence,
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b domain.Detection
+		iou  float64
+		ios  float64
+	}{
+		{name: "identical", a: box("car", 0, 0, 10, 10, 1), b: box("car", 0, 0, 10, 10, 1), iou: 1, ios: 1},
+		{name: "disjoint", a: box("car", 0, 0, 10, 10, 1), b: box("car", 20, 0, 30, 10, 1), iou: 0, ios: 0},
+		{name: "touching", a: box("car", 0, 0, 10, 10, 1), b: box("car", 10, 0, 20, 10, 1), iou: 0, ios: 0},
+		{name: "half inside", a: box("car", 0, 0, 10, 10, 1), b: box("car", 5, 0, 10, 10, 1), iou: 0.5, ios: 1},
+		{name: "shifted", a: box("car", 0, 0, 10, 10, 1), b: box("car", 5, 0, 15, 10, 1), iou: 50.0 / 150, ios: 0.5},
+		{name: "empty box", a: box("car", 0, 0, 10, 10, 1), b: box("car", 5, 5, 5, 5, 1), iou: 0, ios: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IoU(tt.a, tt.b); math.Abs(got-tt.iou) > 1e-9 {
+				t.Errorf("IoU() = %g, want %g", got, tt.iou)
+			}
+			if got := IoS(tt.a, tt.b); math.Abs(got-tt.ios) > 1e-9 {
+				t.Errorf("IoS() = %g, want %g", got, tt.ios)
+			}
+		})
+	}
+}
+
+func TestUnion(t *testing.T) {
+	a := box("car", 0, 0, 10, 10, 0.9)
+	a.Points = []domain.Point{{X: 1, Y: 1}}
+	got := Union(a, box("truck", 5, -5, 20, 8, 0.5))
+
+	want := box("car", 0, -5, 20, 10, 0.9)
+	if got.X != want.X || got.Y != want.Y || got.Width != want.Width || got.Height != want.Height {
+		t.Errorf("Union() box = %v,%v %vx%v, want %v,%v %vx%v", got.X, got.Y, got.Width, got.Height, want.X, want.Y, want.Width, want.Height)
+	}
+	if got.Class != "car" || got.Confidence != 0.9 || len(got.Points) != 1 {
+		t.Errorf("Union() = %+v, want the other fields of the first detection", got)
+	}
+}
+
+func TestNMS(t *testing.T) {
+	detections := []domain.Detection{
+		box("car", 0, 0, 10, 10, 0.6),
+		box("car", 1, 0, 11, 10, 0.9),
+		box("truck", 1, 0, 11, 10, 0.8),
+		box("car", 50, 50, 60, 60, 0.7),
+	}
+
+	classAware := NMS(detections, 0.5, true)
+	if len(classAware) != 3 || classAware[0].Confidence != 0.9 || classAware[1].Class != "truck" || classAware[2].Confidence != 0.7 {
+		t.Errorf("class-aware NMS = %+v, want the 0.9 car, the truck and the far car", classAware)
+	}
+
+	agnostic := NMS(detections, 0.5, false)
+	if len(agnostic) != 2 || agnostic[0].Confidence != 0.9 || agnostic[1].Confidence != 0.7 {
+		t.Errorf("class-agnostic NMS = %+v, want the 0.9 car and the far car", agnostic)
+	}
+
+	if detections[0].Confidence != 0.6 {
+		t.Error("NMS reordered its input")
+	}
+}
+
+func TestContains(t *testing.T) {
+	square := []domain.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}}
+	tests := []struct {
+		name    string
+		polygon []domain.Point
+		point   domain.Point
+		want    bool
+	}{
+		{name: "inside", polygon: square, point: domain.Point{X: 5, Y: 5}, want: true},
+		{name: "outside", polygon: square, point: domain.Point{X: 15, Y: 5}},
+		{name: "degenerate polygon", polygon: square[:2], point: domain.Point{X: 5, Y: 0}},
+		{
+			name:    "notch of a concave polygon",
+			polygon: []domain.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 5, Y: 5}, {X: 0, Y: 10}},
+			point:   domain.Point{X: 5, Y: 8},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Contains(tt.polygon, tt.point); got != tt.want {
+				t.Errorf("Contains() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
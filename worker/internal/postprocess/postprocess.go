@@ -0,0 +1,100 @@
+// Package postprocess applies the chain of clean-up steps defined by
+// govision/pkg/postprocess to a model's detections before they are stored.
+package postprocess
+
+import (
+	"govision/worker/internal/domain"
+	"govision/worker/internal/geometry"
+
+	schema "govision/pkg/postprocess"
+)
+
+// defaultIoU is the NMS threshold of steps that do not set one.
+const defaultIoU = 0.5
+
+// Steps returns the chain that applies to a job: the job's own steps when it
+// declares any, else the "postprocess" entry of its model's default options.
+func Steps(job *domain.JobOptions, model *domain.ModelSpec) ([]schema.Step, error) {
+	if job != nil && len(job.Postprocess) > 0 {
+		return job.Postprocess, nil
+	}
+
+	defaults, err := model.DefaultOptions()
+	if err != nil {
+		return nil, err
+	}
+	return defaults.Postprocess, nil
+}
+
+// Apply runs the steps in order and returns the remaining detections along
+// with the record of each step. Defaults are filled in the record, so it
+// describes exactly what ran. The input slice is not modified.
+func Apply(detections []domain.Detection, steps []schema.Step) ([]domain.Detection, []domain.AppliedStep, error) {
+	if err := schema.Validate(steps); err != nil {
+		return nil, nil, err
+	}
+
+	applied := make([]domain.AppliedStep, 0, len(steps))
+	for _, step := range steps {
+		if step.Type == schema.StepNMS && step.IoU == 0 {
+			step.IoU = defaultIoU
+		}
+		before := len(detections)
+		detections = apply(detections, step)
+		applied = append(applied, domain.AppliedStep{Step: step, Before: before, After: len(detections)})
+	}
+	return detections, applied, nil
+}
+
+func apply(detections []domain.Detection, step schema.Step) []domain.Detection {
+	switch step.Type {
+	case schema.StepNMS:
+		return geometry.NMS(detections, step.IoU, !step.ClassAgnostic)
+
+	case schema.StepMinConfidence:
+		return filter(detections, func(d domain.Detection) bool {
+			threshold, ok := step.Classes[d.Class]
+			if !ok {
+				threshold = step.Confidence
+			}
+			return d.Confidence >= threshold
+		})
+
+	case schema.StepArea:
+		return filter(detections, func(d domain.Detection) bool {
+			area := geometry.Area(d)
+			return area >= step.MinArea && (step.MaxArea == 0 || area <= step.MaxArea)
+		})
+
+	case schema.StepRename:
+		renamed := make([]domain.Detection, len(detections))
+		for i, d := range detections {
+			if class, ok := step.Mapping[d.Class]; ok {
+				d.Class = class
+			}
+			renamed[i] = d
+		}
+		return renamed
+
+	case schema.StepROI:
+		region := make([]domain.Point, len(step.Region))
+		for i, p := range step.Region {
+			region[i] = domain.Point(p)
+		}
+		return filter(detections, func(d domain.Detection) bool {
+			return geometry.Contains(region, domain.Point{X: d.X, Y: d.Y})
+		})
+	}
+	return detections
+}
+
+// filter returns the detections keep accepts.
+func filter(detections []domain.Detection, keep func(domain.Detection) bool) []domain.Detection {
+	kept := make([]domain.Detection, 0, len(detections))
+	for _, d := range detections {
+		if keep(d) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,222 @@
+package postprocess
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"govision/worker/internal/domain"
+
+	schema "govision/pkg/postprocess"
+)
+
+// box returns a detection of class covering left..right, top..bottom.
+func box(class string, left, top, right, bottom, confidence float64) domain.Detection {
+	return domain.Detection{
+		X: (left + right) / 2, Y: (top + bottom) / 2,
+		Width: right - left, Height: bottom - top,
+		Class: class, Confidence: confidence,
+	}
+}
+
+// names lists detections as class@confidence, in order.
+func names(detections []domain.Detection) []string {
+	out := make([]string, len(detections))
+	for i, d := range detections {
+		out[i] = fmt.Sprintf("%s@%g", d.Class, d.Confidence)
+	}
+	return out
+}
+
+func TestApply(t *testing.T) {
+	// The two cars overlap with an IoU of 2/3; the person covers the first
+	// car exactly.
+	overlapping := []domain.Detection{
+		box("car", 0, 0, 10, 10, 0.9),
+		box("car", 2, 0, 12, 10, 0.8),
+		box("person", 0, 0, 10, 10, 0.7),
+	}
+	// Areas 4, 100 and 400.
+	sized := []domain.Detection{
+		box("car", 0, 0, 2, 2, 0.9),
+		box("car", 0, 0, 10, 10, 0.8),
+		box("car", 0, 0, 20, 20, 0.7),
+	}
+	mixed := []domain.Detection{
+		box("car", 0, 0, 10, 10, 0.9),
+		box("person", 0, 0, 10, 10, 0.3),
+		box("dog", 0, 0, 10, 10, 0.1),
+	}
+	square := []schema.Point{{X: 0, Y: 0}, {X: 100, Y: 0}, {X: 100, Y: 100}, {X: 0, Y: 100}}
+
+	tests := []struct {
+		name       string
+		detections []domain.Detection
+		steps      []schema.Step
+		want       []string
+	}{
+		{
+			name:       "no steps",
+			detections: mixed,
+			want:       []string{"car@0.9", "person@0.3", "dog@0.1"},
+		},
+		{
+			name:       "nms default iou",
+			detections: overlapping,
+			steps:      []schema.Step{{Type: schema.StepNMS}},
+			want:       []string{"car@0.9", "person@0.7"},
+		},
+		{
+			name:       "nms above the overlap",
+			detections: overlapping,
+			steps:      []schema.Step{{Type: schema.StepNMS, IoU: 0.7}},
+			want:       []string{"car@0.9", "car@0.8", "person@0.7"},
+		},
+		{
+			name:       "nms class agnostic",
+			detections: overlapping,
+			steps:      []schema.Step{{Type: schema.StepNMS, ClassAgnostic: true}},
+			want:       []string{"car@0.9"},
+		},
+		{
+			name:       "min confidence",
+			detections: mixed,
+			steps:      []schema.Step{{Type: schema.StepMinConfidence, Confidence: 0.5}},
+			want:       []string{"car@0.9"},
+		},
+		{
+			name:       "min confidence per class",
+			detections: mixed,
+			steps: []schema.Step{{
+				Type:       schema.StepMinConfidence,
+				Confidence: 0.5,
+				Classes:    map[string]float64{"person": 0.2, "car": 0.95},
+			}},
+			want: []string{"person@0.3"},
+		},
+		{
+			name:       "min area",
+			detections: sized,
+			steps:      []schema.Step{{Type: schema.StepArea, MinArea: 100}},
+			want:       []string{"car@0.8", "car@0.7"},
+		},
+		{
+			name:       "area range",
+			detections: sized,
+			steps:      []schema.Step{{Type: schema.StepArea, MinArea: 50, MaxArea: 100}},
+			want:       []string{"car@0.8"},
+		},
+		{
+			name:       "rename",
+			detections: mixed,
+			steps:      []schema.Step{{Type: schema.StepRename, Mapping: map[string]string{"car": "vehicle", "dog": "animal"}}},
+			want:       []string{"vehicle@0.9", "person@0.3", "animal@0.1"},
+		},
+		{
+			name: "roi keeps box centers inside",
+			detections: []domain.Detection{
+				box("car", 10, 10, 20, 20, 0.9),
+				// Center outside although the box reaches into the region.
+				box("car", 90, 90, 130, 130, 0.8),
+				box("car", 200, 200, 210, 210, 0.7),
+			},
+			steps: []schema.Step{{Type: schema.StepROI, Region: square}},
+			want:  []string{"car@0.9"},
+		},
+		{
+			name:       "steps run in order",
+			detections: mixed,
+			steps: []schema.Step{
+				{Type: schema.StepRename, Mapping: map[string]string{"person": "car"}},
+				{Type: schema.StepMinConfidence, Classes: map[string]float64{"car": 0.5}},
+			},
+			want: []string{"car@0.9", "dog@0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.detections)
+			got, applied, err := Apply(tt.detections, tt.steps)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !slices.Equal(names(got), tt.want) {
+				t.Errorf("Apply() = %v, want %v", names(got), tt.want)
+			}
+			if !slices.Equal(names(tt.detections), names(input)) {
+				t.Errorf("Apply() modified its input: %v", names(tt.detections))
+			}
+
+			if len(applied) != len(tt.steps) {
+				t.Fatalf("Apply() recorded %d step(s), want %d", len(applied), len(tt.steps))
+			}
+			before := len(tt.detections)
+			for i, step := range applied {
+				if step.Type != tt.steps[i].Type || step.Before != before {
+					t.Errorf("step %d = %s with %d before, want %s with %d", i, step.Type, step.Before, tt.steps[i].Type, before)
+				}
+				before = step.After
+			}
+			if before != len(got) {
+				t.Errorf("last step left %d detection(s), want %d", before, len(got))
+			}
+		})
+	}
+}
+
+func TestApplyRecordsDefaults(t *testing.T) {
+	steps := []schema.Step{{Type: schema.StepNMS}}
+	_, applied, err := Apply(nil, steps)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if applied[0].IoU != defaultIoU {
+		t.Errorf("recorded IoU = %g, want %g", applied[0].IoU, defaultIoU)
+	}
+	if steps[0].IoU != 0 {
+		t.Errorf("Apply() modified the steps: IoU = %g", steps[0].IoU)
+	}
+}
+
+func TestApplyRejectsInvalidSteps(t *testing.T) {
+	detections := []domain.Detection{box("car", 0, 0, 10, 10, 0.9)}
+	got, applied, err := Apply(detections, []schema.Step{{Type: schema.StepNMS}, {Type: "blur"}})
+	if err == nil {
+		t.Fatal("Apply() error = nil, want the invalid step")
+	}
+	if got != nil || applied != nil {
+		t.Errorf("Apply() = %v, %v with an error, want nothing", got, applied)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	model := &domain.ModelSpec{Options: []byte(`{"postprocess":[{"type":"nms","iou":0.3}]}`)}
+	own := &domain.JobOptions{Postprocess: []schema.Step{{Type: schema.StepArea, MinArea: 10}}}
+
+	tests := []struct {
+		name  string
+		job   *domain.JobOptions
+		model *domain.ModelSpec
+		want  string
+	}{
+		{name: "job chain", job: own, model: model, want: schema.StepArea},
+		{name: "model default", job: &domain.JobOptions{}, model: model, want: schema.StepNMS},
+		{name: "no job options", model: model, want: schema.StepNMS},
+		{name: "no chain", job: &domain.JobOptions{}, model: &domain.ModelSpec{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := Steps(tt.job, tt.model)
+			if err != nil {
+				t.Fatalf("Steps() error = %v", err)
+			}
+			var got string
+			if len(steps) > 0 {
+				got = steps[0].Type
+			}
+			if got != tt.want {
+				t.Errorf("Steps() starts with %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
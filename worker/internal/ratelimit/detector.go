@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+
+	"govision/worker/internal/domain"
+)
+
+// Wrap returns a detector whose calls go through l. Detectors that accept
+// image bytes keep doing so.
+func Wrap(det domain.Detector, l *Limiter) domain.Detector {
+	limited := &limitedDetector{next: det, limiter: l}
+	if image, ok := det.(domain.ImageDetector); ok {
+		return &limitedImageDetector{limitedDetector: limited, image: image}
+	}
+	return limited
+}
+
+type limitedDetector struct {
+	next    domain.Detector
+	limiter *Limiter
+}
+
+func (d *limitedDetector) Detect(ctx context.Context, imageURL string) (*domain.DetectionResult, error) {
+	var result *domain.DetectionResult
+	err := d.limiter.Do(ctx, func() error {
+		var err error
+		result, err = d.next.Detect(ctx, imageURL)
+		return err
+	})
+	return result, err
+}
+
+type limitedImageDetector struct {
+	*limitedDetector
+	image domain.ImageDetector
+}
+
+func (d *limitedImageDetector) DetectImage(ctx context.Context, image []byte) (*domain.DetectionResult, error) {
+	var result *domain.DetectionResult
+	err := d.limiter.Do(ctx, func() error {
+		var err error
+		result, err = d.image.DetectImage(ctx, image)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in the process. Each worker then has its own
+// budget, so the configured rate applies per process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	tokens       float64
+	updatedAt    time.Time
+	blockedUntil time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-process store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(_ context.Context, name string, capacity, rate float64) (time.Duration, State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b := s.bucket(name, capacity, now)
+	wait, tokens := Consume(b.tokens, now.Sub(b.updatedAt), b.blockedUntil.Sub(now), capacity, rate)
+	b.tokens = tokens
+	b.updatedAt = now
+
+	return wait, State{Tokens: b.tokens, BlockedUntil: b.blockedUntil}, nil
+}
+
+// Block implements Store.
+func (s *MemoryStore) Block(_ context.Context, name string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b := s.bucket(name, 0, now)
+	b.tokens = 0
+	b.updatedAt = now
+	if until := now.Add(d); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	return nil
+}
+
+func (s *MemoryStore) bucket(name string, capacity float64, now time.Time) *memoryBucket {
+	b, ok := s.buckets[name]
+	if !ok {
+		b = &memoryBucket{tokens: capacity, updatedAt: now}
+		s.buckets[name] = b
+	}
+	return b
+}
+
+// Consume refills a bucket holding tokens for elapsed and tries to remove
+// one token. blocked is the time left before the bucket accepts calls again.
+// It returns how long to wait (zero on success) and the tokens left. Stores
+// only persist the result.
+func Consume(tokens float64, elapsed, blocked time.Duration, capacity, rate float64) (time.Duration, float64) {
+	if elapsed > 0 {
+		tokens = min(capacity, tokens+elapsed.Seconds()*rate)
+	}
+	if blocked > 0 {
+		return blocked, tokens
+	}
+	if tokens >= 1 {
+		return 0, tokens - 1
+	}
+	return time.Duration((1 - tokens) / rate * float64(time.Second)), tokens
+}
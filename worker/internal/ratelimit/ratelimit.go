@@ -0,0 +1,270 @@
+// Package ratelimit throttles inference calls with a token bucket whose
+// state can be shared by every worker process, and backs off when the
+// provider answers 429 Too Many Requests.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values for Config.Backend.
+const (
+	// BackendPostgres keeps the bucket in the rate_limits table, shared by
+	// all workers using the same database.
+	BackendPostgres = "postgres"
+	// BackendMemory keeps the bucket in the process.
+	BackendMemory = "memory"
+)
+
+const (
+	defaultBucket     = "roboflow"
+	defaultMaxRetries = 3
+	defaultBackoff    = 5 * time.Second
+	maxSleep          = 30 * time.Second
+)
+
+// ErrRateLimited is returned once a call was still throttled after every
+// retry. The job can be retried later.
+var ErrRateLimited = errors.New("rate limited by inference provider")
+
+var metrics = expvar.NewMap("ratelimit")
+
+// State is a snapshot of a bucket.
+type State struct {
+	Tokens       float64
+	BlockedUntil time.Time
+}
+
+// Store holds the state of named token buckets.
+type Store interface {
+	// Take removes one token from the bucket, which refills at rate tokens
+	// per second up to capacity. It returns zero when a token was taken,
+	// else how long to wait before trying again.
+	Take(ctx context.Context, name string, capacity, rate float64) (time.Duration, State, error)
+	// Block empties the bucket and refuses tokens for d.
+	Block(ctx context.Context, name string, d time.Duration) error
+}
+
+// Config describes the rate limit of inference calls.
+type Config struct {
+	// Rate is the sustained number of calls per second across all workers.
+	// Zero disables rate limiting.
+	Rate float64
+	// Burst is the bucket capacity, the number of calls allowed at once.
+	Burst float64
+	// Backend selects where the bucket lives.
+	Backend string
+	// Bucket names the shared bucket, so several providers or accounts can
+	// be limited independently.
+	Bucket string
+	// MaxRetries bounds how often a throttled call is retried.
+	MaxRetries int
+	// DefaultBackoff is the pause after a 429 without Retry-After.
+	DefaultBackoff time.Duration
+}
+
+// Enabled reports whether calls are rate limited.
+func (c Config) Enabled() bool {
+	return c.Rate > 0
+}
+
+// ConfigFromEnv reads RATE_LIMIT_RPS (0 or unset disables the limiter),
+// RATE_LIMIT_BURST (default: one second of traffic), RATE_LIMIT_BACKEND
+// ("postgres" or "memory"), RATE_LIMIT_BUCKET, RATE_LIMIT_MAX_RETRIES and
+// RATE_LIMIT_DEFAULT_BACKOFF.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:        strings.ToLower(os.Getenv("RATE_LIMIT_BACKEND")),
+		Bucket:         os.Getenv("RATE_LIMIT_BUCKET"),
+		MaxRetries:     defaultMaxRetries,
+		DefaultBackoff: defaultBackoff,
+	}
+
+	switch cfg.Backend {
+	case "":
+		cfg.Backend = BackendPostgres
+	case BackendPostgres, BackendMemory:
+	default:
+		log.Printf("[WARNING] - Invalid RATE_LIMIT_BACKEND %q, using %s", cfg.Backend, BackendPostgres)
+		cfg.Backend = BackendPostgres
+	}
+
+	cfg.Rate = envFloat("RATE_LIMIT_RPS", 0)
+	cfg.Burst = envFloat("RATE_LIMIT_BURST", 0)
+
+	if raw := os.Getenv("RATE_LIMIT_MAX_RETRIES"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value >= 0 {
+			cfg.MaxRetries = value
+		} else {
+			log.Printf("[WARNING] - Invalid RATE_LIMIT_MAX_RETRIES %q, using %d", raw, defaultMaxRetries)
+		}
+	}
+	if raw := os.Getenv("RATE_LIMIT_DEFAULT_BACKOFF"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.DefaultBackoff = value
+		} else {
+			log.Printf("[WARNING] - Invalid RATE_LIMIT_DEFAULT_BACKOFF %q, using %s", raw, defaultBackoff)
+		}
+	}
+
+	return cfg
+}
+
+// Limiter spaces out calls according to a token bucket and pauses every
+// caller sharing the bucket when the provider reports throttling.
+type Limiter struct {
+	cfg   Config
+	store Store
+}
+
+// New validates cfg and creates a limiter backed by store.
+func New(cfg Config, store Store) (*Limiter, error) {
+	if cfg.Rate <= 0 {
+		return nil, errors.New("rate limit must be positive")
+	}
+	if cfg.Burst < 1 {
+		cfg.Burst = max(1, cfg.Rate)
+	}
+	if cfg.Bucket == "" {
+		cfg.Bucket = defaultBucket
+	}
+	if cfg.DefaultBackoff <= 0 {
+		cfg.DefaultBackoff = defaultBackoff
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+
+	return &Limiter{cfg: cfg, store: store}, nil
+}
+
+// Config returns the effective configuration.
+func (l *Limiter) Config() Config {
+	return l.cfg
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	waited := false
+	for {
+		wait, state, err := l.store.Take(ctx, l.cfg.Bucket, l.cfg.Burst, l.cfg.Rate)
+		if err != nil {
+			return fmt.Errorf("rate limiter: %w", err)
+		}
+		record(state)
+
+		if wait <= 0 {
+			if waited {
+				metrics.AddFloat("wait_seconds", time.Since(start).Seconds())
+			}
+			return nil
+		}
+
+		if !waited {
+			metrics.Add("waits", 1)
+			waited = true
+		}
+		if !state.BlockedUntil.IsZero() && time.Until(state.BlockedUntil) > 0 {
+			log.Printf("[RATELIMIT] - Bucket %s blocked until %s, waiting %s",
+				l.cfg.Bucket, state.BlockedUntil.Format(time.RFC3339), wait.Round(time.Millisecond))
+		}
+
+		timer := time.NewTimer(min(wait, maxSleep))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Block pauses every caller sharing the bucket for d, or for the default
+// backoff when d is zero.
+func (l *Limiter) Block(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		d = l.cfg.DefaultBackoff
+	}
+	log.Printf("[RATELIMIT] - Provider throttled bucket %s, pausing for %s", l.cfg.Bucket, d)
+	metrics.Add("throttled", 1)
+	metrics.Set("blocked_until", stringVar(time.Now().Add(d).Format(time.RFC3339)))
+
+	if err := l.store.Block(ctx, l.cfg.Bucket, d); err != nil {
+		return fmt.Errorf("rate limiter: %w", err)
+	}
+	return nil
+}
+
+// throttled is implemented by errors of providers that report rate limits,
+// returning the requested pause (zero when unspecified).
+type throttled interface {
+	Throttled() (time.Duration, bool)
+}
+
+// Do runs call once a token is available. Calls throttled by the provider
+// block the bucket for the requested time and are retried up to MaxRetries
+// times, after which the error wraps ErrRateLimited.
+func (l *Limiter) Do(ctx context.Context, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := l.Wait(ctx); err != nil {
+			return err
+		}
+
+		err := call()
+
+		var t throttled
+		if !errors.As(err, &t) {
+			return err
+		}
+		retryAfter, ok := t.Throttled()
+		if !ok {
+			return err
+		}
+
+		if attempt >= l.cfg.MaxRetries {
+			return fmt.Errorf("%w after %d attempt(s): %v", ErrRateLimited, attempt+1, err)
+		}
+		if blockErr := l.Block(ctx, retryAfter); blockErr != nil {
+			return blockErr
+		}
+		metrics.Add("retries", 1)
+	}
+}
+
+// record publishes the last seen bucket state.
+func record(state State) {
+	tokens := new(expvar.Float)
+	tokens.Set(state.Tokens)
+	metrics.Set("tokens", tokens)
+	if !state.BlockedUntil.IsZero() {
+		metrics.Set("blocked_until", stringVar(state.BlockedUntil.Format(time.RFC3339)))
+	}
+}
+
+func stringVar(value string) *expvar.String {
+	v := new(expvar.String)
+	v.Set(value)
+	return v
+}
+
+func envFloat(name string, fallback float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 {
+		log.Printf("[WARNING] - Invalid %s %q, using %g", name, raw, fallback)
+		return fallback
+	}
+	return value
+}
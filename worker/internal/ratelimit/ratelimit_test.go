@@ -0,0 +1,217 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"govision/worker/internal/domain"
+)
+
+func TestConsume(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		blocked    time.Duration
+		wantWait   time.Duration
+		wantTokens float64
+	}{
+		{name: "full bucket", tokens: 5, wantTokens: 4},
+		{name: "last token", tokens: 1, wantTokens: 0},
+		{name: "empty bucket", tokens: 0, wantWait: 500 * time.Millisecond, wantTokens: 0},
+		{name: "partial token", tokens: 0.5, wantWait: 250 * time.Millisecond, wantTokens: 0.5},
+		{name: "refilled to one token", tokens: 0, elapsed: 500 * time.Millisecond, wantTokens: 0},
+		{name: "refill of a partial token", tokens: 0.25, elapsed: 125 * time.Millisecond, wantWait: 250 * time.Millisecond, wantTokens: 0.5},
+		{name: "refill capped at capacity", tokens: 4, elapsed: time.Hour, wantTokens: 4},
+		{name: "clock going backwards", tokens: 2, elapsed: -time.Second, wantTokens: 1},
+		{name: "blocked", tokens: 5, blocked: 3 * time.Second, wantWait: 3 * time.Second, wantTokens: 5},
+		{name: "refilled while blocked", tokens: 0, elapsed: time.Second, blocked: time.Second, wantWait: time.Second, wantTokens: 2},
+		{name: "block expired", tokens: 3, blocked: -time.Second, wantTokens: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 5 tokens, refilled at 2 per second.
+			wait, tokens := Consume(tt.tokens, tt.elapsed, tt.blocked, 5, 2)
+			if wait != tt.wantWait || tokens != tt.wantTokens {
+				t.Errorf("Consume() = %s, %g tokens, want %s, %g tokens", wait, tokens, tt.wantWait, tt.wantTokens)
+			}
+		})
+	}
+}
+
+// throttledError is a provider error asking to retry after a pause.
+type throttledError struct {
+	retryAfter time.Duration
+}
+
+func (e *throttledError) Error() string { return "429 Too Many Requests" }
+
+func (e *throttledError) Throttled() (time.Duration, bool) { return e.retryAfter, true }
+
+func newLimiter(t *testing.T, cfg Config, store Store) *Limiter {
+	t.Helper()
+	l, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return l
+}
+
+func TestWaitSpacesCallsOutAfterTheBurst(t *testing.T) {
+	l := newLimiter(t, Config{Rate: 20, Burst: 2}, NewMemoryStore())
+
+	start := time.Now()
+	for range 2 {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("burst took %s, want no wait", elapsed)
+	}
+
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("call after the burst came after %s, want about 50ms", elapsed)
+	}
+}
+
+func TestDoBlocksForRetryAfter(t *testing.T) {
+	store := NewMemoryStore()
+	l := newLimiter(t, Config{Rate: 1000, MaxRetries: 3}, store)
+
+	calls := 0
+	start := time.Now()
+	err := l.Do(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("detect: %w", &throttledError{retryAfter: 100 * time.Millisecond})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("call made %d time(s), want 2", calls)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("retry came after %s, want at least the 100ms of Retry-After", elapsed)
+	}
+}
+
+func TestBlockPausesEveryLimiterOfTheBucket(t *testing.T) {
+	store := NewMemoryStore()
+	cfg := Config{Rate: 1000, DefaultBackoff: 100 * time.Millisecond}
+	first, second := newLimiter(t, cfg, store), newLimiter(t, cfg, store)
+
+	start := time.Now()
+	// Zero stands for a 429 without Retry-After.
+	if err := first.Block(context.Background(), 0); err != nil {
+		t.Fatalf("Block() error = %v", err)
+	}
+	if err := second.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("other limiter waited %s, want at least the 100ms default backoff", elapsed)
+	}
+
+	other := newLimiter(t, Config{Rate: 1000, Bucket: "other"}, store)
+	start = time.Now()
+	first.Block(context.Background(), time.Minute)
+	if err := other.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("limiter of another bucket waited %s, want no wait", elapsed)
+	}
+}
+
+func TestBlockDoesNotShortenABlock(t *testing.T) {
+	store := NewMemoryStore()
+	store.Block(context.Background(), "roboflow", time.Minute)
+	store.Block(context.Background(), "roboflow", time.Millisecond)
+
+	wait, _, err := store.Take(context.Background(), "roboflow", 1, 1)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if wait < 59*time.Second {
+		t.Errorf("Take() wait = %s, want the remaining minute", wait)
+	}
+}
+
+func TestDoGivesUpWithErrRateLimited(t *testing.T) {
+	l := newLimiter(t, Config{Rate: 1000, MaxRetries: 2}, NewMemoryStore())
+
+	calls := 0
+	err := l.Do(context.Background(), func() error {
+		calls++
+		return &throttledError{retryAfter: time.Millisecond}
+	})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Do() error = %v, want ErrRateLimited", err)
+	}
+	if calls != 3 {
+		t.Errorf("call made %d time(s), want 1 plus 2 retries", calls)
+	}
+}
+
+func TestDoReturnsOtherErrorsAtOnce(t *testing.T) {
+	l := newLimiter(t, Config{Rate: 1000, MaxRetries: 2}, NewMemoryStore())
+	failure := errors.New("model not found")
+
+	calls := 0
+	err := l.Do(context.Background(), func() error {
+		calls++
+		return failure
+	})
+	if !errors.Is(err, failure) || errors.Is(err, ErrRateLimited) {
+		t.Errorf("Do() error = %v, want the call's error", err)
+	}
+	if calls != 1 {
+		t.Errorf("call made %d time(s), want 1", calls)
+	}
+}
+
+func TestDoStopsWaitingWhenCancelled(t *testing.T) {
+	l := newLimiter(t, Config{Rate: 1000, MaxRetries: 2}, NewMemoryStore())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := l.Do(ctx, func() error { return &throttledError{retryAfter: time.Minute} })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// throttledDetector always reports throttling.
+type throttledDetector struct {
+	calls int
+}
+
+func (d *throttledDetector) Detect(context.Context, string) (*domain.DetectionResult, error) {
+	d.calls++
+	return nil, &throttledError{retryAfter: time.Millisecond}
+}
+
+func TestWrapReturnsErrRateLimited(t *testing.T) {
+	det := &throttledDetector{}
+	limited := Wrap(det, newLimiter(t, Config{Rate: 1000, MaxRetries: 1}, NewMemoryStore()))
+
+	_, err := limited.Detect(context.Background(), "https://example.com/image.jpg")
+	// The worker requeues jobs whose error matches ErrRateLimited, however
+	// it was wrapped on the way.
+	if wrapped := fmt.Errorf("inference failed: %w", err); !errors.Is(wrapped, ErrRateLimited) {
+		t.Errorf("Detect() error = %v, want ErrRateLimited", err)
+	}
+	if det.calls != 2 {
+		t.Errorf("detector called %d time(s), want 2", det.calls)
+	}
+}
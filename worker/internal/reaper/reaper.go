@@ -0,0 +1,196 @@
+// Package reaper finds jobs left in pending by a worker that crashed or lost
+// its message, and either queues them again or fails them. Any number of
+// workers may run a reaper; a Postgres advisory lock elects the one that
+// acts on each run.
+//
+// pending is the only in-progress status: a worker sets it when it starts a
+// job and replaces it with completed or failed. Jobs in the other open
+// statuses have an owner that already retries them and are left alone:
+// queued jobs sit in the outbox or the job queue, which redeliver them, and
+// awaiting_storage jobs belong to the API's spool retrier.
+package reaper
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultInterval    = time.Minute
+	defaultStuckAfter  = 15 * time.Minute
+	defaultMaxAttempts = 3
+	defaultBatchSize   = 100
+)
+
+var metrics = expvar.NewMap("reaper")
+
+// Result is the outcome of one run.
+type Result struct {
+	// Leader is false when another instance held the lock and nothing was
+	// done.
+	Leader bool
+	// Requeued lists the jobs published again.
+	Requeued []string
+	// TimedOut lists the jobs marked failed with reason timeout.
+	TimedOut []string
+}
+
+// Store finds and resolves stuck jobs.
+type Store interface {
+	// Reap takes the reaper lock and, if no other instance holds it, handles
+	// up to limit jobs pending for longer than stuckAfter: jobs attempted
+	// fewer than maxAttempts times are queued again, the others are
+	// dead-lettered with reason timeout.
+	Reap(ctx context.Context, stuckAfter time.Duration, maxAttempts, limit int) (Result, error)
+}
+
+// Config controls the reaper.
+type Config struct {
+	Enabled bool
+	// Interval is how often stuck jobs are looked for.
+	Interval time.Duration
+	// StuckAfter is how long a job may stay pending. It must exceed the
+	// longest inference, tiling included, or live jobs get queued twice.
+	StuckAfter time.Duration
+	// MaxAttempts is the number of times a job may be started before a
+	// stuck job is failed instead of queued again.
+	MaxAttempts int
+	// BatchSize bounds the jobs handled per run.
+	BatchSize int
+}
+
+// ConfigFromEnv reads REAPER_ENABLED, REAPER_INTERVAL, REAPER_STUCK_AFTER,
+// REAPER_MAX_ATTEMPTS and REAPER_BATCH_SIZE.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Enabled:     true,
+		Interval:    defaultInterval,
+		StuckAfter:  defaultStuckAfter,
+		MaxAttempts: defaultMaxAttempts,
+		BatchSize:   defaultBatchSize,
+	}
+
+	if raw := os.Getenv("REAPER_ENABLED"); raw != "" {
+		if value, err := strconv.ParseBool(raw); err == nil {
+			cfg.Enabled = value
+		} else {
+			log.Printf("[WARNING] - Invalid REAPER_ENABLED %q, reaper enabled", raw)
+		}
+	}
+	if raw := os.Getenv("REAPER_INTERVAL"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.Interval = value
+		} else {
+			log.Printf("[WARNING] - Invalid REAPER_INTERVAL %q, using %s", raw, defaultInterval)
+		}
+	}
+	if raw := os.Getenv("REAPER_STUCK_AFTER"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.StuckAfter = value
+		} else {
+			log.Printf("[WARNING] - Invalid REAPER_STUCK_AFTER %q, using %s", raw, defaultStuckAfter)
+		}
+	}
+	if raw := os.Getenv("REAPER_MAX_ATTEMPTS"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			cfg.MaxAttempts = value
+		} else {
+			log.Printf("[WARNING] - Invalid REAPER_MAX_ATTEMPTS %q, using %d", raw, defaultMaxAttempts)
+		}
+	}
+	if raw := os.Getenv("REAPER_BATCH_SIZE"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			cfg.BatchSize = value
+		} else {
+			log.Printf("[WARNING] - Invalid REAPER_BATCH_SIZE %q, using %d", raw, defaultBatchSize)
+		}
+	}
+
+	return cfg
+}
+
+// Reaper periodically resolves stuck jobs.
+type Reaper struct {
+	cfg   Config
+	store Store
+}
+
+// New creates a reaper backed by store.
+func New(cfg Config, store Store) *Reaper {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.StuckAfter <= 0 {
+		cfg.StuckAfter = defaultStuckAfter
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	return &Reaper{cfg: cfg, store: store}
+}
+
+// Run looks for stuck jobs every Interval until ctx is cancelled.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// A full batch means more jobs may be waiting.
+		for ctx.Err() == nil {
+			handled, err := r.reap(ctx)
+			if err != nil {
+				log.Printf("[REAPER] - Run failed: %v", err)
+				metrics.Add("errors", 1)
+				break
+			}
+			if handled < r.cfg.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// reap runs the store once and returns how many jobs it handled.
+func (r *Reaper) reap(ctx context.Context) (int, error) {
+	result, err := r.store.Reap(ctx, r.cfg.StuckAfter, r.cfg.MaxAttempts, r.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.Add("runs", 1)
+	metrics.Set("leader", boolVar(result.Leader))
+	if !result.Leader {
+		return 0, nil
+	}
+
+	for _, jobID := range result.Requeued {
+		log.Printf("[REAPER] - Job %s pending for over %s, queued again", jobID, r.cfg.StuckAfter)
+	}
+	for _, jobID := range result.TimedOut {
+		log.Printf("[REAPER] - Job %s pending for over %s after %d attempt(s), marked failed", jobID, r.cfg.StuckAfter, r.cfg.MaxAttempts)
+	}
+	metrics.Add("requeued", int64(len(result.Requeued)))
+	metrics.Add("timed_out", int64(len(result.TimedOut)))
+	return len(result.Requeued) + len(result.TimedOut), nil
+}
+
+func boolVar(value bool) *expvar.Int {
+	v := new(expvar.Int)
+	if value {
+		v.Set(1)
+	}
+	return v
+}
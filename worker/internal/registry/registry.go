@@ -0,0 +1,214 @@
+// Package registry announces a worker process in the workers table and
+// keeps its entry current with periodic heartbeats, so operators can see
+// which replicas are alive and what they are processing.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+
+	// retention is how long entries of stopped or dead workers are kept.
+	retention     = 7 * 24 * time.Hour
+	pruneInterval = time.Hour
+
+	deregisterTimeout = 5 * time.Second
+)
+
+// Info describes a worker process. It does not change while it runs.
+type Info struct {
+	ID          string
+	Hostname    string
+	Version     string
+	Concurrency int
+	// Interval is the heartbeat interval, from which readers tell whether
+	// the worker is still alive.
+	Interval  time.Duration
+	StartedAt time.Time
+}
+
+// Status is what a worker is doing at the time of a heartbeat.
+type Status struct {
+	// JobIDs lists the jobs in flight.
+	JobIDs []string
+	// Models lists the models the worker served, the default one first.
+	Models []string
+	// Processed counts the messages handled since the worker started and
+	// Failed those dead-lettered among them.
+	Processed int64
+	Failed    int64
+}
+
+// Source reports the current status of a worker.
+type Source interface {
+	Status() Status
+}
+
+// Store persists worker entries.
+type Store interface {
+	// Heartbeat creates or refreshes the entry of info with status.
+	Heartbeat(ctx context.Context, info Info, status Status) error
+	// Deregister marks the worker id as stopped.
+	Deregister(ctx context.Context, id string) error
+	// Prune deletes the entries of workers not seen for olderThan and
+	// returns how many were removed.
+	Prune(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+// Config controls the registration of a worker.
+type Config struct {
+	// Interval is the time between heartbeats.
+	Interval time.Duration
+	// Version is reported with the worker entry.
+	Version string
+}
+
+// ConfigFromEnv reads WORKER_HEARTBEAT_INTERVAL and WORKER_VERSION, which
+// defaults to the VCS revision the binary was built from.
+func ConfigFromEnv() Config {
+	cfg := Config{Interval: defaultInterval, Version: os.Getenv("WORKER_VERSION")}
+
+	if raw := os.Getenv("WORKER_HEARTBEAT_INTERVAL"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			cfg.Interval = value
+		} else {
+			log.Printf("[WARNING] - Invalid WORKER_HEARTBEAT_INTERVAL %q, using %s", raw, defaultInterval)
+		}
+	}
+	if cfg.Version == "" {
+		cfg.Version = buildVersion()
+	}
+
+	return cfg
+}
+
+// Registry keeps the entry of this worker process up to date.
+type Registry struct {
+	info  Info
+	store Store
+}
+
+// New creates the registry of a worker running concurrency jobs at once,
+// with a new unique ID.
+func New(cfg Config, store Store, concurrency int) *Registry {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &Registry{
+		info: Info{
+			ID:          fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+			Hostname:    hostname,
+			Version:     cfg.Version,
+			Concurrency: concurrency,
+			Interval:    cfg.Interval,
+			StartedAt:   time.Now(),
+		},
+		store: store,
+	}
+}
+
+// ID identifies the worker in the workers table and on the jobs it
+// processes.
+func (r *Registry) ID() string {
+	return r.info.ID
+}
+
+// Run sends a heartbeat with the status of source every Interval until ctx
+// is cancelled, then marks the worker as stopped. Failed heartbeats are
+// logged and retried on the next tick.
+func (r *Registry) Run(ctx context.Context, source Source) {
+	r.prune(ctx)
+	r.heartbeat(ctx, source)
+
+	ticker := time.NewTicker(r.info.Interval)
+	defer ticker.Stop()
+
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			r.deregister()
+			return
+		case <-ticker.C:
+		}
+
+		r.heartbeat(ctx, source)
+		if time.Since(lastPrune) >= pruneInterval {
+			lastPrune = time.Now()
+			r.prune(ctx)
+		}
+	}
+}
+
+func (r *Registry) heartbeat(ctx context.Context, source Source) {
+	if err := r.store.Heartbeat(ctx, r.info, source.Status()); err != nil && ctx.Err() == nil {
+		log.Printf("[REGISTRY] - Heartbeat of worker %s failed: %v", r.info.ID, err)
+	}
+}
+
+// deregister runs after ctx is cancelled, so it uses its own deadline.
+func (r *Registry) deregister() {
+	ctx, cancel := context.WithTimeout(context.Background(), deregisterTimeout)
+	defer cancel()
+
+	if err := r.store.Deregister(ctx, r.info.ID); err != nil {
+		log.Printf("[REGISTRY] - Failed to deregister worker %s: %v", r.info.ID, err)
+		return
+	}
+	log.Printf("[REGISTRY] - Worker %s deregistered", r.info.ID)
+}
+
+func (r *Registry) prune(ctx context.Context) {
+	pruned, err := r.store.Prune(ctx, retention)
+	if err != nil {
+		log.Printf("[REGISTRY] - Prune failed: %v", err)
+		return
+	}
+	if pruned > 0 {
+		log.Printf("[REGISTRY] - Pruned %d worker(s) not seen for %s", pruned, retention)
+	}
+}
+
+// buildVersion returns the VCS revision embedded in the binary, or "dev".
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+
+	var revision string
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
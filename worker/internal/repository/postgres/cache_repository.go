@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"govision/worker/internal/cache"
+	"govision/worker/internal/domain"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CacheRepository implements cache.Store on the inference_cache table.
+type CacheRepository struct {
+	db *gorm.DB
+}
+
+var _ cache.Store = (*CacheRepository)(nil)
+
+// NewCacheRepository creates a PostgreSQL-backed result cache store.
+func NewCacheRepository(db *gorm.DB) *CacheRepository {
+	return &CacheRepository{db: db}
+}
+
+// Get implements cache.Store. Expired entries are reported as missing.
+func (r *CacheRepository) Get(ctx context.Context, key string) (*cache.Entry, error) {
+	var row domain.DBCacheEntry
+	err := r.db.WithContext(ctx).
+		Where("cache_key = ? AND (expires_at IS NULL OR expires_at > now())", key).
+		First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, cache.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cache.Entry{
+		Key:          row.CacheKey,
+		JobID:        row.JobID,
+		ModelName:    row.ModelName,
+		ModelVersion: row.ModelVersion,
+		CreatedAt:    row.CreatedAt,
+		ExpiresAt:    row.ExpiresAt,
+	}
+	if err := json.Unmarshal([]byte(row.Result), &entry.Result); err != nil {
+		return nil, fmt.Errorf("failed to decode cached result: %w", err)
+	}
+	return entry, nil
+}
+
+// Put implements cache.Store.
+func (r *CacheRepository) Put(ctx context.Context, entry cache.Entry) error {
+	result, err := json.Marshal(entry.Result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+
+	row := domain.DBCacheEntry{
+		CacheKey:     entry.Key,
+		JobID:        entry.JobID,
+		ModelName:    entry.ModelName,
+		ModelVersion: entry.ModelVersion,
+		Result:       string(result),
+		CreatedAt:    entry.CreatedAt,
+		ExpiresAt:    entry.ExpiresAt,
+	}
+
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"job_id", "model_name", "model_version", "result", "created_at", "expires_at"}),
+	}).Create(&row).Error
+}
+
+// Purge implements cache.Store.
+func (r *CacheRepository) Purge(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("expires_at IS NOT NULL AND expires_at <= now()").
+		Delete(&domain.DBCacheEntry{})
+	return result.RowsAffected, result.Error
+}
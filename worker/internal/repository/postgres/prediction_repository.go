@@ -1,7 +1,10 @@
 package postgres
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"time"
 
 	"govision/worker/internal/domain"
 	"govision/worker/internal/repository"
@@ -22,17 +25,37 @@ func NewPredictionRepository(db *gorm.DB) repository.PredictionRepository {
 }
 
 // CreatePendingJob inserts a new job with status "pending" before processing begins.
-// Uses ON CONFLICT to avoid duplicates if the job already exists.
-func (r *PredictionRepository) CreatePendingJob(jobID string, imageURL string) error {
+// Jobs already recorded by the API (e.g. while their image was spooled) are
+// moved to "pending" instead of being duplicated, unless a result was already
+// saved for them. Every call counts one attempt and keeps the message, so the
+// reaper can tell when the job started and publish it again, and records the
+// worker that started the job.
+func (r *PredictionRepository) CreatePendingJob(jobID string, imageURL string, message []byte, workerID string) error {
+	now := time.Now()
 	job := domain.Job{
-		JobID:    jobID,
-		ImageURL: imageURL,
-		Status:   "pending",
+		JobID:     jobID,
+		ImageURL:  imageURL,
+		Status:    "pending",
+		Attempts:  1,
+		StartedAt: &now,
+		Message:   string(message),
+		WorkerID:  nullable(workerID),
 	}
 
+	assignments := clause.AssignmentColumns([]string{"status", "image_url", "started_at", "message", "worker_id"})
+	assignments = append(assignments, clause.Assignment{
+		Column: clause.Column{Name: "attempts"},
+		Value:  gorm.Expr("jobs.attempts + 1"),
+	})
+
 	if err := r.db.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "job_id"}},
-		DoNothing: true,
+		DoUpdates: assignments,
+		// A duplicate message racing the one that completed the job must
+		// not move it back to pending.
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{
+			SQL: "NOT EXISTS (SELECT 1 FROM processed_messages WHERE processed_messages.job_id = jobs.job_id)",
+		}}},
 	}).Create(&job).Error; err != nil {
 		return err
 	}
@@ -44,33 +67,96 @@ func (r *PredictionRepository) CreatePendingJob(jobID string, imageURL string) e
 // SaveJobResult persists a completed job and all its predictions in a single
 // database transaction. If any step fails, the entire operation is rolled back.
 func (r *PredictionRepository) SaveJobResult(result domain.JobResult) error {
+	outputs := []byte("{}")
+	if len(result.Outputs) > 0 {
+		encoded, err := json.Marshal(result.Outputs)
+		if err != nil {
+			return fmt.Errorf("failed to encode outputs: %w", err)
+		}
+		outputs = encoded
+	}
+
+	postprocess := []byte("[]")
+	if len(result.Postprocess) > 0 {
+		encoded, err := json.Marshal(result.Postprocess)
+		if err != nil {
+			return fmt.Errorf("failed to encode post-processing steps: %w", err)
+		}
+		postprocess = encoded
+	}
+
 	return r.db.Transaction(func(tx *gorm.DB) error {
+		if result.DedupeKey != "" {
+			// Claim the key first: a concurrent or later copy of the same
+			// message finds it taken and saves nothing.
+			claim := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&domain.DBProcessedMessage{
+				DedupeKey:   result.DedupeKey,
+				JobID:       result.JobID,
+				ProcessedAt: result.ProcessedAt,
+			})
+			if claim.Error != nil {
+				return claim.Error
+			}
+			if claim.RowsAffected == 0 {
+				return repository.ErrAlreadyProcessed
+			}
+		}
+
 		job := domain.Job{
-			JobID:       result.JobID,
-			ImageURL:    result.ImageURL,
-			Status:      result.Status,
-			ProcessedAt: result.ProcessedAt,
+			JobID:          result.JobID,
+			ImageURL:       result.ImageURL,
+			Status:         result.Status,
+			ImageWidth:     result.Image.Width,
+			ImageHeight:    result.Image.Height,
+			OriginalWidth:  result.Image.OriginalWidth,
+			OriginalHeight: result.Image.OriginalHeight,
+			ScaleFactor:    result.Image.ScaleFactor,
+			Outputs:        string(outputs),
+			ModelName:      result.ModelName,
+			ModelVersion:   result.ModelVersion,
+			TaskType:       result.TaskType,
+			Postprocess:    string(postprocess),
+			CachedFrom:     nullable(result.CachedFrom),
+			WorkerID:       nullable(result.WorkerID),
+			ProcessedAt:    result.ProcessedAt,
 		}
 
 		if err := tx.Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "job_id"}},
-			DoUpdates: clause.AssignmentColumns([]string{"status", "processed_at"}),
+			Columns: []clause.Column{{Name: "job_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"status", "processed_at",
+				"image_width", "image_height", "original_width", "original_height", "scale_factor",
+				"outputs", "model_name", "model_version", "task_type", "postprocess", "cached_from", "worker_id",
+			}),
 		}).Create(&job).Error; err != nil {
 			return err
 		}
 
-		if len(result.Predictions) > 0 {
-			dbPredictions := make([]domain.DBPrediction, len(result.Predictions))
-			for i, p := range result.Predictions {
+		if len(result.Detections) > 0 {
+			dbPredictions := make([]domain.DBPrediction, len(result.Detections))
+			for i, p := range result.Detections {
+				points, err := encodeGeometry(p.Points, len(p.Points))
+				if err != nil {
+					return err
+				}
+				keypoints, err := encodeGeometry(p.Keypoints, len(p.Keypoints))
+				if err != nil {
+					return err
+				}
+
 				dbPredictions[i] = domain.DBPrediction{
-					JobID:      result.JobID,
-					X:          p.X,
-					Y:          p.Y,
-					Width:      p.Width,
-					Height:     p.Height,
-					Confidence: p.Confidence,
-					Class:      p.Class,
-					ClassID:    p.ClassID,
+					JobID:       result.JobID,
+					X:           p.X,
+					Y:           p.Y,
+					Width:       p.Width,
+					Height:      p.Height,
+					Confidence:  p.Confidence,
+					Class:       p.Class,
+					ClassID:     p.ClassID,
+					DetectionID: p.DetectionID,
+					ParentID:    p.ParentID,
+					Points:      points,
+					Keypoints:   keypoints,
 				}
 			}
 
@@ -79,7 +165,110 @@ func (r *PredictionRepository) SaveJobResult(result domain.JobResult) error {
 			}
 		}
 
-		log.Printf("[POSTGRES] - Job %s saved with %d prediction(s)", result.JobID, len(result.Predictions))
+		if c := result.Classification; c != nil && len(c.Classes) > 0 {
+			predicted := make(map[string]bool, len(c.Predicted))
+			for _, class := range c.Predicted {
+				predicted[class] = true
+			}
+
+			dbClassifications := make([]domain.DBClassification, len(c.Classes))
+			for i, score := range c.Classes {
+				dbClassifications[i] = domain.DBClassification{
+					JobID:      result.JobID,
+					Class:      score.Class,
+					ClassID:    score.ClassID,
+					Confidence: score.Confidence,
+					Predicted:  predicted[score.Class],
+				}
+			}
+
+			if err := tx.Create(&dbClassifications).Error; err != nil {
+				return err
+			}
+
+			log.Printf("[POSTGRES] - Job %s saved with classification %q (%d class score(s))", result.JobID, c.Top, len(c.Classes))
+			return nil
+		}
+
+		log.Printf("[POSTGRES] - Job %s saved with %d prediction(s)", result.JobID, len(result.Detections))
 		return nil
 	})
 }
+
+// IsProcessed reports whether a result was saved for dedupeKey.
+func (r *PredictionRepository) IsProcessed(dedupeKey string) (bool, error) {
+	var count int64
+	if err := r.db.Model(&domain.DBProcessedMessage{}).Where("dedupe_key = ?", dedupeKey).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SaveDeadLetter records the dead letter, or counts one more failure of a
+// job already dead-lettered, marks the job as failed and appends a
+// dead_lettered event to its history, in one transaction.
+func (r *PredictionRepository) SaveDeadLetter(letter domain.DeadLetter) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return saveDeadLetter(tx, letter, "worker")
+	})
+}
+
+// saveDeadLetter writes letter within tx, recording actor as the author of
+// the dead_lettered event.
+func saveDeadLetter(tx *gorm.DB, letter domain.DeadLetter, actor string) error {
+	detail, err := json.Marshal(map[string]string{"reason": letter.Reason, "error": letter.Error})
+	if err != nil {
+		return fmt.Errorf("failed to encode event detail: %w", err)
+	}
+
+	if err := tx.Exec(`
+		INSERT INTO dead_letters (job_id, reason, error, payload, model_name)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (job_id) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			error = EXCLUDED.error,
+			payload = EXCLUDED.payload,
+			model_name = EXCLUDED.model_name,
+			attempts = dead_letters.attempts + 1,
+			last_failed_at = now(),
+			replayed_at = NULL`,
+		letter.JobID, letter.Reason, letter.Error, string(letter.Payload), letter.ModelName,
+	).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Exec(`UPDATE jobs SET status = 'failed' WHERE job_id = ?`, letter.JobID).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Exec(
+		`INSERT INTO job_events (job_id, event_type, actor, detail) VALUES (?, 'dead_lettered', ?, ?)`,
+		letter.JobID, actor, string(detail),
+	).Error; err != nil {
+		return err
+	}
+
+	log.Printf("[POSTGRES] - Job %s dead-lettered (%s)", letter.JobID, letter.Reason)
+	return nil
+}
+
+// encodeGeometry serializes polygon points or keypoints for a JSONB column.
+// Empty geometry is stored as NULL.
+func encodeGeometry(v any, n int) (domain.JSON, error) {
+	if n == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode geometry: %w", err)
+	}
+	return domain.JSON(encoded), nil
+}
+
+// nullable maps an empty string to NULL.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"govision/worker/internal/ratelimit"
+
+	"gorm.io/gorm"
+)
+
+// RateLimitRepository implements ratelimit.Store on the rate_limits table,
+// so every worker connected to the database draws from the same buckets.
+// Buckets are updated under a row lock and timed with the database clock,
+// which keeps them consistent across hosts.
+type RateLimitRepository struct {
+	db *gorm.DB
+}
+
+var _ ratelimit.Store = (*RateLimitRepository)(nil)
+
+// NewRateLimitRepository creates a PostgreSQL-backed bucket store.
+func NewRateLimitRepository(db *gorm.DB) *RateLimitRepository {
+	return &RateLimitRepository{db: db}
+}
+
+// bucketRow is a bucket read under lock, with durations relative to the
+// transaction's now().
+type bucketRow struct {
+	Tokens       float64
+	Elapsed      float64
+	Blocked      float64
+	BlockedUntil *time.Time
+}
+
+// Take implements ratelimit.Store.
+func (r *RateLimitRepository) Take(ctx context.Context, name string, capacity, rate float64) (time.Duration, ratelimit.State, error) {
+	var (
+		wait  time.Duration
+		state ratelimit.State
+	)
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(
+			`INSERT INTO rate_limits (name, tokens, updated_at) VALUES (?, ?, now()) ON CONFLICT (name) DO NOTHING`,
+			name, capacity,
+		).Error; err != nil {
+			return err
+		}
+
+		var row bucketRow
+		if err := tx.Raw(`
+			SELECT tokens,
+			       EXTRACT(EPOCH FROM (now() - updated_at))::float8 AS elapsed,
+			       COALESCE(EXTRACT(EPOCH FROM (blocked_until - now())), 0)::float8 AS blocked,
+			       blocked_until
+			FROM rate_limits WHERE name = ? FOR UPDATE`, name,
+		).Scan(&row).Error; err != nil {
+			return err
+		}
+
+		var tokens float64
+		wait, tokens = ratelimit.Consume(row.Tokens, seconds(row.Elapsed), seconds(row.Blocked), capacity, rate)
+		state = ratelimit.State{Tokens: tokens}
+		if row.BlockedUntil != nil && row.Blocked > 0 {
+			state.BlockedUntil = *row.BlockedUntil
+		}
+
+		return tx.Exec(`UPDATE rate_limits SET tokens = ?, updated_at = now() WHERE name = ?`, tokens, name).Error
+	})
+	if err != nil {
+		return 0, state, err
+	}
+	return wait, state, nil
+}
+
+// Block implements ratelimit.Store. A bucket already blocked for longer
+// keeps its later deadline.
+func (r *RateLimitRepository) Block(ctx context.Context, name string, d time.Duration) error {
+	return r.db.WithContext(ctx).Exec(`
+		INSERT INTO rate_limits (name, tokens, updated_at, blocked_until)
+		VALUES (?, 0, now(), now() + make_interval(secs => ?))
+		ON CONFLICT (name) DO UPDATE SET
+			tokens = 0,
+			updated_at = now(),
+			blocked_until = GREATEST(COALESCE(rate_limits.blocked_until, now()), EXCLUDED.blocked_until)`,
+		name, d.Seconds(),
+	).Error
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"govision/worker/internal/domain"
+	"govision/worker/internal/reaper"
+
+	"govision/pkg/outbox"
+
+	"gorm.io/gorm"
+)
+
+// reaperLockKey is the advisory lock electing the reaper that acts on a
+// run. Any constant works as long as every worker uses the same one.
+const reaperLockKey int64 = 0x676f766973696f6e // "govision"
+
+// ReaperRepository implements reaper.Store. Stuck jobs are queued again
+// through the outbox, so the API relay publishes them once the transaction
+// that moved them back to queued commits.
+type ReaperRepository struct {
+	db *gorm.DB
+}
+
+var _ reaper.Store = (*ReaperRepository)(nil)
+
+// NewReaperRepository creates a PostgreSQL-backed reaper store.
+func NewReaperRepository(db *gorm.DB) *ReaperRepository {
+	return &ReaperRepository{db: db}
+}
+
+// stuckJob is a pending job read under lock.
+type stuckJob struct {
+	JobID     string
+	Attempts  int
+	Message   string
+	StartedAt *time.Time
+}
+
+// Reap implements reaper.Store. The advisory lock is held for the
+// transaction only, so another instance takes over as soon as the leader
+// stops. Stuck jobs are compared against the database clock.
+func (r *ReaperRepository) Reap(ctx context.Context, stuckAfter time.Duration, maxAttempts, limit int) (reaper.Result, error) {
+	var result reaper.Result
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw(`SELECT pg_try_advisory_xact_lock(?)`, reaperLockKey).Scan(&result.Leader).Error; err != nil {
+			return err
+		}
+		if !result.Leader {
+			return nil
+		}
+
+		var jobs []stuckJob
+		if err := tx.Raw(`
+			SELECT job_id, attempts, message, started_at
+			FROM jobs
+			WHERE status = 'pending'
+				AND COALESCE(started_at, created_at) < now() - make_interval(secs => ?)
+			ORDER BY COALESCE(started_at, created_at)
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED`,
+			stuckAfter.Seconds(), limit,
+		).Scan(&jobs).Error; err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			if job.Attempts < maxAttempts && job.Message != "" {
+				if err := requeue(tx, job); err != nil {
+					return fmt.Errorf("job %s: %w", job.JobID, err)
+				}
+				result.Requeued = append(result.Requeued, job.JobID)
+				continue
+			}
+
+			letter := domain.DeadLetter{
+				JobID:     job.JobID,
+				Reason:    domain.ReasonTimeout,
+				Error:     fmt.Sprintf("pending for over %s after %d attempt(s)", stuckAfter, job.Attempts),
+				Payload:   []byte(job.Message),
+				ModelName: modelName(job.Message),
+			}
+			if err := saveDeadLetter(tx, letter, "reaper"); err != nil {
+				return fmt.Errorf("job %s: %w", job.JobID, err)
+			}
+			result.TimedOut = append(result.TimedOut, job.JobID)
+		}
+		return nil
+	})
+	if err != nil {
+		return reaper.Result{}, err
+	}
+	return result, nil
+}
+
+// requeue records the job's last message in the outbox, moves the job back
+// to queued and appends a requeued event to its history.
+func requeue(tx *gorm.DB, job stuckJob) error {
+	payload := outbox.ReplayPayload{JobID: job.JobID, Body: []byte(job.Message)}
+	dedupeKey := fmt.Sprintf("reap:%s:%d", job.JobID, job.Attempts)
+	if err := outbox.Enqueue(tx, outbox.EventJobReplayed, dedupeKey, payload); err != nil {
+		return err
+	}
+
+	if err := tx.Exec(`UPDATE jobs SET status = 'queued' WHERE job_id = ?`, job.JobID).Error; err != nil {
+		return err
+	}
+
+	detail, err := json.Marshal(map[string]any{"attempts": job.Attempts, "started_at": job.StartedAt})
+	if err != nil {
+		return err
+	}
+	return tx.Exec(
+		`INSERT INTO job_events (job_id, event_type, actor, detail) VALUES (?, 'requeued', 'reaper', ?)`,
+		job.JobID, string(detail),
+	).Error
+}
+
+// modelName returns the model requested by message, or "" when it cannot
+// be decoded.
+func modelName(message string) string {
+	job, err := domain.DecodeJobMessage([]byte(message))
+	if err != nil {
+		return ""
+	}
+	return job.Model.ModelName()
+}
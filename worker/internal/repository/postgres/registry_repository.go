@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"govision/worker/internal/registry"
+
+	"gorm.io/gorm"
+)
+
+// RegistryRepository implements registry.Store on the workers table.
+// Heartbeats are timed with the database clock, so readers on other hosts
+// compare them consistently.
+type RegistryRepository struct {
+	db *gorm.DB
+}
+
+var _ registry.Store = (*RegistryRepository)(nil)
+
+// NewRegistryRepository creates a PostgreSQL-backed worker registry store.
+func NewRegistryRepository(db *gorm.DB) *RegistryRepository {
+	return &RegistryRepository{db: db}
+}
+
+// Heartbeat implements registry.Store.
+func (r *RegistryRepository) Heartbeat(ctx context.Context, info registry.Info, status registry.Status) error {
+	models, err := json.Marshal(nonNil(status.Models))
+	if err != nil {
+		return err
+	}
+	jobs, err := json.Marshal(nonNil(status.JobIDs))
+	if err != nil {
+		return err
+	}
+	interval := max(1, int(math.Ceil(info.Interval.Seconds())))
+
+	return r.db.WithContext(ctx).Exec(`
+		INSERT INTO workers (id, hostname, version, models, concurrency, heartbeat_interval,
+			current_jobs, processed, failed, started_at, last_heartbeat_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, now())
+		ON CONFLICT (id) DO UPDATE SET
+			models = EXCLUDED.models,
+			current_jobs = EXCLUDED.current_jobs,
+			processed = EXCLUDED.processed,
+			failed = EXCLUDED.failed,
+			last_heartbeat_at = now(),
+			stopped_at = NULL`,
+		info.ID, info.Hostname, info.Version, string(models), info.Concurrency, interval,
+		string(jobs), status.Processed, status.Failed, info.StartedAt,
+	).Error
+}
+
+// Deregister implements registry.Store.
+func (r *RegistryRepository) Deregister(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Exec(
+		`UPDATE workers SET stopped_at = now(), current_jobs = '[]' WHERE id = ?`, id,
+	).Error
+}
+
+// Prune implements registry.Store.
+func (r *RegistryRepository) Prune(ctx context.Context, olderThan time.Duration) (int64, error) {
+	result := r.db.WithContext(ctx).Exec(
+		`DELETE FROM workers WHERE last_heartbeat_at < now() - make_interval(secs => ?)`, olderThan.Seconds(),
+	)
+	return result.RowsAffected, result.Error
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
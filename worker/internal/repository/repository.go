@@ -1,12 +1,23 @@
 package repository
 
 import (
+	"errors"
+
 	"govision/worker/internal/domain"
 )
 
+// ErrAlreadyProcessed is returned by SaveJobResult when a result was already
+// saved for the same dedupe key. Nothing is written in that case.
+var ErrAlreadyProcessed = errors.New("message already processed")
+
 // PredictionRepository defines the contract for persisting job results
 // and their associated predictions.
 type PredictionRepository interface {
-	CreatePendingJob(jobID string, imageURL string) error
+	CreatePendingJob(jobID string, imageURL string, message []byte, workerID string) error
 	SaveJobResult(job domain.JobResult) error
+	// IsProcessed reports whether a result was saved for dedupeKey.
+	IsProcessed(dedupeKey string) (bool, error)
+	// SaveDeadLetter records a message the worker gave up on and marks its
+	// job as failed.
+	SaveDeadLetter(letter domain.DeadLetter) error
 }
@@ -0,0 +1,127 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"govision/worker/internal/domain"
+)
+
+const (
+	fakeImageSize  = 640
+	maxDetections  = 5
+	fakeClassCount = 3
+)
+
+// Detector is a deterministic domain.Detector that never leaves the process.
+// By default it derives a stable set of detections from the image URL, so the
+// same image always yields the same result. Result and Err override that
+// behaviour, which lets tests script specific outcomes. A classification
+// TaskType makes it generate class scores instead of boxes. DetectImage
+// derives its detections from the image bytes the same way.
+type Detector struct {
+	TaskType string
+	Result   *domain.DetectionResult
+	Err      error
+	Calls    int
+
+	mu sync.Mutex
+}
+
+var (
+	_ domain.Detector      = (*Detector)(nil)
+	_ domain.ImageDetector = (*Detector)(nil)
+)
+
+// New creates a fake detector that generates detections from the image URL.
+func New() *Detector {
+	return &Detector{}
+}
+
+// Detect returns the scripted result or error, or generated detections.
+func (d *Detector) Detect(ctx context.Context, imageURL string) (*domain.DetectionResult, error) {
+	return d.detect(ctx, []byte(imageURL), imageURL)
+}
+
+// DetectImage is Detect for an encoded image.
+func (d *Detector) DetectImage(ctx context.Context, image []byte) (*domain.DetectionResult, error) {
+	return d.detect(ctx, image, fmt.Sprintf("%d byte image", len(image)))
+}
+
+func (d *Detector) detect(ctx context.Context, seed []byte, source string) (*domain.DetectionResult, error) {
+	d.mu.Lock()
+	d.Calls++
+	d.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if d.Err != nil {
+		return nil, d.Err
+	}
+	if d.Result != nil {
+		return d.Result, nil
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write(seed)
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	if domain.IsClassificationTask(d.TaskType) {
+		return d.classify(rng), nil
+	}
+
+	detections := make([]domain.Detection, 1+rng.Intn(maxDetections))
+	for i := range detections {
+		classID := rng.Intn(fakeClassCount)
+		width := 20 + rng.Float64()*100
+		height := 20 + rng.Float64()*100
+		detections[i] = domain.Detection{
+			X:           width/2 + rng.Float64()*(fakeImageSize-width),
+			Y:           height/2 + rng.Float64()*(fakeImageSize-height),
+			Width:       width,
+			Height:      height,
+			Confidence:  0.5 + rng.Float64()*0.5,
+			Class:       fmt.Sprintf("class_%d", classID),
+			ClassID:     classID,
+			DetectionID: fmt.Sprintf("fake-%016x-%d", h.Sum64(), i),
+		}
+	}
+
+	log.Printf("[FAKE] - Generated %d detection(s) for %s", len(detections), source)
+	return &domain.DetectionResult{Detections: detections}, nil
+}
+
+// classify generates a score per class, highest first.
+func (d *Detector) classify(rng *rand.Rand) *domain.DetectionResult {
+	classes := make([]domain.ClassScore, fakeClassCount)
+	for i := range classes {
+		classes[i] = domain.ClassScore{Class: fmt.Sprintf("class_%d", i), ClassID: i, Confidence: rng.Float64()}
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Confidence > classes[j].Confidence })
+
+	c := &domain.Classification{
+		MultiLabel: d.TaskType == domain.TaskMultiLabelClassification,
+		Top:        classes[0].Class,
+		Confidence: classes[0].Confidence,
+		Classes:    classes,
+	}
+	if c.MultiLabel {
+		c.Predicted = []string{}
+		for _, class := range classes {
+			if class.Confidence >= 0.5 {
+				c.Predicted = append(c.Predicted, class.Class)
+			}
+		}
+	} else {
+		c.Predicted = []string{c.Top}
+	}
+
+	log.Printf("[FAKE] - Generated classification %q", c.Top)
+	return &domain.DetectionResult{Classification: c}
+}
@@ -2,38 +2,299 @@ package rabbitmq
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"govision/pkg/amqpconn"
+	"govision/pkg/queue"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+const (
+	// resubscribeDelay is the pause between failed attempts to subscribe on
+	// a live connection. Lost connections are retried by the connection
+	// manager.
+	resubscribeDelay = time.Second
+	// retryTimeout bounds the publication of a requeued message to the
+	// retry queue, or its dead letter.
+	retryTimeout = 5 * time.Second
+	// attemptsHeader counts the deliveries of a message that were requeued.
+	attemptsHeader = "x-govision-attempts"
+)
+
+// RabbitMQConsumer implements queue.Consumer on a RabbitMQ queue.
+//
+// Requeued messages are not put back at the head of the job queue, where a
+// job that keeps failing would be delivered again at once and forever.
+// They are published to the retry queue (see amqpconn.RetryQueue) with the
+// backoff as their TTL and their attempt count in a header, and acknowledged.
+// Once the TTL runs out the broker moves them back to the job queue. The
+// retry queue only expires the message at its head, so a delay can stretch
+// to the longest one queued before it. A message requeued on its last
+// attempt is dead-lettered instead.
 type RabbitMQConsumer struct {
+	conn *amqpconn.Manager
+	cfg  queue.Config
+	tag  string
+
+	mu      sync.Mutex
 	channel *amqp.Channel
-	queue   string
 }
 
-func NewRabbitMQConsumer(ch *amqp.Channel, queue string) *RabbitMQConsumer {
+var _ queue.Consumer = (*RabbitMQConsumer)(nil)
+
+// NewRabbitMQConsumer creates a consumer of cfg.Queue. cfg.Prefetch caps the
+// number of unacknowledged deliveries the broker pushes to the channel, and
+// the retry settings of cfg apply to requeued messages.
+func NewRabbitMQConsumer(conn *amqpconn.Manager, cfg queue.Config) *RabbitMQConsumer {
 	return &RabbitMQConsumer{
-		channel: ch,
-		queue:   queue,
+		conn: conn,
+		cfg:  cfg.WithDefaults(),
+		tag:  consumerTag(),
 	}
 }
 
+// Consume subscribes to the queue and returns its deliveries. The returned
+// channel outlives broker restarts: when the channel or connection is lost
+// the consumer opens a new channel and subscribes again. Deliveries received
+// before a reconnection can no longer be acknowledged; the broker redelivers
+// them.
+//
+// Cancelling ctx cancels the subscription and closes the returned channel,
+// but keeps the AMQP channel open so deliveries already handed out can still
+// be acknowledged. Call Close once they are settled.
 func (c *RabbitMQConsumer) Consume(
 	ctx context.Context,
-) (<-chan amqp.Delivery, error) {
-	msgs, err := c.channel.Consume(
-		c.queue,
-		"",
+) (<-chan queue.Delivery, error) {
+	ch, msgs, err := c.subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan queue.Delivery)
+	go func() {
+		defer close(out)
+		for {
+			c.forward(ctx, ch, msgs, out)
+			if ctx.Err() != nil {
+				if err := ch.Cancel(c.tag, false); err != nil {
+					log.Printf("[RABBITMQ] - Failed to cancel subscription: %v", err)
+				}
+				return
+			}
+			ch.Close()
+
+			log.Println("[RABBITMQ] - Subscription lost, resubscribing")
+			if ch, msgs, err = c.resubscribe(ctx); err != nil {
+				return
+			}
+			log.Printf("[RABBITMQ] - Resubscribed to %s", c.cfg.Queue)
+		}
+	}()
+
+	return out, nil
+}
+
+// forward passes deliveries on until msgs is closed or ctx is cancelled.
+func (c *RabbitMQConsumer) forward(ctx context.Context, ch *amqp.Channel, msgs <-chan amqp.Delivery, out chan<- queue.Delivery) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			select {
+			case out <- delivery{msg: msg, channel: ch, consumer: c}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// resubscribe retries subscribe until it succeeds or ctx is cancelled.
+func (c *RabbitMQConsumer) resubscribe(ctx context.Context) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	for {
+		ch, msgs, err := c.subscribe(ctx)
+		if err == nil {
+			return ch, msgs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		log.Printf("[RABBITMQ] - Failed to resubscribe: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// subscribe opens a channel, waiting for the broker if needed, and starts
+// consuming the queue on it.
+func (c *RabbitMQConsumer) subscribe(ctx context.Context) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := c.conn.Channel(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ch.Qos(c.cfg.Prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to set prefetch count: %w", err)
+	}
+	// Requeued messages are published on this channel and only acknowledged
+	// once the broker confirmed them.
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	msgs, err := ch.Consume(
+		c.cfg.Queue,
+		c.tag,
 		false,
 		false,
 		false,
 		false,
 		nil,
 	)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	c.channel = ch
+	c.mu.Unlock()
+
+	return ch, msgs, nil
+}
 
+// Close closes the consuming channel. The broker requeues every delivery
+// that was not acknowledged.
+func (c *RabbitMQConsumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.channel == nil || c.channel.IsClosed() {
+		return nil
+	}
+	return c.channel.Close()
+}
+
+// delivery adapts an AMQP delivery to queue.Delivery. channel is the one it
+// was received on, where it must be settled.
+type delivery struct {
+	msg      amqp.Delivery
+	channel  *amqp.Channel
+	consumer *RabbitMQConsumer
+}
+
+func (d delivery) ID() string   { return d.msg.MessageId }
+func (d delivery) Body() []byte { return d.msg.Body }
+func (d delivery) Ack() error   { return d.msg.Ack(false) }
+
+// Nack drops the message, or requeues it through the retry queue. Requeuing
+// it on its last attempt dead-letters it. When the retry queue cannot be
+// reached the message is requeued at once, as without a retry queue.
+func (d delivery) Nack(requeue bool) error {
+	if !requeue {
+		return d.msg.Nack(false, false)
+	}
+
+	cfg := d.consumer.cfg
+	attempt := attempts(d.msg.Headers) + 1
+	ctx, cancel := context.WithTimeout(context.Background(), retryTimeout)
+	defer cancel()
+
+	if attempt >= cfg.MaxAttempts {
+		if cfg.DeadLetter == nil {
+			log.Printf("[RABBITMQ] - Dropping message %s after %d attempts", d.msg.MessageId, attempt)
+		} else if err := cfg.DeadLetter(ctx, d.msg.MessageId, d.msg.Body, attempt); err != nil {
+			log.Printf("[RABBITMQ] - Failed to dead-letter message %s after %d attempts, requeueing: %v", d.msg.MessageId, attempt, err)
+			return d.msg.Nack(false, true)
+		}
+		return d.msg.Ack(false)
+	}
+
+	if err := d.retry(ctx, attempt, cfg.Backoff(attempt)); err != nil {
+		log.Printf("[RABBITMQ] - Failed to delay message %s, requeueing at once: %v", d.msg.MessageId, err)
+		return d.msg.Nack(false, true)
+	}
+	return d.msg.Ack(false)
+}
+
+// retry publishes a copy of the message to the retry queue, to return to
+// the job queue after delay, and waits for the broker to confirm it.
+func (d delivery) retry(ctx context.Context, attempt int, delay time.Duration) error {
+	headers := amqp.Table{}
+	for name, value := range d.msg.Headers {
+		headers[name] = value
+	}
+	headers[attemptsHeader] = int64(attempt)
+
+	confirmation, err := d.channel.PublishWithDeferredConfirmWithContext(ctx,
+		"",
+		amqpconn.RetryQueue(d.consumer.cfg.Queue),
+		false,
+		false,
+		amqp.Publishing{
+			Headers:      headers,
+			ContentType:  d.msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    d.msg.MessageId,
+			Timestamp:    d.msg.Timestamp,
+			Expiration:   strconv.FormatInt(max(delay.Milliseconds(), 1), 10),
+			Body:         d.msg.Body,
+		},
+	)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
 	}
+	if !acked {
+		return fmt.Errorf("retry queue %s rejected the message", amqpconn.RetryQueue(d.consumer.cfg.Queue))
+	}
+	return nil
+}
 
-	return msgs, nil
+// attempts reads the number of earlier requeues of a message from its
+// headers; messages never requeued have none.
+func attempts(headers amqp.Table) int {
+	switch value := headers[attemptsHeader].(type) {
+	case int8:
+		return int(value)
+	case int16:
+		return int(value)
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case int:
+		return value
+	default:
+		return 0
+	}
+}
+
+// consumerTag names the subscription after the host and process, so it can
+// be cancelled and recognized in the management UI.
+func consumerTag() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("govision-%s-%d", host, os.Getpid())
 }
@@ -0,0 +1,30 @@
+package rabbitmq
+
+import (
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{name: "never requeued", headers: nil, want: 0},
+		{name: "other headers", headers: amqp.Table{"traceparent": "00-abc"}, want: 0},
+		// The broker hands integers back in the width it stored them in.
+		{name: "int64", headers: amqp.Table{attemptsHeader: int64(3)}, want: 3},
+		{name: "int32", headers: amqp.Table{attemptsHeader: int32(4)}, want: 4},
+		{name: "int8", headers: amqp.Table{attemptsHeader: int8(5)}, want: 5},
+		{name: "not a number", headers: amqp.Table{attemptsHeader: "6"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attempts(tt.headers); got != tt.want {
+				t.Errorf("attempts() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
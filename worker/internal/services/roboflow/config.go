@@ -0,0 +1,246 @@
+package roboflow
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"govision/worker/internal/domain"
+)
+
+// DefaultBaseURL is the hosted Roboflow Serverless API.
+const DefaultBaseURL = "https://serverless.roboflow.com"
+
+// Supported values for Config.AuthMode.
+const (
+	// AuthQuery sends the API key as the api_key query parameter.
+	AuthQuery = "query"
+	// AuthBearer sends the API key in an Authorization: Bearer header.
+	AuthBearer = "bearer"
+	// AuthNone sends no credentials, for local servers without auth.
+	AuthNone = "none"
+)
+
+// Supported values for Config.RequestStyle.
+const (
+	// RequestURL passes the image URL and lets the server fetch it.
+	RequestURL = "url"
+	// RequestBase64 downloads the image in the worker and posts it as a
+	// base64 body, for servers that cannot reach the storage backend.
+	RequestBase64 = "base64"
+)
+
+const (
+	defaultMaxIdleConns    = 16
+	defaultIdleConnTimeout = 90 * time.Second
+	defaultImageInput      = "image"
+)
+
+// Config describes how to reach a Roboflow-compatible inference server,
+// either the hosted API or a self-hosted Roboflow Inference deployment.
+type Config struct {
+	APIKey       string
+	Model        string
+	BaseURL      string
+	AuthMode     string
+	RequestStyle string
+	// TaskType selects how model responses are parsed (see the domain.Task*
+	// constants). Empty means object detection.
+	TaskType string
+	Timeout  time.Duration
+
+	// MaxIdleConns caps the pooled keep-alive connections to the server.
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+
+	// Parameters are extra inference inputs: query parameters of a model
+	// request (e.g. confidence) or workflow inputs.
+	Parameters map[string]any
+
+	// WorkspaceID and WorkflowID identify the workflow run by the
+	// WorkflowClient. ImageInput names the workflow input receiving the image
+	// and DetectionsOutput, when set, restricts detections to a single named
+	// output.
+	WorkspaceID      string
+	WorkflowID       string
+	ImageInput       string
+	DetectionsOutput string
+
+	// CACertFile adds a PEM bundle to the trusted roots, for servers using
+	// an internal CA. InsecureSkipVerify disables verification entirely.
+	CACertFile         string
+	InsecureSkipVerify bool
+}
+
+// ConfigFromEnv reads ROBOFLOW_API_KEY, ROBOFLOW_MODEL, ROBOFLOW_BASE_URL,
+// ROBOFLOW_AUTH_MODE, ROBOFLOW_REQUEST_STYLE, ROBOFLOW_TASK_TYPE, ROBOFLOW_TIMEOUT,
+// ROBOFLOW_MAX_IDLE_CONNS, ROBOFLOW_IDLE_CONN_TIMEOUT, ROBOFLOW_CA_CERT,
+// ROBOFLOW_TLS_INSECURE_SKIP_VERIFY, ROBOFLOW_PARAMETERS (a JSON object) and
+// the workflow settings ROBOFLOW_WORKSPACE_ID, ROBOFLOW_WORKFLOW_ID,
+// ROBOFLOW_WORKFLOW_IMAGE_INPUT and ROBOFLOW_WORKFLOW_DETECTIONS_OUTPUT.
+// ROBOFLOW_WORKFLOW_PARAMETERS is still read when ROBOFLOW_PARAMETERS is unset.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		APIKey:       os.Getenv("ROBOFLOW_API_KEY"),
+		Model:        os.Getenv("ROBOFLOW_MODEL"),
+		BaseURL:      os.Getenv("ROBOFLOW_BASE_URL"),
+		AuthMode:     strings.ToLower(os.Getenv("ROBOFLOW_AUTH_MODE")),
+		RequestStyle: strings.ToLower(os.Getenv("ROBOFLOW_REQUEST_STYLE")),
+		TaskType:     strings.ToLower(os.Getenv("ROBOFLOW_TASK_TYPE")),
+		CACertFile:   os.Getenv("ROBOFLOW_CA_CERT"),
+
+		WorkspaceID:      os.Getenv("ROBOFLOW_WORKSPACE_ID"),
+		WorkflowID:       os.Getenv("ROBOFLOW_WORKFLOW_ID"),
+		ImageInput:       os.Getenv("ROBOFLOW_WORKFLOW_IMAGE_INPUT"),
+		DetectionsOutput: os.Getenv("ROBOFLOW_WORKFLOW_DETECTIONS_OUTPUT"),
+	}
+
+	for _, name := range []string{"ROBOFLOW_PARAMETERS", "ROBOFLOW_WORKFLOW_PARAMETERS"} {
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(raw), &cfg.Parameters); err != nil {
+			log.Printf("[WARNING] - Invalid %s, ignoring: %v", name, err)
+		}
+		break
+	}
+
+	cfg.Timeout = envDuration("ROBOFLOW_TIMEOUT", defaultTimeout)
+	cfg.IdleConnTimeout = envDuration("ROBOFLOW_IDLE_CONN_TIMEOUT", defaultIdleConnTimeout)
+
+	if raw := os.Getenv("ROBOFLOW_MAX_IDLE_CONNS"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			cfg.MaxIdleConns = value
+		} else {
+			log.Printf("[WARNING] - Invalid ROBOFLOW_MAX_IDLE_CONNS %q, using %d", raw, defaultMaxIdleConns)
+		}
+	}
+
+	if raw := os.Getenv("ROBOFLOW_TLS_INSECURE_SKIP_VERIFY"); raw != "" {
+		if value, err := strconv.ParseBool(raw); err == nil {
+			cfg.InsecureSkipVerify = value
+		} else {
+			log.Printf("[WARNING] - Invalid ROBOFLOW_TLS_INSECURE_SKIP_VERIFY %q, ignoring", raw)
+		}
+	}
+
+	return cfg
+}
+
+// withDefaults fills unset fields and validates the enumerated options.
+func (cfg Config) withDefaults() (Config, error) {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.AuthMode == "" {
+		cfg.AuthMode = AuthQuery
+	}
+	if cfg.RequestStyle == "" {
+		cfg.RequestStyle = RequestURL
+	}
+	if cfg.TaskType == "" {
+		cfg.TaskType = domain.TaskObjectDetection
+	}
+	if cfg.ImageInput == "" {
+		cfg.ImageInput = defaultImageInput
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaultMaxIdleConns
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = defaultIdleConnTimeout
+	}
+
+	switch cfg.AuthMode {
+	case AuthQuery, AuthBearer:
+		if cfg.APIKey == "" {
+			return cfg, fmt.Errorf("ROBOFLOW_API_KEY is required for auth mode %q", cfg.AuthMode)
+		}
+	case AuthNone:
+	default:
+		return cfg, fmt.Errorf("unknown roboflow auth mode %q", cfg.AuthMode)
+	}
+
+	switch cfg.TaskType {
+	case domain.TaskObjectDetection, domain.TaskInstanceSegmentation, domain.TaskKeypointDetection,
+		domain.TaskClassification, domain.TaskMultiLabelClassification:
+	default:
+		return cfg, fmt.Errorf("unknown model task type %q", cfg.TaskType)
+	}
+
+	switch cfg.RequestStyle {
+	case RequestURL, RequestBase64:
+	default:
+		return cfg, fmt.Errorf("unknown roboflow request style %q", cfg.RequestStyle)
+	}
+
+	return cfg, nil
+}
+
+// newHTTPClient builds a client whose pool is sized for a single upstream:
+// a dedicated inference server is called over and over, so every idle
+// connection is kept for that host instead of the default two.
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read roboflow CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConns,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{Timeout: cfg.Timeout, Transport: transport}, nil
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		log.Printf("[WARNING] - Invalid %s %q, using %s", name, raw, fallback)
+		return fallback
+	}
+	return value
+}
@@ -2,71 +2,185 @@ package roboflow
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"govision/worker/internal/domain"
 )
 
-const defaultTimeout = 120 * time.Second
+const (
+	defaultTimeout = 120 * time.Second
+	maxImageSize   = 32 << 20
+)
 
-// APIError represents a non-retryable HTTP error from the Roboflow API.
+// APIError represents an HTTP error from the Roboflow API. Only 429 Too
+// Many Requests is worth retrying; see Throttled.
 type APIError struct {
 	StatusCode int
 	Body       string
+	// RetryAfter is the pause requested by the Retry-After header, if any.
+	RetryAfter time.Duration
 }
 
 func (e *APIError) Error() string {
 	return fmt.Sprintf("roboflow returned status %d: %s", e.StatusCode, e.Body)
 }
 
+// Throttled reports whether the request was rejected by the provider's rate
+// limit, and how long it asked to wait (zero when unspecified).
+func (e *APIError) Throttled() (time.Duration, bool) {
+	return e.RetryAfter, e.StatusCode == http.StatusTooManyRequests
+}
+
+// newAPIError builds the error for a non-200 response.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter reads a Retry-After value given in seconds or as an HTTP
+// date. Invalid or past values yield zero.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// Client implements domain.Detector using the Roboflow Serverless API or a
+// self-hosted Roboflow Inference server.
 type Client struct {
-	apiKey     string
-	model      string
+	cfg        Config
 	httpClient *http.Client
 }
 
-func NewClient(apiKey, model string) *Client {
-	return &Client{
-		apiKey: apiKey,
-		model:  model,
-		httpClient: &http.Client{
-			Timeout: defaultTimeout,
-		},
+var (
+	_ domain.Detector      = (*Client)(nil)
+	_ domain.ImageDetector = (*Client)(nil)
+)
+
+// NewClient validates cfg and creates a client for it.
+func NewClient(cfg Config) (*Client, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Model == "" {
+		return nil, errors.New("ROBOFLOW_MODEL must be set")
 	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{cfg: cfg, httpClient: httpClient}, nil
 }
 
-func (c *Client) Detect(ctx context.Context, imageURL string) (*domain.RoboflowResponse, error) {
-	log.Printf("[ROBOFLOW] - Sending image URL to Roboflow: %s", imageURL)
+// Detect sends the image URL to Roboflow and returns its predictions as
+// normalized detections.
+func (c *Client) Detect(ctx context.Context, imageURL string) (*domain.DetectionResult, error) {
+	log.Printf("[ROBOFLOW] - Sending image to %s (%s): %s", c.cfg.BaseURL, c.cfg.RequestStyle, imageURL)
 
-	result, err := c.infer(ctx, imageURL)
+	raw, err := c.infer(ctx, imageURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("roboflow inference failed: %w", err)
 	}
+	return c.parse(raw)
+}
+
+// DetectImage posts the encoded image inline, whatever the request style.
+func (c *Client) DetectImage(ctx context.Context, image []byte) (*domain.DetectionResult, error) {
+	raw, err := c.infer(ctx, "", image)
+	if err != nil {
+		return nil, fmt.Errorf("roboflow inference failed: %w", err)
+	}
+	return c.parse(raw)
+}
+
+// parse decodes a model response according to the configured task type.
+func (c *Client) parse(raw []byte) (*domain.DetectionResult, error) {
+	if domain.IsClassificationTask(c.cfg.TaskType) {
+		classification, err := parseClassification(raw, c.cfg.TaskType == domain.TaskMultiLabelClassification)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[ROBOFLOW] - Classification completed. Top class %q (%.2f).", classification.Top, classification.Confidence)
+		return &domain.DetectionResult{Classification: classification}, nil
+	}
+
+	var result response
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode roboflow response: %w", err)
+	}
 
-	predCount := len(result.Predictions)
+	detections := toDetections(result.Predictions)
 
-	log.Printf("[ROBOFLOW] - Inference completed. %d prediction(s) returned.", predCount)
-	return result, nil
+	log.Printf("[ROBOFLOW] - Inference completed. %d prediction(s) returned.", len(detections))
+	return &domain.DetectionResult{Detections: detections}, nil
 }
 
-func (c *Client) infer(ctx context.Context, imageURL string) (*domain.RoboflowResponse, error) {
-	endpoint := fmt.Sprintf(
-		"https://serverless.roboflow.com/%s?api_key=%s&image=%s",
-		c.model,
-		c.apiKey,
-		url.QueryEscape(imageURL),
-	)
+// infer posts the image to the model endpoint and returns the raw response.
+// A non-nil image is sent inline instead of imageURL.
+func (c *Client) infer(ctx context.Context, imageURL string, image []byte) ([]byte, error) {
+	query := url.Values{}
+	for name, value := range c.cfg.Parameters {
+		query.Set(name, fmt.Sprint(value))
+	}
+	if c.cfg.AuthMode == AuthQuery {
+		query.Set("api_key", c.cfg.APIKey)
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	var body io.Reader
+	switch {
+	case image != nil:
+		body = strings.NewReader(base64.StdEncoding.EncodeToString(image))
+	case c.cfg.RequestStyle == RequestBase64:
+		encoded, err := fetchBase64(ctx, c.httpClient, imageURL)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(encoded)
+	default:
+		query.Set("image", imageURL)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s", c.cfg.BaseURL, strings.TrimLeft(c.cfg.Model, "/"))
+	if encoded := query.Encode(); encoded != "" {
+		endpoint += "?" + encoded
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if c.cfg.AuthMode == AuthBearer {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -80,15 +194,37 @@ func (c *Client) infer(ctx context.Context, imageURL string) (*domain.RoboflowRe
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBytes)}
+		return nil, newAPIError(resp, respBytes)
 	}
 
-	var roboflowResp domain.RoboflowResponse
-	if err := json.Unmarshal(respBytes, &roboflowResp); err != nil {
-		return nil, fmt.Errorf("failed to decode roboflow response: %w", err)
+	return respBytes, nil
+}
+
+// fetchBase64 downloads the image so it can be posted inline to servers
+// that have no route to the storage backend.
+func fetchBase64(ctx context.Context, httpClient *http.Client, imageURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create image request: %w", err)
 	}
 
-	fmt.Printf("RESULT RAW: %+v", roboflowResp)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(data) > maxImageSize {
+		return "", fmt.Errorf("image exceeds %d bytes", maxImageSize)
+	}
 
-	return &roboflowResp, nil
+	return base64.StdEncoding.EncodeToString(data), nil
 }
@@ -0,0 +1,332 @@
+package roboflow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"govision/worker/internal/domain"
+)
+
+const testImage = "\xff\xd8\xff\xe0fake jpeg\xff\xd9"
+
+// inferenceRequest is what the fake inference server saw of a model call.
+type inferenceRequest struct {
+	Path          string
+	Query         map[string]string
+	Authorization string
+	ContentType   string
+	Body          string
+}
+
+// fakeInference serves /images/photo.jpg and answers every POST with one
+// prediction, as a model or a workflow response, recording the request.
+type fakeInference struct {
+	mu       sync.Mutex
+	requests []inferenceRequest
+}
+
+func (f *fakeInference) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == "/images/photo.jpg" {
+		w.Write([]byte(testImage))
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	query := map[string]string{}
+	for name := range r.URL.Query() {
+		query[name] = r.URL.Query().Get(name)
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, inferenceRequest{
+		Path:          r.URL.Path,
+		Query:         query,
+		Authorization: r.Header.Get("Authorization"),
+		ContentType:   r.Header.Get("Content-Type"),
+		Body:          string(body),
+	})
+	f.mu.Unlock()
+
+	if r.URL.Query().Get("api_key") == "throttled" {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"message":"slow down"}`))
+		return
+	}
+	predictions := `{"predictions":[{"x":10,"y":20,"width":4,"height":6,"confidence":0.9,"class":"car","class_id":2}]}`
+	if strings.Contains(r.URL.Path, "/workflows/") {
+		w.Write([]byte(`{"outputs":[{"detections":` + predictions + `}]}`))
+		return
+	}
+	w.Write([]byte(predictions))
+}
+
+func (f *fakeInference) last(t *testing.T) inferenceRequest {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) != 1 {
+		t.Fatalf("server received %d inference request(s), want 1", len(f.requests))
+	}
+	return f.requests[0]
+}
+
+func TestClientRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		inline bool // call DetectImage instead of Detect
+
+		path          string
+		query         map[string]string
+		authorization string
+		body          string
+	}{
+		{
+			name:  "query auth, url style",
+			cfg:   Config{APIKey: "secret", Model: "cars/3", Parameters: map[string]any{"confidence": 0.5}},
+			path:  "/cars/3",
+			query: map[string]string{"api_key": "secret", "confidence": "0.5", "image": "{server}/images/photo.jpg"},
+		},
+		{
+			name:          "bearer auth",
+			cfg:           Config{APIKey: "secret", Model: "cars/3", AuthMode: AuthBearer},
+			path:          "/cars/3",
+			query:         map[string]string{"image": "{server}/images/photo.jpg"},
+			authorization: "Bearer secret",
+		},
+		{
+			name:  "no auth",
+			cfg:   Config{Model: "cars/3", AuthMode: AuthNone},
+			path:  "/cars/3",
+			query: map[string]string{"image": "{server}/images/photo.jpg"},
+		},
+		{
+			name:  "base url with a path prefix",
+			cfg:   Config{APIKey: "secret", Model: "/cars/3", BaseURL: "{server}/inference/"},
+			path:  "/inference/cars/3",
+			query: map[string]string{"api_key": "secret", "image": "{server}/images/photo.jpg"},
+		},
+		{
+			name:  "base64 style",
+			cfg:   Config{APIKey: "secret", Model: "cars/3", RequestStyle: RequestBase64},
+			path:  "/cars/3",
+			query: map[string]string{"api_key": "secret"},
+			body:  base64.StdEncoding.EncodeToString([]byte(testImage)),
+		},
+		{
+			name:   "inline image",
+			cfg:    Config{APIKey: "secret", Model: "cars/3"},
+			inline: true,
+			path:   "/cars/3",
+			query:  map[string]string{"api_key": "secret"},
+			body:   base64.StdEncoding.EncodeToString([]byte(testImage)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeInference{}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			expand := func(s string) string { return strings.ReplaceAll(s, "{server}", server.URL) }
+
+			cfg := tt.cfg
+			cfg.BaseURL = expand(cfg.BaseURL)
+			if cfg.BaseURL == "" {
+				cfg.BaseURL = server.URL
+			}
+			client, err := NewClient(cfg)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			var result *domain.DetectionResult
+			if tt.inline {
+				result, err = client.DetectImage(context.Background(), []byte(testImage))
+			} else {
+				result, err = client.Detect(context.Background(), server.URL+"/images/photo.jpg")
+			}
+			if err != nil {
+				t.Fatalf("detection error = %v", err)
+			}
+			if len(result.Detections) != 1 || result.Detections[0].Class != "car" {
+				t.Errorf("detections = %+v, want one car", result.Detections)
+			}
+
+			got := fake.last(t)
+			if got.Path != tt.path {
+				t.Errorf("path = %q, want %q", got.Path, tt.path)
+			}
+			if len(got.Query) != len(tt.query) {
+				t.Errorf("query = %v, want %v", got.Query, tt.query)
+			}
+			for name, want := range tt.query {
+				if got.Query[name] != expand(want) {
+					t.Errorf("query %s = %q, want %q", name, got.Query[name], expand(want))
+				}
+			}
+			if got.Authorization != tt.authorization {
+				t.Errorf("Authorization = %q, want %q", got.Authorization, tt.authorization)
+			}
+			if got.Body != tt.body {
+				t.Errorf("body = %q, want %q", got.Body, tt.body)
+			}
+			if tt.body != "" && got.ContentType != "application/x-www-form-urlencoded" {
+				t.Errorf("Content-Type = %q, want application/x-www-form-urlencoded", got.ContentType)
+			}
+		})
+	}
+}
+
+func TestWorkflowClientRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+
+		apiKey        string
+		authorization string
+		image         workflowImage
+	}{
+		{
+			name:   "query auth, url style",
+			cfg:    Config{APIKey: "secret"},
+			apiKey: "secret",
+			image:  workflowImage{Type: "url", Value: "{server}/images/photo.jpg"},
+		},
+		{
+			name:          "bearer auth",
+			cfg:           Config{APIKey: "secret", AuthMode: AuthBearer},
+			authorization: "Bearer secret",
+			image:         workflowImage{Type: "url", Value: "{server}/images/photo.jpg"},
+		},
+		{
+			name:   "base64 style",
+			cfg:    Config{APIKey: "secret", RequestStyle: RequestBase64},
+			apiKey: "secret",
+			image:  workflowImage{Type: "base64", Value: base64.StdEncoding.EncodeToString([]byte(testImage))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeInference{}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			cfg := tt.cfg
+			cfg.BaseURL, cfg.WorkspaceID, cfg.WorkflowID = server.URL+"/", "acme", "count cars"
+			client, err := NewWorkflowClient(cfg)
+			if err != nil {
+				t.Fatalf("NewWorkflowClient() error = %v", err)
+			}
+
+			result, err := client.Detect(context.Background(), server.URL+"/images/photo.jpg")
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if len(result.Detections) != 1 {
+				t.Errorf("got %d detection(s), want 1", len(result.Detections))
+			}
+
+			got := fake.last(t)
+			if got.Path != "/acme/workflows/count cars" {
+				t.Errorf("path = %q, want /acme/workflows/count cars", got.Path)
+			}
+			if got.Authorization != tt.authorization {
+				t.Errorf("Authorization = %q, want %q", got.Authorization, tt.authorization)
+			}
+
+			var body struct {
+				APIKey string                   `json:"api_key"`
+				Inputs map[string]workflowImage `json:"inputs"`
+			}
+			if err := json.Unmarshal([]byte(got.Body), &body); err != nil {
+				t.Fatalf("decoding request body: %v", err)
+			}
+			if body.APIKey != tt.apiKey {
+				t.Errorf("api_key = %q, want %q", body.APIKey, tt.apiKey)
+			}
+			want := tt.image
+			want.Value = strings.ReplaceAll(want.Value, "{server}", server.URL)
+			if body.Inputs["image"] != want {
+				t.Errorf("image input = %+v, want %+v", body.Inputs["image"], want)
+			}
+		})
+	}
+}
+
+func TestClientThrottled(t *testing.T) {
+	server := httptest.NewServer(&fakeInference{})
+	defer server.Close()
+
+	client, err := NewClient(Config{APIKey: "throttled", Model: "cars/3", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	_, err = client.Detect(context.Background(), server.URL+"/images/photo.jpg")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Detect() error = %v, want an *APIError", err)
+	}
+	if wait, throttled := apiErr.Throttled(); !throttled || wait != 7*time.Second {
+		t.Errorf("Throttled() = %s, %t, want 7s, true", wait, throttled)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(&fakeInference{})
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("writing CA file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "untrusted certificate", cfg: Config{}, wantErr: true},
+		{name: "CA certificate file", cfg: Config{CACertFile: caFile}},
+		{name: "verification disabled", cfg: Config{InsecureSkipVerify: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.APIKey, cfg.Model, cfg.BaseURL = "secret", "cars/3", server.URL
+			client, err := NewClient(cfg)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			_, err = client.Detect(context.Background(), "https://images.example.com/photo.jpg")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Detect() error = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClientRejectsBadCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("writing CA file: %v", err)
+	}
+
+	if _, err := NewClient(Config{APIKey: "secret", Model: "cars/3", CACertFile: caFile}); err == nil {
+		t.Error("NewClient() error = nil, want an error for a file without certificates")
+	}
+}
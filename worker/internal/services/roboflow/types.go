@@ -0,0 +1,135 @@
+package roboflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"govision/worker/internal/domain"
+)
+
+// prediction is a single object in a Roboflow serverless response.
+type prediction struct {
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Confidence  float64 `json:"confidence"`
+	Class       string  `json:"class"`
+	ClassID     int     `json:"class_id"`
+	DetectionID string  `json:"detection_id"`
+	ParentID    string  `json:"parent_id"`
+
+	// Points is the polygon of segmentation models, Keypoints the landmarks
+	// of pose models. Both are absent for plain object detection.
+	Points    []domain.Point    `json:"points"`
+	Keypoints []domain.Keypoint `json:"keypoints"`
+}
+
+// response represents the top-level response from the Roboflow Serverless API.
+type response struct {
+	Predictions []prediction `json:"predictions"`
+}
+
+// classificationResponse is returned by classification models. Single-label
+// models list their classes as an array and report the winner in Top;
+// multi-label models map class names to scores and list the classes above
+// threshold in PredictedClasses.
+type classificationResponse struct {
+	Top              string          `json:"top"`
+	Confidence       float64         `json:"confidence"`
+	Predictions      json.RawMessage `json:"predictions"`
+	PredictedClasses []string        `json:"predicted_classes"`
+}
+
+type classScore struct {
+	Class      string  `json:"class"`
+	ClassID    int     `json:"class_id"`
+	Confidence float64 `json:"confidence"`
+}
+
+// parseClassification converts a classification response. multiLabel tells
+// how to read it when the response shape alone is ambiguous.
+func parseClassification(raw []byte, multiLabel bool) (*domain.Classification, error) {
+	var resp classificationResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode classification response: %w", err)
+	}
+
+	var classes []domain.ClassScore
+	preds := bytes.TrimSpace(resp.Predictions)
+	switch {
+	case len(preds) == 0 || bytes.Equal(preds, []byte("null")):
+	case preds[0] == '[':
+		var scores []classScore
+		if err := json.Unmarshal(preds, &scores); err != nil {
+			return nil, fmt.Errorf("failed to decode class scores: %w", err)
+		}
+		for _, s := range scores {
+			classes = append(classes, domain.ClassScore{Class: s.Class, ClassID: s.ClassID, Confidence: s.Confidence})
+		}
+	case preds[0] == '{':
+		var scores map[string]classScore
+		if err := json.Unmarshal(preds, &scores); err != nil {
+			return nil, fmt.Errorf("failed to decode class scores: %w", err)
+		}
+		for name, s := range scores {
+			classes = append(classes, domain.ClassScore{Class: name, ClassID: s.ClassID, Confidence: s.Confidence})
+		}
+	default:
+		return nil, fmt.Errorf("unexpected classification predictions: %s", preds)
+	}
+
+	if len(classes) == 0 && resp.Top != "" {
+		classes = append(classes, domain.ClassScore{Class: resp.Top, Confidence: resp.Confidence})
+	}
+
+	sort.SliceStable(classes, func(i, j int) bool { return classes[i].Confidence > classes[j].Confidence })
+
+	result := &domain.Classification{
+		MultiLabel: multiLabel || resp.PredictedClasses != nil,
+		Top:        resp.Top,
+		Confidence: resp.Confidence,
+		Classes:    classes,
+	}
+
+	if result.Top == "" && len(classes) > 0 {
+		result.Top = classes[0].Class
+		result.Confidence = classes[0].Confidence
+	}
+
+	if result.MultiLabel {
+		result.Predicted = resp.PredictedClasses
+		if result.Predicted == nil {
+			result.Predicted = []string{}
+		}
+	} else if result.Top != "" {
+		result.Predicted = []string{result.Top}
+	}
+
+	if result.Top == "" && len(result.Predicted) == 0 {
+		return nil, fmt.Errorf("classification response has no classes")
+	}
+	return result, nil
+}
+
+func toDetections(predictions []prediction) []domain.Detection {
+	detections := make([]domain.Detection, len(predictions))
+	for i, p := range predictions {
+		detections[i] = domain.Detection{
+			X:           p.X,
+			Y:           p.Y,
+			Width:       p.Width,
+			Height:      p.Height,
+			Confidence:  p.Confidence,
+			Class:       p.Class,
+			ClassID:     p.ClassID,
+			DetectionID: p.DetectionID,
+			ParentID:    p.ParentID,
+			Points:      p.Points,
+			Keypoints:   p.Keypoints,
+		}
+	}
+	return detections
+}
@@ -0,0 +1,272 @@
+package roboflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"govision/worker/internal/domain"
+)
+
+// WorkflowClient implements domain.Detector by running a Roboflow Workflow.
+// Workflow outputs that hold detections become the job's detections and the
+// first classification output becomes its classification; every other named
+// output (counts, crops...) is kept verbatim in DetectionResult.Outputs.
+type WorkflowClient struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+var (
+	_ domain.Detector      = (*WorkflowClient)(nil)
+	_ domain.ImageDetector = (*WorkflowClient)(nil)
+)
+
+// NewWorkflowClient validates cfg and creates a workflow client for it.
+func NewWorkflowClient(cfg Config) (*WorkflowClient, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.WorkspaceID == "" || cfg.WorkflowID == "" {
+		return nil, errors.New("ROBOFLOW_WORKSPACE_ID and ROBOFLOW_WORKFLOW_ID must be set")
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WorkflowClient{cfg: cfg, httpClient: httpClient}, nil
+}
+
+// workflowRequest is the body of a workflow run.
+type workflowRequest struct {
+	APIKey string         `json:"api_key,omitempty"`
+	Inputs map[string]any `json:"inputs"`
+}
+
+// workflowImage is an image input of a workflow run.
+type workflowImage struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// workflowResponse holds one set of named outputs per input image.
+type workflowResponse struct {
+	Outputs []map[string]json.RawMessage `json:"outputs"`
+}
+
+// workflowDetections is how workflows serialize a detections output.
+type workflowDetections struct {
+	Predictions []prediction `json:"predictions"`
+}
+
+// Detect runs the workflow on the image and parses its outputs.
+func (c *WorkflowClient) Detect(ctx context.Context, imageURL string) (*domain.DetectionResult, error) {
+	log.Printf("[ROBOFLOW] - Running workflow %s/%s (%s): %s", c.cfg.WorkspaceID, c.cfg.WorkflowID, c.cfg.RequestStyle, imageURL)
+
+	image := workflowImage{Type: "url", Value: imageURL}
+	if c.cfg.RequestStyle == RequestBase64 {
+		encoded, err := fetchBase64(ctx, c.httpClient, imageURL)
+		if err != nil {
+			return nil, fmt.Errorf("roboflow workflow failed: %w", err)
+		}
+		image = workflowImage{Type: "base64", Value: encoded}
+	}
+
+	return c.detect(ctx, image)
+}
+
+// DetectImage runs the workflow on the encoded image sent inline.
+func (c *WorkflowClient) DetectImage(ctx context.Context, image []byte) (*domain.DetectionResult, error) {
+	return c.detect(ctx, workflowImage{Type: "base64", Value: base64.StdEncoding.EncodeToString(image)})
+}
+
+func (c *WorkflowClient) detect(ctx context.Context, image workflowImage) (*domain.DetectionResult, error) {
+	resp, err := c.run(ctx, image)
+	if err != nil {
+		return nil, fmt.Errorf("roboflow workflow failed: %w", err)
+	}
+	if len(resp.Outputs) == 0 {
+		return nil, errors.New("roboflow workflow returned no outputs")
+	}
+
+	result, err := parseWorkflowOutputs(resp.Outputs[0], c.cfg.DetectionsOutput, c.cfg.TaskType)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[ROBOFLOW] - Workflow completed. %d detection(s), %d other output(s).", len(result.Detections), len(result.Outputs))
+	return result, nil
+}
+
+func (c *WorkflowClient) run(ctx context.Context, image workflowImage) (*workflowResponse, error) {
+	body := workflowRequest{Inputs: make(map[string]any, len(c.cfg.Parameters)+1)}
+	for name, value := range c.cfg.Parameters {
+		body.Inputs[name] = value
+	}
+	body.Inputs[c.cfg.ImageInput] = image
+	if c.cfg.AuthMode == AuthQuery {
+		body.APIKey = c.cfg.APIKey
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode workflow request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/workflows/%s",
+		c.cfg.BaseURL, url.PathEscape(c.cfg.WorkspaceID), url.PathEscape(c.cfg.WorkflowID))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.AuthMode == AuthBearer {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to roboflow failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, respBytes)
+	}
+
+	var workflowResp workflowResponse
+	if err := json.Unmarshal(respBytes, &workflowResp); err != nil {
+		return nil, fmt.Errorf("failed to decode workflow response: %w", err)
+	}
+
+	return &workflowResp, nil
+}
+
+// parseWorkflowOutputs splits the named outputs of one image into detections
+// and everything else. When detectionsOutput is set only that output is read
+// as detections and it must exist; otherwise every output shaped like
+// detections contributes, in name order so the result is stable.
+func parseWorkflowOutputs(outputs map[string]json.RawMessage, detectionsOutput, taskType string) (*domain.DetectionResult, error) {
+	result := &domain.DetectionResult{Outputs: make(map[string]json.RawMessage)}
+
+	if detectionsOutput != "" {
+		raw, ok := outputs[detectionsOutput]
+		if !ok {
+			return nil, fmt.Errorf("workflow output %q not found", detectionsOutput)
+		}
+		predictions, ok := asPredictions(raw)
+		if !ok {
+			return nil, fmt.Errorf("workflow output %q does not contain detections", detectionsOutput)
+		}
+		result.Detections = toDetections(predictions)
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == detectionsOutput {
+			continue
+		}
+		raw := outputs[name]
+		if result.Classification == nil && isClassification(raw) {
+			classification, err := parseClassification(raw, taskType == domain.TaskMultiLabelClassification)
+			if err == nil {
+				result.Classification = classification
+				continue
+			}
+		}
+		if detectionsOutput == "" {
+			if predictions, ok := asPredictions(raw); ok {
+				result.Detections = append(result.Detections, toDetections(predictions)...)
+				continue
+			}
+		}
+		result.Outputs[name] = raw
+	}
+
+	return result, nil
+}
+
+// asPredictions reports whether a workflow output holds detections, either
+// as a serialized detections object or as a bare list of predictions.
+func asPredictions(raw json.RawMessage) ([]prediction, bool) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return nil, false
+	}
+
+	switch trimmed[0] {
+	case '{':
+		var wrapped map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &wrapped); err != nil {
+			return nil, false
+		}
+		inner, ok := wrapped["predictions"]
+		if !ok {
+			return nil, false
+		}
+		var detections workflowDetections
+		if err := json.Unmarshal(trimmed, &detections); err == nil && isPredictionList(inner) {
+			return detections.Predictions, true
+		}
+	case '[':
+		if isPredictionList(trimmed) {
+			var predictions []prediction
+			if err := json.Unmarshal(trimmed, &predictions); err == nil {
+				return predictions, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// isClassification reports whether a workflow output is the result of a
+// classification model.
+func isClassification(raw json.RawMessage) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false
+	}
+	_, top := fields["top"]
+	_, predicted := fields["predicted_classes"]
+	return top || predicted
+}
+
+// isPredictionList reports whether raw is a list whose elements all carry a
+// bounding box, which tells detections apart from other list outputs such as
+// crops.
+func isPredictionList(raw json.RawMessage) bool {
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return false
+	}
+	for _, item := range items {
+		for _, key := range []string{"x", "y", "width", "height"} {
+			if _, ok := item[key]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
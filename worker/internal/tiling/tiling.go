@@ -0,0 +1,414 @@
+// Package tiling implements sliced inference for high-resolution images:
+// the image is cut into overlapping tiles, each tile is sent to the detector
+// on its own and the detections are merged back into image coordinates.
+package tiling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"govision/worker/internal/domain"
+	"govision/worker/internal/geometry"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Bounds of the per-job tiling options.
+const (
+	MinTileSize = 128
+	MaxTileSize = 4096
+	MaxOverlap  = 0.9
+)
+
+const (
+	defaultConcurrency    = 4
+	defaultMergeThreshold = 0.5
+	defaultJPEGQuality    = 90
+
+	downloadTimeout = 2 * time.Minute
+	maxImageSize    = 64 << 20
+	maxImagePixels  = 200_000_000
+)
+
+// Config holds the worker-wide tiling settings.
+type Config struct {
+	// Concurrency bounds how many tiles of a job are in flight at once.
+	Concurrency int
+	// MergeThreshold is the overlap, as a fraction of the smaller box, above
+	// which detections of the same class from different tiles are merged.
+	MergeThreshold float64
+	// JPEGQuality is used to encode the tiles sent to the detector.
+	JPEGQuality int
+}
+
+// ConfigFromEnv reads TILING_CONCURRENCY, TILING_MERGE_THRESHOLD (formerly
+// TILING_NMS_IOU, still read when unset) and TILING_JPEG_QUALITY, falling
+// back to defaults on missing or invalid values.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Concurrency:    defaultConcurrency,
+		MergeThreshold: defaultMergeThreshold,
+		JPEGQuality:    defaultJPEGQuality,
+	}
+
+	if raw := os.Getenv("TILING_CONCURRENCY"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			cfg.Concurrency = value
+		} else {
+			log.Printf("[WARNING] - Invalid TILING_CONCURRENCY %q, using %d", raw, defaultConcurrency)
+		}
+	}
+	name, raw := "TILING_MERGE_THRESHOLD", os.Getenv("TILING_MERGE_THRESHOLD")
+	if raw == "" {
+		name, raw = "TILING_NMS_IOU", os.Getenv("TILING_NMS_IOU")
+	}
+	if raw != "" {
+		if value, err := strconv.ParseFloat(raw, 64); err == nil && value > 0 && value <= 1 {
+			cfg.MergeThreshold = value
+		} else {
+			log.Printf("[WARNING] - Invalid %s %q, using %g", name, raw, defaultMergeThreshold)
+		}
+	}
+	if raw := os.Getenv("TILING_JPEG_QUALITY"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value >= 1 && value <= 100 {
+			cfg.JPEGQuality = value
+		} else {
+			log.Printf("[WARNING] - Invalid TILING_JPEG_QUALITY %q, using %d", raw, defaultJPEGQuality)
+		}
+	}
+
+	return cfg
+}
+
+// Validate checks tiling options against the supported bounds.
+func Validate(opts domain.TilingOptions) error {
+	if opts.TileSize < MinTileSize || opts.TileSize > MaxTileSize {
+		return fmt.Errorf("tile size must be between %d and %d, got %d", MinTileSize, MaxTileSize, opts.TileSize)
+	}
+	if opts.Overlap < 0 || opts.Overlap > MaxOverlap {
+		return fmt.Errorf("tile overlap must be between 0 and %g, got %g", MaxOverlap, opts.Overlap)
+	}
+	return nil
+}
+
+// Options returns the tiling options that apply to a job: those of the job
+// itself, else the "tiling" entry of its model's default options. It returns
+// nil when tiling is not requested.
+func Options(job *domain.JobOptions, model *domain.ModelSpec) (*domain.TilingOptions, error) {
+	if job != nil && job.Tiling != nil && job.Tiling.TileSize > 0 {
+		return job.Tiling, nil
+	}
+
+	defaults, err := model.DefaultOptions()
+	if err != nil {
+		return nil, err
+	}
+	if defaults.Tiling == nil || defaults.Tiling.TileSize == 0 {
+		return nil, nil
+	}
+	return defaults.Tiling, nil
+}
+
+// Tiler runs tiled inference.
+type Tiler struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+// New creates a Tiler, filling unset settings with defaults.
+func New(cfg Config) *Tiler {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	if cfg.MergeThreshold <= 0 {
+		cfg.MergeThreshold = defaultMergeThreshold
+	}
+	if cfg.JPEGQuality <= 0 {
+		cfg.JPEGQuality = defaultJPEGQuality
+	}
+	return &Tiler{cfg: cfg, httpClient: &http.Client{Timeout: downloadTimeout}}
+}
+
+// tileDetection is a detection in image coordinates and the tile it was
+// found in.
+type tileDetection struct {
+	domain.Detection
+	tile int
+}
+
+// Detect downloads the image, runs det on every tile with bounded
+// concurrency and returns the detections in image coordinates, with
+// duplicates along tile borders merged. The first failing tile cancels the
+// others and fails the whole image with its error.
+func (t *Tiler) Detect(ctx context.Context, det domain.ImageDetector, imageURL string, opts domain.TilingOptions) (*domain.DetectionResult, error) {
+	if err := Validate(opts); err != nil {
+		return nil, err
+	}
+
+	img, err := t.download(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	tiles := Grid(img.Bounds(), opts)
+	log.Printf("[TILING] - Splitting %dx%d image into %d tile(s) of %dpx (overlap %g)",
+		img.Bounds().Dx(), img.Bounds().Dy(), len(tiles), opts.TileSize, opts.Overlap)
+
+	tileCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The tiles cancelled by a failure report context.Canceled, so only the
+	// first other error is kept: it is the cause, and the worker tells a
+	// rate limit from a failed inference by it.
+	var (
+		failOnce sync.Once
+		failure  error
+	)
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failure = err
+			cancel()
+		})
+	}
+
+	results := make([][]domain.Detection, len(tiles))
+	sem := make(chan struct{}, t.cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	for i, tile := range tiles {
+		select {
+		case sem <- struct{}{}:
+		case <-tileCtx.Done():
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, tile image.Rectangle) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			detections, err := t.detectTile(tileCtx, det, img, tile)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					fail(fmt.Errorf("tile %d %v: %w", i, tile, err))
+				}
+				return
+			}
+			results[i] = detections
+		}(i, tile)
+	}
+	wg.Wait()
+
+	if failure != nil {
+		return nil, failure
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var found []tileDetection
+	for i, detections := range results {
+		for _, d := range detections {
+			found = append(found, tileDetection{Detection: d, tile: i})
+		}
+	}
+
+	detections := merge(found, t.cfg.MergeThreshold)
+	log.Printf("[TILING] - %d detection(s) from tiles, %d after merging.", len(found), len(detections))
+
+	return &domain.DetectionResult{Detections: detections}, nil
+}
+
+// detectTile encodes one tile, runs the detector on it and moves the
+// detections into image coordinates.
+func (t *Tiler) detectTile(ctx context.Context, det domain.ImageDetector, img image.Image, tile image.Rectangle) ([]domain.Detection, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, crop(img, tile), &jpeg.Options{Quality: t.cfg.JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode tile: %w", err)
+	}
+
+	result, err := det.DetectImage(ctx, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	origin := tile.Min.Sub(img.Bounds().Min)
+	detections := make([]domain.Detection, len(result.Detections))
+	for i, d := range result.Detections {
+		detections[i] = offset(d, float64(origin.X), float64(origin.Y))
+	}
+	return detections, nil
+}
+
+// merge folds detections of the same object found by several tiles into
+// one. Detections are visited by descending confidence. One of the same
+// class that overlaps a kept detection from another tile by more than
+// threshold, measured over the smaller box, grows the kept box to cover both
+// instead of being kept; polygons and keypoints are those of the kept one.
+// The smaller box is the measure because an object cut at a tile edge gives
+// a partial box whose IoU with the full one stays low. Detections of the same
+// tile are never merged: the model already told them apart.
+func merge(detections []tileDetection, threshold float64) []domain.Detection {
+	sorted := make([]tileDetection, len(detections))
+	copy(sorted, detections)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Confidence > sorted[j].Confidence })
+
+	type group struct {
+		detection domain.Detection
+		tiles     map[int]bool
+	}
+	var groups []*group
+	for _, candidate := range sorted {
+		var into *group
+		for _, g := range groups {
+			if g.detection.Class == candidate.Class && !g.tiles[candidate.tile] && geometry.IoS(g.detection, candidate.Detection) > threshold {
+				into = g
+				break
+			}
+		}
+		if into == nil {
+			groups = append(groups, &group{detection: candidate.Detection, tiles: map[int]bool{candidate.tile: true}})
+			continue
+		}
+		into.detection = geometry.Union(into.detection, candidate.Detection)
+		into.tiles[candidate.tile] = true
+	}
+
+	merged := make([]domain.Detection, len(groups))
+	for i, g := range groups {
+		merged[i] = g.detection
+	}
+	return merged
+}
+
+// Grid returns the tiles covering bounds. Tiles advance by TileSize minus
+// the overlap and the last tile of a row or column is aligned with the image
+// edge, so every tile is full size unless the image itself is smaller.
+func Grid(bounds image.Rectangle, opts domain.TilingOptions) []image.Rectangle {
+	xs := starts(bounds.Dx(), opts)
+	ys := starts(bounds.Dy(), opts)
+
+	tiles := make([]image.Rectangle, 0, len(xs)*len(ys))
+	for _, y := range ys {
+		for _, x := range xs {
+			tile := image.Rect(x, y, x+opts.TileSize, y+opts.TileSize).Add(bounds.Min)
+			tiles = append(tiles, tile.Intersect(bounds))
+		}
+	}
+	return tiles
+}
+
+// starts returns the tile offsets along one axis of the given length.
+func starts(length int, opts domain.TilingOptions) []int {
+	size := opts.TileSize
+	if length <= size {
+		return []int{0}
+	}
+
+	step := size - int(float64(size)*opts.Overlap)
+	if step < 1 {
+		step = 1
+	}
+
+	var offsets []int
+	for x := 0; ; x += step {
+		if x+size >= length {
+			offsets = append(offsets, length-size)
+			return offsets
+		}
+		offsets = append(offsets, x)
+	}
+}
+
+// offset moves a detection found in a tile by the tile's origin.
+func offset(d domain.Detection, dx, dy float64) domain.Detection {
+	d.X += dx
+	d.Y += dy
+
+	if d.Points != nil {
+		points := make([]domain.Point, len(d.Points))
+		for i, p := range d.Points {
+			points[i] = domain.Point{X: p.X + dx, Y: p.Y + dy}
+		}
+		d.Points = points
+	}
+	if d.Keypoints != nil {
+		keypoints := make([]domain.Keypoint, len(d.Keypoints))
+		for i, k := range d.Keypoints {
+			k.X += dx
+			k.Y += dy
+			keypoints[i] = k
+		}
+		d.Keypoints = keypoints
+	}
+	return d
+}
+
+// crop returns the part of img inside r, sharing pixels when the image
+// type supports it.
+func crop(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
+
+// download fetches and decodes the image, refusing files and dimensions
+// beyond the worker's limits.
+func (t *Tiler) download(ctx context.Context, imageURL string) (image.Image, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image request: %w", err)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(data) > maxImageSize {
+		return nil, fmt.Errorf("image exceeds %d bytes", maxImageSize)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image of %dx%d exceeds %d pixels", config.Width, config.Height, maxImagePixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,268 @@
+package tiling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"govision/worker/internal/domain"
+	"govision/worker/internal/ratelimit"
+)
+
+func TestStarts(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int
+		size    int
+		overlap float64
+		want    []int
+	}{
+		{name: "shorter than a tile", length: 100, size: 128, want: []int{0}},
+		{name: "exactly one tile", length: 128, size: 128, want: []int{0}},
+		{name: "two tiles without overlap", length: 256, size: 128, want: []int{0, 128}},
+		{name: "last tile aligned with the edge", length: 300, size: 128, want: []int{0, 128, 172}},
+		{name: "overlap", length: 1000, size: 400, overlap: 0.25, want: []int{0, 300, 600}},
+		{name: "overlap, last tile aligned with the edge", length: 1100, size: 400, overlap: 0.25, want: []int{0, 300, 600, 700}},
+		{name: "maximum overlap", length: 140, size: 128, overlap: MaxOverlap, want: []int{0, 12}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := starts(tt.length, domain.TilingOptions{TileSize: tt.size, Overlap: tt.overlap})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("starts(%d) = %v, want %v", tt.length, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrid(t *testing.T) {
+	bounds := image.Rect(10, 20, 310, 148)
+	tiles := Grid(bounds, domain.TilingOptions{TileSize: 128})
+
+	want := []image.Rectangle{
+		image.Rect(10, 20, 138, 148),
+		image.Rect(138, 20, 266, 148),
+		image.Rect(182, 20, 310, 148),
+	}
+	if !slices.Equal(tiles, want) {
+		t.Errorf("Grid() = %v, want %v", tiles, want)
+	}
+
+	small := image.Rect(0, 0, 100, 60)
+	if tiles := Grid(small, domain.TilingOptions{TileSize: 128}); !slices.Equal(tiles, []image.Rectangle{small}) {
+		t.Errorf("Grid() of an image smaller than a tile = %v, want the image", tiles)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	d := domain.Detection{
+		X: 10, Y: 20, Width: 4, Height: 6,
+		Points:    []domain.Point{{X: 1, Y: 2}},
+		Keypoints: []domain.Keypoint{{X: 3, Y: 4, Class: "nose"}},
+	}
+	got := offset(d, 100, 200)
+
+	if got.X != 110 || got.Y != 220 || got.Width != 4 || got.Height != 6 {
+		t.Errorf("box = %v,%v %vx%v, want 110,220 4x6", got.X, got.Y, got.Width, got.Height)
+	}
+	if got.Points[0] != (domain.Point{X: 101, Y: 202}) {
+		t.Errorf("point = %+v, want 101,202", got.Points[0])
+	}
+	if got.Keypoints[0].X != 103 || got.Keypoints[0].Y != 204 || got.Keypoints[0].Class != "nose" {
+		t.Errorf("keypoint = %+v, want nose at 103,204", got.Keypoints[0])
+	}
+	if d.Points[0].X != 1 || d.Keypoints[0].X != 3 {
+		t.Error("offset modified the input detection")
+	}
+}
+
+// box returns a detection of class covering left..right, top..bottom.
+func box(class string, left, top, right, bottom, confidence float64) domain.Detection {
+	return domain.Detection{
+		X: (left + right) / 2, Y: (top + bottom) / 2,
+		Width: right - left, Height: bottom - top,
+		Class: class, Confidence: confidence,
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name       string
+		detections []tileDetection
+		want       []domain.Detection
+	}{
+		{
+			name: "object cut at a tile edge",
+			detections: []tileDetection{
+				{box("car", 100, 100, 200, 150, 0.9), 0},
+				// IoU with the full box is 0.5, below the threshold.
+				{box("car", 150, 100, 200, 150, 0.6), 1},
+			},
+			want: []domain.Detection{box("car", 100, 100, 200, 150, 0.9)},
+		},
+		{
+			name: "object split between two tiles",
+			detections: []tileDetection{
+				{box("car", 100, 100, 170, 150, 0.8), 0},
+				{box("car", 130, 100, 200, 150, 0.7), 1},
+			},
+			want: []domain.Detection{box("car", 100, 100, 200, 150, 0.8)},
+		},
+		{
+			name: "object seen by four tiles",
+			detections: []tileDetection{
+				{box("car", 100, 100, 200, 200, 0.9), 0},
+				{box("car", 150, 100, 200, 200, 0.8), 1},
+				{box("car", 100, 150, 200, 200, 0.7), 2},
+				{box("car", 150, 150, 200, 200, 0.6), 3},
+			},
+			want: []domain.Detection{box("car", 100, 100, 200, 200, 0.9)},
+		},
+		{
+			name: "different classes",
+			detections: []tileDetection{
+				{box("car", 100, 100, 200, 150, 0.9), 0},
+				{box("truck", 150, 100, 200, 150, 0.6), 1},
+			},
+			want: []domain.Detection{box("car", 100, 100, 200, 150, 0.9), box("truck", 150, 100, 200, 150, 0.6)},
+		},
+		{
+			name: "objects of the same tile",
+			detections: []tileDetection{
+				{box("car", 100, 100, 200, 150, 0.9), 0},
+				{box("car", 150, 100, 200, 150, 0.6), 0},
+			},
+			want: []domain.Detection{box("car", 100, 100, 200, 150, 0.9), box("car", 150, 100, 200, 150, 0.6)},
+		},
+		{
+			name: "neighbours barely touching",
+			detections: []tileDetection{
+				{box("car", 100, 100, 160, 150, 0.9), 0},
+				{box("car", 150, 100, 210, 150, 0.6), 1},
+			},
+			want: []domain.Detection{box("car", 100, 100, 160, 150, 0.9), box("car", 150, 100, 210, 150, 0.6)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := merge(tt.detections, defaultMergeThreshold)
+			if len(got) != len(tt.want) {
+				t.Fatalf("merge() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if !sameBox(got[i], tt.want[i]) || got[i].Class != tt.want[i].Class || got[i].Confidence != tt.want[i].Confidence {
+					t.Errorf("detection %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func sameBox(a, b domain.Detection) bool {
+	const epsilon = 1e-9
+	return math.Abs(a.X-b.X) < epsilon && math.Abs(a.Y-b.Y) < epsilon &&
+		math.Abs(a.Width-b.Width) < epsilon && math.Abs(a.Height-b.Height) < epsilon
+}
+
+// imageServer serves a blank PNG of the given size.
+func imageServer(t *testing.T, width, height int) *httptest.Server {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encoding image: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// cornerDetector finds one car near the top-left corner of every tile.
+type cornerDetector struct{}
+
+func (cornerDetector) DetectImage(context.Context, []byte) (*domain.DetectionResult, error) {
+	return &domain.DetectionResult{Detections: []domain.Detection{box("car", 8, 8, 12, 12, 0.9)}}, nil
+}
+
+func TestDetect(t *testing.T) {
+	server := imageServer(t, 256, 256)
+
+	result, err := New(Config{}).Detect(context.Background(), cornerDetector{}, server.URL, domain.TilingOptions{TileSize: 128})
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+
+	var centers []string
+	for _, d := range result.Detections {
+		centers = append(centers, fmt.Sprintf("%g,%g", d.X, d.Y))
+	}
+	slices.Sort(centers)
+	want := []string{"10,10", "10,138", "138,10", "138,138"}
+	if !slices.Equal(centers, want) {
+		t.Errorf("detection centers = %v, want %v", centers, want)
+	}
+}
+
+// throttledDetector fails the last of n concurrent tile calls with a rate
+// limit once the others are in flight; those wait for their cancellation.
+type throttledDetector struct {
+	n int
+
+	mu      sync.Mutex
+	calls   int
+	waiting chan struct{}
+}
+
+func (d *throttledDetector) DetectImage(ctx context.Context, _ []byte) (*domain.DetectionResult, error) {
+	d.mu.Lock()
+	d.calls++
+	call := d.calls
+	d.mu.Unlock()
+
+	if call < d.n {
+		d.waiting <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	for range d.n - 1 {
+		<-d.waiting
+	}
+	return nil, fmt.Errorf("%w: retry after 7s", ratelimit.ErrRateLimited)
+}
+
+func TestDetectKeepsTheFailureOverCancellations(t *testing.T) {
+	server := imageServer(t, 256, 256)
+	det := &throttledDetector{n: 4, waiting: make(chan struct{}, 4)}
+
+	_, err := New(Config{Concurrency: 4}).Detect(context.Background(), det, server.URL, domain.TilingOptions{TileSize: 128})
+	if !errors.Is(err, ratelimit.ErrRateLimited) {
+		t.Errorf("Detect() error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestDetectCancelled(t *testing.T) {
+	server := imageServer(t, 256, 256)
+	ctx, cancel := context.WithCancel(context.Background())
+	det := &throttledDetector{n: 5, waiting: make(chan struct{}, 5)}
+	go func() {
+		for range 4 {
+			<-det.waiting
+		}
+		cancel()
+	}()
+
+	_, err := New(Config{Concurrency: 4}).Detect(ctx, det, server.URL, domain.TilingOptions{TileSize: 128})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Detect() error = %v, want context.Canceled", err)
+	}
+}
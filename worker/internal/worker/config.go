@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultConcurrency   = 4
+	defaultShutdownGrace = 30 * time.Second
+)
+
+// Config sizes the worker pool.
+type Config struct {
+	// Concurrency is the number of jobs processed at the same time.
+	Concurrency int
+	// Prefetch is the number of unacknowledged deliveries RabbitMQ may push
+	// to this worker. It should be at least Concurrency so no goroutine
+	// idles while a message is on its way.
+	Prefetch int
+	// ShutdownGrace is how long in-flight jobs may run once the worker is
+	// stopping. Jobs still running afterwards are aborted and requeued.
+	ShutdownGrace time.Duration
+	// ID identifies this worker process on the jobs it processes. It is
+	// set from the worker registry.
+	ID string
+}
+
+// ConfigFromEnv reads WORKER_CONCURRENCY (default 4), WORKER_PREFETCH
+// (default: the concurrency) and WORKER_SHUTDOWN_GRACE (default 30s).
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Concurrency:   envInt("WORKER_CONCURRENCY", defaultConcurrency),
+		ShutdownGrace: defaultShutdownGrace,
+	}
+	cfg.Prefetch = envInt("WORKER_PREFETCH", cfg.Concurrency)
+	if raw := os.Getenv("WORKER_SHUTDOWN_GRACE"); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value >= 0 {
+			cfg.ShutdownGrace = value
+		} else {
+			log.Printf("[WARNING] - Invalid WORKER_SHUTDOWN_GRACE %q, using %s", raw, defaultShutdownGrace)
+		}
+	}
+	if cfg.Prefetch < cfg.Concurrency {
+		log.Printf("[WARNING] - WORKER_PREFETCH %d is below WORKER_CONCURRENCY %d, only %d job(s) will run at once",
+			cfg.Prefetch, cfg.Concurrency, cfg.Prefetch)
+	}
+	return cfg
+}
+
+func envInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Printf("[WARNING] - Invalid %s %q, using %d", name, raw, fallback)
+		return fallback
+	}
+	return value
+}
@@ -2,38 +2,162 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"expvar"
+	"fmt"
 	"log"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"govision/worker/internal/cache"
 	"govision/worker/internal/domain"
+	"govision/worker/internal/postprocess"
+	"govision/worker/internal/ratelimit"
+	"govision/worker/internal/registry"
 	"govision/worker/internal/repository"
-	"govision/worker/internal/services/roboflow"
+	"govision/worker/internal/tiling"
 
-	amqp "github.com/rabbitmq/amqp091-go"
+	"govision/pkg/queue"
+
+	"github.com/google/uuid"
 )
 
-// Worker processes jobs from the RabbitMQ queue by sending images
-// to the Roboflow API for inference and persisting results to the database.
+var metrics = expvar.NewMap("worker")
+
+// Worker processes jobs from the job queue by sending images
+// to the detector of their model and persisting results to the database.
 type Worker struct {
-	roboflow *roboflow.Client
-	repo     repository.PredictionRepository
+	detectors domain.DetectorResolver
+	repo      repository.PredictionRepository
+	tiler     *tiling.Tiler
+	cache     *cache.Cache
+	cfg       Config
+	inFlight  atomic.Int64
+
+	// Reported by Status for the worker registry.
+	processed atomic.Int64
+	failed    atomic.Int64
+	mu        sync.Mutex
+	jobs      map[string]struct{}
+	models    []string
 }
 
-// New creates a new Worker with the given Roboflow client and prediction repository.
-func New(rf *roboflow.Client, repo repository.PredictionRepository) *Worker {
-	return &Worker{roboflow: rf, repo: repo}
+// New creates a new Worker with the given detector resolver, prediction
+// repository, tiler for jobs asking for tiled inference and result cache.
+// results may be nil to always run inference.
+func New(detectors domain.DetectorResolver, repo repository.PredictionRepository, tiler *tiling.Tiler, results *cache.Cache, cfg Config) *Worker {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	w := &Worker{detectors: detectors, repo: repo, tiler: tiler, cache: results, cfg: cfg, jobs: make(map[string]struct{})}
+	if _, model, err := detectors.Resolve(nil); err == nil {
+		w.models = []string{model.Name}
+	}
+	return w
 }
 
-// ProcessMessages listens for incoming AMQP deliveries, decodes the
-// job message, sends the image to Roboflow and logs the results.
-// Each message is acknowledged individually after processing.
-func (w *Worker) ProcessMessages(ctx context.Context, msgs <-chan amqp.Delivery) {
+// Status reports the jobs in flight, the models served so far and the
+// message counters, for the worker registry.
+func (w *Worker) Status() registry.Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	jobIDs := make([]string, 0, len(w.jobs))
+	for jobID := range w.jobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	slices.Sort(jobIDs)
+
+	return registry.Status{
+		JobIDs:    jobIDs,
+		Models:    slices.Clone(w.models),
+		Processed: w.processed.Load(),
+		Failed:    w.failed.Load(),
+	}
+}
+
+// track records jobID as in flight until the returned function is called.
+func (w *Worker) track(jobID string) func() {
+	w.mu.Lock()
+	w.jobs[jobID] = struct{}{}
+	w.mu.Unlock()
+
+	return func() {
+		w.mu.Lock()
+		delete(w.jobs, jobID)
+		w.mu.Unlock()
+	}
+}
+
+// served records that model ran on this worker.
+func (w *Worker) served(model string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !slices.Contains(w.models, model) {
+		w.models = append(w.models, model)
+	}
+}
+
+// ProcessMessages listens for incoming queue deliveries, decodes the
+// job message, sends the image to the detector and stores the results.
+// Deliveries are handled by Concurrency goroutines, so at most that many
+// jobs are in flight; each message is acknowledged individually after
+// processing.
+//
+// Cancelling ctx stops the worker from taking new deliveries. In-flight jobs
+// may finish for up to ShutdownGrace; jobs still running then are aborted
+// and their messages requeued. It returns once every job has settled, and
+// the channel the deliveries came from must stay open until then.
+func (w *Worker) ProcessMessages(ctx context.Context, msgs <-chan queue.Delivery) {
+	// Jobs are not bound to ctx: shutting down must not abort inference.
+	jobCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consume(ctx, jobCtx, msgs)
+		}()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return
+	case <-ctx.Done():
+	}
+
+	log.Printf("[WORKER] - Shutting down, waiting up to %s for %d in-flight job(s)", w.cfg.ShutdownGrace, w.inFlight.Load())
+	timer := time.NewTimer(w.cfg.ShutdownGrace)
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+		log.Println("[WORKER] - All in-flight jobs finished.")
+	case <-timer.C:
+		log.Printf("[WORKER] - Grace period expired, aborting %d in-flight job(s)", w.inFlight.Load())
+		abort()
+		<-drained
+	}
+}
+
+// consume handles deliveries one at a time with jobCtx until stop is
+// cancelled or the delivery channel is closed.
+func (w *Worker) consume(stop, jobCtx context.Context, msgs <-chan queue.Delivery) {
 	for {
 		select {
-		case <-ctx.Done():
-			log.Println("[WORKER] - Context cancelled, stopping worker.")
+		case <-stop.Done():
 			return
 
 		case msg, ok := <-msgs:
@@ -42,63 +166,258 @@ func (w *Worker) ProcessMessages(ctx context.Context, msgs <-chan amqp.Delivery)
 				return
 			}
 
-			w.handleMessage(ctx, msg)
+			d := &delivery{Delivery: msg}
+			if stop.Err() != nil {
+				// Received while shutting down: leave it to another worker.
+				d.nack(true)
+				return
+			}
+			w.safeHandle(jobCtx, d)
 		}
 	}
 }
 
-func (w *Worker) handleMessage(ctx context.Context, msg amqp.Delivery) {
-	var job domain.JobMessage
-	if err := json.Unmarshal(msg.Body, &job); err != nil {
-		log.Printf("[WORKER] - Failed to decode message: %v", err)
-		_ = msg.Nack(false, false)
+// safeHandle processes one delivery, turning a panic into a rejected
+// message so a single bad job cannot take the process down.
+func (w *Worker) safeHandle(ctx context.Context, msg *delivery) {
+	w.inFlight.Add(1)
+	metrics.Add("in_flight", 1)
+	defer func() {
+		w.inFlight.Add(-1)
+		metrics.Add("in_flight", -1)
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[WORKER] - Panic while processing message %s: %v\n%s", msg.ID(), r, debug.Stack())
+			metrics.Add("panics", 1)
+			w.deadLetter(msg, msg.ID(), "", domain.ReasonPanic, fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	w.handleMessage(ctx, msg)
+	metrics.Add("processed", 1)
+	w.processed.Add(1)
+}
+
+// delivery settles a queue delivery at most once: acknowledging the same
+// AMQP delivery twice is a protocol error that closes the channel. Every
+// backend accepts settlements from concurrent goroutines.
+type delivery struct {
+	queue.Delivery
+	once sync.Once
+}
+
+func (d *delivery) ack() {
+	d.once.Do(func() {
+		if err := d.Ack(); err != nil {
+			log.Printf("[WORKER] - Failed to ack message %s: %v", d.ID(), err)
+		}
+	})
+}
+
+func (d *delivery) nack(requeue bool) {
+	d.once.Do(func() {
+		if err := d.Nack(requeue); err != nil {
+			log.Printf("[WORKER] - Failed to nack message %s: %v", d.ID(), err)
+		}
+	})
+}
+
+// deadLetter records a message the worker gives up on, so it can be
+// inspected and replayed, and rejects it. Messages without a job ID are
+// recorded under a generated one.
+func (w *Worker) deadLetter(msg *delivery, jobID, modelName, reason string, cause error) {
+	if jobID == "" {
+		jobID = "unknown-" + uuid.NewString()
+	}
+
+	letter := domain.DeadLetter{
+		JobID:     jobID,
+		Reason:    reason,
+		Error:     cause.Error(),
+		Payload:   msg.Body(),
+		ModelName: modelName,
+	}
+	if err := w.repo.SaveDeadLetter(letter); err != nil {
+		log.Printf("[WORKER] - Job %s: failed to record dead letter, message is lost: %v", jobID, err)
+	}
+	metrics.Add("dead_lettered", 1)
+	w.failed.Add(1)
+	msg.nack(false)
+}
+
+func (w *Worker) handleMessage(ctx context.Context, msg *delivery) {
+	job, err := domain.DecodeJobMessage(msg.Body())
+	if err != nil {
+		log.Printf("[WORKER] - Failed to decode message %s: %v", msg.ID(), err)
+		w.deadLetter(msg, msg.ID(), "", domain.ReasonInvalidMessage, err)
 		return
 	}
+	metrics.Add(fmt.Sprintf("messages_v%d", job.Version), 1)
+
+	if job.DedupeKey != "" {
+		processed, err := w.repo.IsProcessed(job.DedupeKey)
+		if err != nil {
+			log.Printf("[WORKER] - Job %s: failed to check dedupe key: %v", job.JobID, err)
+			msg.nack(true)
+			return
+		}
+		if processed {
+			log.Printf("[WORKER] - Job %s: message %s already processed, skipping duplicate", job.JobID, job.DedupeKey)
+			metrics.Add("duplicates", 1)
+			msg.ack()
+			return
+		}
+	}
 
 	log.Printf("[WORKER] - Processing job %s | Image: %s", job.JobID, job.ImageURL)
+	if traceID := job.Trace.TraceID(); traceID != "" {
+		log.Printf("[WORKER] - Job %s: trace %s", job.JobID, traceID)
+	}
+	defer w.track(job.JobID)()
 
-	if err := w.repo.CreatePendingJob(job.JobID, job.ImageURL); err != nil {
+	if err := w.repo.CreatePendingJob(job.JobID, job.ImageURL, msg.Body(), w.cfg.ID); err != nil {
 		log.Printf("[WORKER] - Job %s: failed to create pending job: %v", job.JobID, err)
-		_ = msg.Nack(false, false)
+		w.deadLetter(msg, job.JobID, job.Model.ModelName(), domain.ReasonJobNotCreated, err)
 		return
 	}
 
-	result, err := w.roboflow.Detect(ctx, job.ImageURL)
+	detector, model, err := w.detectors.Resolve(job.Model)
+	if err != nil {
+		log.Printf("[WORKER] - Job %s: no detector for model: %v", job.JobID, err)
+		w.deadLetter(msg, job.JobID, job.Model.ModelName(), domain.ReasonNoDetector, err)
+		return
+	}
+
+	log.Printf("[WORKER] - Job %s using model %s (version %q)", job.JobID, model.Name, model.Version)
+	w.served(model.Name)
+
+	result, cacheKey, cachedFrom, err := w.infer(ctx, detector, model, job)
+	if errors.Is(err, ratelimit.ErrRateLimited) {
+		// The provider is saturated, not the job at fault: requeue it. The
+		// shared bucket stays blocked, so it is not retried right away.
+		log.Printf("[WORKER] - Job %s throttled, requeueing: %v", job.JobID, err)
+		msg.nack(true)
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		log.Printf("[WORKER] - Job %s interrupted by shutdown, requeueing: %v", job.JobID, err)
+		msg.nack(true)
+		return
+	}
 	if err != nil {
-		var apiErr *roboflow.APIError
-		if errors.As(err, &apiErr) {
-			log.Printf("[WORKER] - Job %s failed with non-retryable error (HTTP %d): %s", job.JobID, apiErr.StatusCode, apiErr.Body)
-			_ = msg.Nack(false, false)
-			return
-		}
 		log.Printf("[WORKER] - Job %s failed: %v", job.JobID, err)
-		_ = msg.Nack(false, false)
+		w.deadLetter(msg, job.JobID, model.Name, domain.ReasonInferenceFailed, err)
+		return
+	}
+
+	if len(result.Detections) == 0 && result.Classification == nil && len(result.Outputs) == 0 {
+		log.Printf("[WORKER] - Job %s: no detections returned", job.JobID)
+		w.deadLetter(msg, job.JobID, model.Name, domain.ReasonEmptyResult, errors.New("no detections returned"))
 		return
 	}
 
-	if len(result.Predictions) == 0 {
-		log.Printf("[WORKER] - Job %s: no predictions from Roboflow", job.JobID)
-		_ = msg.Nack(false, false)
+	steps, err := postprocess.Steps(job.Options, model)
+	if err != nil {
+		log.Printf("[WORKER] - Job %s: invalid post-processing options: %v", job.JobID, err)
+		w.deadLetter(msg, job.JobID, model.Name, domain.ReasonInvalidOptions, err)
+		return
+	}
+	detections, applied, err := postprocess.Apply(result.Detections, steps)
+	if err != nil {
+		log.Printf("[WORKER] - Job %s: invalid post-processing options: %v", job.JobID, err)
+		w.deadLetter(msg, job.JobID, model.Name, domain.ReasonInvalidOptions, err)
 		return
 	}
+	if len(applied) > 0 {
+		log.Printf("[WORKER] - Job %s: %d post-processing step(s) kept %d of %d detection(s)",
+			job.JobID, len(applied), len(detections), len(result.Detections))
+	}
 
 	jobResult := domain.JobResult{
-		JobID:        job.JobID,
-		ImageURL:     job.ImageURL,
-		Status:       "completed",
-		ProcessedAt:  time.Now(),
-		CountObjects: len(result.Predictions),
-		Predictions:  result.Predictions,
+		JobID:          job.JobID,
+		ImageURL:       job.ImageURL,
+		Status:         "completed",
+		ProcessedAt:    time.Now(),
+		Image:          job.Image,
+		ModelName:      model.Name,
+		ModelVersion:   model.Version,
+		TaskType:       model.TaskType,
+		CountObjects:   len(detections),
+		Detections:     detections,
+		Classification: result.Classification,
+		Outputs:        result.Outputs,
+		Postprocess:    applied,
+		CachedFrom:     cachedFrom,
+		DedupeKey:      job.DedupeKey,
+		WorkerID:       w.cfg.ID,
 	}
 
-	if err := w.repo.SaveJobResult(jobResult); err != nil {
+	err = w.repo.SaveJobResult(jobResult)
+	if errors.Is(err, repository.ErrAlreadyProcessed) {
+		log.Printf("[WORKER] - Job %s: message %s was processed concurrently, discarding result", job.JobID, job.DedupeKey)
+		metrics.Add("duplicates", 1)
+		msg.ack()
+		return
+	}
+	if err != nil {
 		log.Printf("[WORKER] - Job %s: failed to save results to database: %v", job.JobID, err)
-		_ = msg.Nack(false, false)
+		w.deadLetter(msg, job.JobID, model.Name, domain.ReasonSaveFailed, err)
 		return
 	}
 
+	if cachedFrom == "" && w.cache != nil {
+		w.cache.Put(ctx, cacheKey, job.JobID, model, result)
+	}
+
 	//resultJSON, _ := json.MarshalIndent(result, "", "  ")
 	log.Printf("[WORKER] - Job %s completed and saved.", job.JobID)
 
-	_ = msg.Ack(false)
+	msg.ack()
+}
+
+// infer returns the model's raw result for the job, from the cache when the
+// same image was already run through the same model with the same options.
+// It also returns the cache key of the request and, on a cache hit, the ID
+// of the job whose result was reused.
+func (w *Worker) infer(ctx context.Context, detector domain.Detector, model *domain.ModelSpec, job domain.JobMessage) (*domain.DetectionResult, string, string, error) {
+	opts, err := tiling.Options(job.Options, model)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	var key string
+	if w.cache != nil {
+		if key, err = w.cache.Key(job.Image.SHA256, model, opts); err != nil {
+			return nil, "", "", err
+		}
+		if entry, ok := w.cache.Get(ctx, key); ok {
+			log.Printf("[WORKER] - Job %s served from cache (result of job %s)", job.JobID, entry.JobID)
+			return &entry.Result, key, entry.JobID, nil
+		}
+	}
+
+	result, err := w.detect(ctx, detector, model, job, opts)
+	return result, key, "", err
+}
+
+// detect runs the detector on the whole image, or tile by tile when opts is
+// set. Classification models and detectors that cannot take image bytes
+// always see the whole image.
+func (w *Worker) detect(ctx context.Context, detector domain.Detector, model *domain.ModelSpec, job domain.JobMessage, opts *domain.TilingOptions) (*domain.DetectionResult, error) {
+	if opts == nil {
+		return detector.Detect(ctx, job.ImageURL)
+	}
+
+	imageDetector, ok := detector.(domain.ImageDetector)
+	switch {
+	case domain.IsClassificationTask(model.TaskType):
+		log.Printf("[WORKER] - Job %s: tiling ignored for %s model", job.JobID, model.TaskType)
+	case !ok:
+		log.Printf("[WORKER] - Job %s: model %s does not support tiling, using the whole image", job.JobID, model.Name)
+	default:
+		return w.tiler.Detect(ctx, imageDetector, job.ImageURL, *opts)
+	}
+	return detector.Detect(ctx, job.ImageURL)
 }
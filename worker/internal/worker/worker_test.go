@@ -0,0 +1,317 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"govision/worker/internal/domain"
+	"govision/worker/internal/services/fake"
+
+	"govision/pkg/queue"
+)
+
+const testMessage = `{"job_id":"job-1","dedupe_key":"job-1","image_url":"https://images.example.com/1.jpg","image":{"sha256":"abc"}}`
+
+// testDelivery records how a message was settled.
+type testDelivery struct {
+	body []byte
+
+	mu      sync.Mutex
+	settled []string
+}
+
+func newDelivery(body string) *testDelivery {
+	return &testDelivery{body: []byte(body)}
+}
+
+func (d *testDelivery) ID() string   { return "msg-1" }
+func (d *testDelivery) Body() []byte { return d.body }
+
+func (d *testDelivery) Ack() error {
+	d.settle("ack")
+	return nil
+}
+
+func (d *testDelivery) Nack(requeue bool) error {
+	if requeue {
+		d.settle("requeue")
+	} else {
+		d.settle("drop")
+	}
+	return nil
+}
+
+func (d *testDelivery) settle(outcome string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settled = append(d.settled, outcome)
+}
+
+func (d *testDelivery) outcome() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return strings.Join(d.settled, ",")
+}
+
+// testRepository keeps what the worker persists in memory.
+type testRepository struct {
+	mu          sync.Mutex
+	processed   map[string]bool
+	pending     []string
+	results     []domain.JobResult
+	deadLetters []domain.DeadLetter
+}
+
+func newRepository() *testRepository {
+	return &testRepository{processed: make(map[string]bool)}
+}
+
+func (r *testRepository) CreatePendingJob(jobID, imageURL string, message []byte, workerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, jobID)
+	return nil
+}
+
+func (r *testRepository) SaveJobResult(job domain.JobResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, job)
+	r.processed[job.DedupeKey] = true
+	return nil
+}
+
+func (r *testRepository) IsProcessed(dedupeKey string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.processed[dedupeKey], nil
+}
+
+func (r *testRepository) SaveDeadLetter(letter domain.DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadLetters = append(r.deadLetters, letter)
+	return nil
+}
+
+// staticResolver serves every job with the same detector.
+type staticResolver struct {
+	detector domain.Detector
+}
+
+func (r staticResolver) Resolve(*domain.ModelSpec) (domain.Detector, *domain.ModelSpec, error) {
+	return r.detector, &domain.ModelSpec{Name: "default", Version: "1", TaskType: domain.TaskObjectDetection}, nil
+}
+
+type panickingDetector struct{}
+
+func (panickingDetector) Detect(context.Context, string) (*domain.DetectionResult, error) {
+	panic("detector exploded")
+}
+
+// blockingDetector runs until release is closed or its context is cancelled.
+type blockingDetector struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newBlockingDetector() *blockingDetector {
+	return &blockingDetector{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (d *blockingDetector) Detect(ctx context.Context, imageURL string) (*domain.DetectionResult, error) {
+	d.once.Do(func() { close(d.started) })
+	select {
+	case <-d.release:
+		return fake.New().Detect(ctx, imageURL)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// process runs the worker over the given deliveries until they are settled.
+func process(w *Worker, deliveries ...*testDelivery) {
+	msgs := make(chan queue.Delivery, len(deliveries))
+	for _, d := range deliveries {
+		msgs <- d
+	}
+	close(msgs)
+	w.ProcessMessages(context.Background(), msgs)
+}
+
+func TestProcessMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		detector  domain.Detector
+		body      string
+		processed bool // the dedupe key was already processed
+
+		outcome    string
+		results    int
+		deadLetter string
+		errorText  string
+	}{
+		{
+			name:     "success",
+			detector: fake.New(),
+			outcome:  "ack",
+			results:  1,
+		},
+		{
+			name:       "detector error",
+			detector:   &fake.Detector{Err: errors.New("model unavailable")},
+			outcome:    "drop",
+			deadLetter: domain.ReasonInferenceFailed,
+			errorText:  "model unavailable",
+		},
+		{
+			name:       "empty result",
+			detector:   &fake.Detector{Result: &domain.DetectionResult{}},
+			outcome:    "drop",
+			deadLetter: domain.ReasonEmptyResult,
+		},
+		{
+			name:       "panic",
+			detector:   panickingDetector{},
+			outcome:    "drop",
+			deadLetter: domain.ReasonPanic,
+			errorText:  "detector exploded",
+		},
+		{
+			name:       "invalid message",
+			detector:   fake.New(),
+			body:       `{"job_id":`,
+			outcome:    "drop",
+			deadLetter: domain.ReasonInvalidMessage,
+		},
+		{
+			name:      "duplicate",
+			detector:  fake.New(),
+			processed: true,
+			outcome:   "ack",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newRepository()
+			repo.processed["job-1"] = tt.processed
+			body := tt.body
+			if body == "" {
+				body = testMessage
+			}
+			msg := newDelivery(body)
+
+			w := New(staticResolver{tt.detector}, repo, nil, nil, Config{Concurrency: 2, ShutdownGrace: time.Second, ID: "worker-1"})
+			process(w, msg)
+
+			if got := msg.outcome(); got != tt.outcome {
+				t.Errorf("message settled as %q, want %q", got, tt.outcome)
+			}
+			if len(repo.results) != tt.results {
+				t.Fatalf("saved %d result(s), want %d", len(repo.results), tt.results)
+			}
+			if tt.results > 0 {
+				result := repo.results[0]
+				if result.JobID != "job-1" || result.Status != "completed" || result.ModelName != "default" || result.WorkerID != "worker-1" {
+					t.Errorf("result = %+v", result)
+				}
+				if result.CountObjects == 0 || result.CountObjects != len(result.Detections) {
+					t.Errorf("result counts %d object(s) for %d detection(s)", result.CountObjects, len(result.Detections))
+				}
+			}
+
+			if tt.deadLetter == "" {
+				if len(repo.deadLetters) != 0 {
+					t.Errorf("dead letters = %+v, want none", repo.deadLetters)
+				}
+				return
+			}
+			if len(repo.deadLetters) != 1 {
+				t.Fatalf("recorded %d dead letter(s), want 1", len(repo.deadLetters))
+			}
+			letter := repo.deadLetters[0]
+			if letter.Reason != tt.deadLetter {
+				t.Errorf("dead letter reason = %q, want %q", letter.Reason, tt.deadLetter)
+			}
+			if !strings.Contains(letter.Error, tt.errorText) {
+				t.Errorf("dead letter error = %q, want it to mention %q", letter.Error, tt.errorText)
+			}
+			if string(letter.Payload) != body {
+				t.Errorf("dead letter payload = %q, want the message body", letter.Payload)
+			}
+		})
+	}
+}
+
+func TestProcessMessagesDuplicateSkipsDetector(t *testing.T) {
+	detector := fake.New()
+	repo := newRepository()
+	w := New(staticResolver{detector}, repo, nil, nil, Config{Concurrency: 1, ShutdownGrace: time.Second})
+
+	first, second := newDelivery(testMessage), newDelivery(testMessage)
+	process(w, first, second)
+
+	if first.outcome() != "ack" || second.outcome() != "ack" {
+		t.Errorf("messages settled as %q and %q, want ack and ack", first.outcome(), second.outcome())
+	}
+	if detector.Calls != 1 || len(repo.results) != 1 {
+		t.Errorf("detector called %d time(s), %d result(s) saved, want 1 and 1", detector.Calls, len(repo.results))
+	}
+}
+
+func TestProcessMessagesShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		finish  bool // the job finishes within the grace period
+		outcome string
+		results int
+	}{
+		{name: "job finishes within the grace period", finish: true, outcome: "ack", results: 1},
+		{name: "grace period expires", outcome: "requeue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := newBlockingDetector()
+			repo := newRepository()
+			w := New(staticResolver{detector}, repo, nil, nil, Config{Concurrency: 1, ShutdownGrace: 50 * time.Millisecond})
+
+			msg := newDelivery(testMessage)
+			msgs := make(chan queue.Delivery, 1)
+			msgs <- msg
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				w.ProcessMessages(ctx, msgs)
+			}()
+
+			<-detector.started
+			cancel()
+			if tt.finish {
+				close(detector.release)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("ProcessMessages did not return after shutdown")
+			}
+
+			if got := msg.outcome(); got != tt.outcome {
+				t.Errorf("message settled as %q, want %q", got, tt.outcome)
+			}
+			if len(repo.results) != tt.results {
+				t.Errorf("saved %d result(s), want %d", len(repo.results), tt.results)
+			}
+			if len(repo.deadLetters) != 0 {
+				t.Errorf("dead letters = %+v, want none", repo.deadLetters)
+			}
+		})
+	}
+}